@@ -6,17 +6,19 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/fulcro-cloud/namespace-isolation/pkg/agent"
+	"github.com/fulcro-cloud/namespace-isolation/pkg/agent/admission"
+	"github.com/fulcro-cloud/namespace-isolation/pkg/webhook"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 )
 
 func main() {
-	kubeconfig := flag.String("kubeconfig", "", "Path to kubeconfig file (uses in-cluster config if empty)")
-	cgroupRoot := flag.String("cgroup-root", "/sys/fs/cgroup", "Root path for cgroup v2 filesystem")
-	slicePrefix := flag.String("slice-prefix", "brasa.slice", "Prefix for cgroup slice names")
-	logLevel := flag.String("log-level", "info", "Log level (debug, info, warn, error)")
-	metricsPort := flag.String("metrics-port", "9090", "Port for Prometheus metrics server")
+	cfg := agent.DefaultAgentConfig()
+	cfg.BindFlags(flag.CommandLine)
+	configFile := flag.String("config-file", "", "YAML file with agent settings; flags set on the command line take precedence")
 	flag.Parse()
 
 	log := logrus.New()
@@ -25,54 +27,224 @@ func main() {
 		TimestampFormat: "2006-01-02T15:04:05.000Z07:00",
 	})
 
-	level, err := logrus.ParseLevel(*logLevel)
-	if err != nil {
-		log.WithError(err).Warn("Invalid log level, defaulting to info")
-		level = logrus.InfoLevel
+	explicit := agent.ExplicitFlags(flag.CommandLine, "config-file")
+	if *configFile != "" {
+		loaded, err := agent.LoadAgentConfig(*configFile, explicit)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to load config file")
+		}
+		cfg = loaded
+	} else if err := cfg.Validate(); err != nil {
+		log.WithError(err).Fatal("Invalid configuration")
 	}
+
+	level, _ := logrus.ParseLevel(cfg.LogLevel)
 	log.SetLevel(level)
+	log.SetReportCaller(cfg.LogCaller)
+	log.SetOutput(agent.LogOutputWriter(cfg.LogOutput))
+
+	logGOMAXPROCS(log)
+
+	// Not stored in cfg, which a SIGHUP compares with the reloaded file
+	nodeName := cfg.NodeName
+	if nodeName == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.WithError(err).Fatal("Failed to determine node name, set --node-name")
+		}
+		nodeName = hostname
+	}
 
 	log.WithFields(logrus.Fields{
-		"cgroup_root":  *cgroupRoot,
-		"slice_prefix": *slicePrefix,
-		"metrics_port": *metricsPort,
+		"node":         nodeName,
+		"cgroup_root":  cfg.CgroupRoot,
+		"slice_prefix": cfg.SlicePrefix,
+		"metrics_port": cfg.MetricsPort,
+		"cpu_period":   cfg.CPUPeriod,
+		"workers":      cfg.Workers,
+		"dry_run":      cfg.DryRun,
+		"leader_elect": cfg.LeaderElect,
 	}).Info("Starting nri-namespace-isolator agent")
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
 
 	go func() {
-		sig := <-sigCh
-		log.WithField("signal", sig.String()).Info("Received shutdown signal")
-		cancel()
+		for sig := range sigCh {
+			if sig == syscall.SIGHUP {
+				reloadConfig(log, *configFile, explicit, cfg)
+				continue
+			}
+			log.WithField("signal", sig.String()).Info("Received shutdown signal")
+			cancel()
+			return
+		}
 	}()
 
-	cgroupManager := agent.NewCgroupManager(*cgroupRoot, *slicePrefix, log)
+	if cfg.OTelEndpoint != "" {
+		shutdownTracing, err := agent.SetupTracing(ctx, cfg.OTelEndpoint, cfg.OTelServiceName)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to set up tracing")
+		}
+		defer func() {
+			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer shutdownCancel()
+			if err := shutdownTracing(shutdownCtx); err != nil {
+				log.WithError(err).Warn("Failed to flush traces")
+			}
+		}()
+		log.WithField("endpoint", cfg.OTelEndpoint).Info("Tracing enabled")
+	}
+
+	var slicePrefixOverrides map[string]string
+	if cfg.SlicePrefixConfigMap != "" {
+		k8sClient, err := agent.NewK8sClient(cfg.Kubeconfig)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to create k8s client")
+		}
+		slicePrefixOverrides, err = k8sClient.GetSlicePrefixOverrides(ctx, cfg.SlicePrefixConfigMapNamespace, cfg.SlicePrefixConfigMap)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to load slice prefix overrides")
+		}
+		log.WithFields(logrus.Fields{
+			"config_map": cfg.SlicePrefixConfigMapNamespace + "/" + cfg.SlicePrefixConfigMap,
+			"overrides":  len(slicePrefixOverrides),
+		}).Info("Loaded slice prefix overrides")
+	}
 
-	metricsServer := agent.NewMetricsServer(cgroupManager, *metricsPort, log)
-	if err := metricsServer.Start(); err != nil {
+	cgroupManager, err := agent.NewCgroupManager(cfg.CgroupRoot, cfg.SlicePrefix, cfg.CPUPeriod, log,
+		agent.WithRequireCgroupV2(cfg.RequireCgroupV2),
+		agent.WithSlicePrefixOverrides(slicePrefixOverrides))
+	if err != nil {
+		log.WithError(err).Fatal("Failed to create cgroup manager")
+	}
+
+	metricsServer := agent.NewMetricsServer(cgroupManager, cfg.MetricsPort, cfg.MetricsNamespace, nodeName, log)
+	if cfg.MetricsAuthUser != "" {
+		metricsServer.SetBasicAuth(cfg.MetricsAuthUser, cfg.MetricsAuthPasswordHash)
+	}
+	if cfg.MetricsTLSCert != "" {
+		err = metricsServer.StartTLS(cfg.MetricsTLSCert, cfg.MetricsTLSKey)
+	} else {
+		err = metricsServer.Start()
+	}
+	if err != nil {
 		log.WithError(err).Fatal("Failed to start metrics server")
 	}
 
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		webhookServer := webhook.NewServer(cfg.WebhookPort, cfg.TLSCertFile, cfg.TLSKeyFile, log)
+		if cfg.AdmissionMemoryThreshold > 0 {
+			webhookServer.Handle(admission.Path, admission.NewAdmissionHandler(metricsServer, cgroupManager, cfg.AdmissionMemoryThreshold, log))
+		}
+		if err := webhookServer.Start(); err != nil {
+			log.WithError(err).Fatal("Failed to start webhook server")
+		}
+	}
+
 	config := agent.ControllerConfig{
-		Kubeconfig:    *kubeconfig,
-		CgroupRoot:    *cgroupRoot,
-		SlicePrefix:   *slicePrefix,
-		Log:           log,
-		MetricsServer: metricsServer,
+		Kubeconfig:           cfg.Kubeconfig,
+		NodeName:             nodeName,
+		CgroupRoot:           cfg.CgroupRoot,
+		SlicePrefix:          cfg.SlicePrefix,
+		SlicePrefixOverrides: slicePrefixOverrides,
+		CPUPeriodUs:          cfg.CPUPeriod,
+		Workers:              cfg.Workers,
+		MaxRetries:           cfg.MaxRetries,
+		RetryBaseDelay:       cfg.RetryBaseDelay.Duration,
+		RetryMaxDelay:        cfg.RetryMaxDelay.Duration,
+		NamespaceFilterLabel: cfg.NamespaceFilterLabel,
+		NamespacePrefix:      cfg.NamespacePrefix,
+		DryRun:               cfg.DryRun,
+		ReconcileInterval:    cfg.ReconcileInterval.Duration,
+		ShutdownTimeout:      cfg.ShutdownTimeout.Duration,
+		ResyncPeriod:         cfg.ResyncPeriod.Duration,
+		ReportInterval:       cfg.ReportInterval.Duration,
+		Log:                  log,
+		MetricsServer:        metricsServer,
+
+		AutoCreateFromAnnotations:  cfg.AutoCreateFromAnnotations,
+		EnablePolicies:             cfg.EnablePolicies,
+		CleanupOrphans:             cfg.CleanupOrphans,
+		ResyncOnStartup:            cfg.ResyncOnStartup,
+		UseResourceQuotaFallback:   cfg.UseResourceQuotaFallback,
+		PriorityClassWeightDivisor: int32(cfg.PriorityClassWeightDivisor),
+		FastWatch:                  cfg.FastWatch,
+		EmitEventsForOOM:           cfg.EmitEventsForOOM,
+		OOMEventInterval:           cfg.OOMEventRateLimit.Duration,
+		SystemdCallRate:            cfg.SystemdCallRate,
+		SystemdCallBurst:           cfg.SystemdCallBurst,
+		RequireCgroupV2:            cfg.RequireCgroupV2,
+		SystemdTimeout:             cfg.SystemdTimeout.Duration,
+		SystemdExecutor:            cfg.SystemdExecutor,
+		WaitForSliceReady:          cfg.WaitForSliceReady,
+		AllowedCgroupAttributes:    cfg.CgroupAttributeAllowlist(),
+		DisableSSA:                 cfg.DisableSSA,
+		EventRateLimit:             rate.Limit(cfg.EventRateLimit),
+		EventBurst:                 cfg.EventBurst,
+		LeaderElection: agent.LeaderElectionConfig{
+			Enabled:       cfg.LeaderElect,
+			LeaseDuration: cfg.LeaderElectLeaseDuration.Duration,
+			RenewDeadline: cfg.LeaderElectRenewDeadline.Duration,
+			RetryPeriod:   cfg.LeaderElectRetryPeriod.Duration,
+		},
 	}
 
 	controller, err := agent.NewController(config)
 	if err != nil {
 		log.WithError(err).Fatal("Failed to create controller")
 	}
+	metricsServer.SetHealthChecker(controller)
+	metricsServer.SetSliceEnsurer(controller)
 
 	if err := controller.Run(ctx); err != nil {
 		log.WithError(err).Fatal("Controller error")
 	}
 
+	metricsServer.UnregisterMetrics()
+
 	log.Info("Agent shutdown complete")
 }
+
+// logGOMAXPROCS tunes GOMAXPROCS to the CPU quota of the agent's cgroup and
+// logs the result
+func logGOMAXPROCS(log *logrus.Logger) {
+	procs, quota, err := agent.TuneGOMAXPROCS()
+	if err != nil {
+		log.WithError(err).Warn("Failed to read the CPU quota of the agent cgroup")
+	}
+	log.WithFields(logrus.Fields{
+		"gomaxprocs": procs,
+		"cpu_quota":  quota,
+	}).Info("GOMAXPROCS set")
+}
+
+// reloadConfig re-reads the config file on SIGHUP. The log settings are
+// applied live; other changed settings are logged by name and take effect on
+// restart.
+func reloadConfig(log *logrus.Logger, configFile string, explicit map[string]string, current agent.AgentConfig) {
+	if configFile == "" {
+		log.Warn("Received SIGHUP but no --config-file is set, ignoring")
+		return
+	}
+
+	reloaded, err := agent.LoadAgentConfig(configFile, explicit)
+	if err != nil {
+		log.WithError(err).Error("Failed to reload config file, keeping current configuration")
+		return
+	}
+
+	level, _ := logrus.ParseLevel(reloaded.LogLevel)
+	log.SetLevel(level)
+	log.SetReportCaller(reloaded.LogCaller)
+	log.SetOutput(agent.LogOutputWriter(reloaded.LogOutput))
+
+	current.LogLevel, current.LogCaller, current.LogOutput = reloaded.LogLevel, reloaded.LogCaller, reloaded.LogOutput
+	if changed := agent.ChangedConfigFields(current, reloaded); len(changed) > 0 {
+		log.WithField("fields", changed).Warn("Config file changed settings that need a restart of the agent")
+	}
+	log.WithField("log_level", reloaded.LogLevel).Info("Configuration reloaded")
+}
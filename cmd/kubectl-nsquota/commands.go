@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/agent"
+	"github.com/fulcro-cloud/namespace-isolation/pkg/agent/simulation"
+	"github.com/fulcro-cloud/namespace-isolation/pkg/api/v1alpha1"
+	"github.com/fulcro-cloud/namespace-isolation/pkg/client/clientset/versioned"
+)
+
+func runList(ctx context.Context, client versioned.Interface, _ *flag.FlagSet, _ []string, out io.Writer) error {
+	list, err := client.BrasaV1alpha1().NamespaceQuotas().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list NamespaceQuotas: %w", err)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tCPU\tMEMORY\tENABLED\tREADY\tLAST UPDATED")
+	for i := range list.Items {
+		quota := &list.Items[i]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%t\t%s\n",
+			quota.Spec.Namespace,
+			valueOrNone(quota.Spec.CPU),
+			valueOrNone(quota.Spec.Memory),
+			quota.IsEnabled(),
+			quota.Status.Ready,
+			lastUpdated(quota),
+		)
+	}
+	return w.Flush()
+}
+
+func runGet(ctx context.Context, client versioned.Interface, _ *flag.FlagSet, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("get requires exactly one namespace argument")
+	}
+
+	quota, err := findQuota(ctx, client, args[0])
+	if err != nil {
+		return err
+	}
+	if quota == nil {
+		return fmt.Errorf("no NamespaceQuota found for namespace %s", args[0])
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", quota.Name)
+	fmt.Fprintf(w, "Namespace:\t%s\n", quota.Spec.Namespace)
+	fmt.Fprintf(w, "CPU:\t%s\n", valueOrNone(quota.Spec.CPU))
+	fmt.Fprintf(w, "Memory:\t%s\n", valueOrNone(quota.Spec.Memory))
+	if quota.Spec.CPUWeight != 0 {
+		fmt.Fprintf(w, "CPU Weight:\t%d\n", quota.Spec.CPUWeight)
+	}
+	fmt.Fprintf(w, "Enabled:\t%t\n", quota.IsEnabled())
+	fmt.Fprintf(w, "Ready:\t%t\n", quota.Status.Ready)
+	fmt.Fprintf(w, "Message:\t%s\n", valueOrNone(quota.Status.Message))
+	fmt.Fprintf(w, "Last Updated:\t%s\n", lastUpdated(quota))
+	return w.Flush()
+}
+
+func setFlags(fs *flag.FlagSet) {
+	fs.String("namespace", "", "Target namespace (required)")
+	fs.String("cpu", "", "CPU limit as a quantity (e.g. 2, 500m)")
+	fs.String("memory", "", "Memory limit as a quantity (e.g. 512Mi, 1.5Gi)")
+	fs.Int64("cpu-weight", 0, "Relative CPU share under contention (1-10000)")
+	fs.String("enabled", "", "Whether the quota is enforced (true or false)")
+	fs.Bool("dry-run", false, "Validate the quota and print the result without saving it")
+	fs.Bool("simulate", false, "With --dry-run, check the quota against node capacity and current pod usage")
+}
+
+func runSet(ctx context.Context, client versioned.Interface, fs *flag.FlagSet, _ []string, out io.Writer) error {
+	namespace := fs.Lookup("namespace").Value.String()
+	if namespace == "" {
+		return fmt.Errorf("--namespace is required")
+	}
+
+	quota, err := findQuota(ctx, client, namespace)
+	if err != nil {
+		return err
+	}
+
+	create := quota == nil
+	if create {
+		quota = &v1alpha1.NamespaceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: namespace},
+			Spec:       v1alpha1.NamespaceQuotaSpec{Namespace: namespace},
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "cpu":
+			quota.Spec.CPU = f.Value.String()
+		case "memory":
+			quota.Spec.Memory = f.Value.String()
+		case "cpu-weight":
+			quota.Spec.CPUWeight = f.Value.(flag.Getter).Get().(int64)
+		case "enabled":
+			enabled, err := strconv.ParseBool(f.Value.String())
+			if err != nil {
+				flagErr = fmt.Errorf("invalid --enabled value %q: %w", f.Value.String(), err)
+				return
+			}
+			quota.Spec.Enabled = &enabled
+		}
+	})
+	if flagErr != nil {
+		return flagErr
+	}
+
+	if err := agent.ValidateNamespaceQuotaSpec(&quota.Spec); err != nil {
+		return err
+	}
+
+	dryRun := fs.Lookup("dry-run").Value.(flag.Getter).Get().(bool)
+	simulate := fs.Lookup("simulate").Value.(flag.Getter).Get().(bool)
+	if simulate && !dryRun {
+		return fmt.Errorf("--simulate requires --dry-run")
+	}
+	if dryRun {
+		action := "configured"
+		if create {
+			action = "created"
+		}
+		fmt.Fprintf(out, "namespacequota/%s %s (dry run)\n", quota.Name, action)
+		if simulate {
+			return runSimulation(ctx, fs, quota, out)
+		}
+		return nil
+	}
+
+	quotas := client.BrasaV1alpha1().NamespaceQuotas()
+	if create {
+		if _, err := quotas.Create(ctx, quota, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create NamespaceQuota: %w", err)
+		}
+		fmt.Fprintf(out, "namespacequota/%s created\n", quota.Name)
+		return nil
+	}
+
+	if _, err := quotas.Update(ctx, quota, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update NamespaceQuota: %w", err)
+	}
+	fmt.Fprintf(out, "namespacequota/%s configured\n", quota.Name)
+	return nil
+}
+
+func runDelete(ctx context.Context, client versioned.Interface, _ *flag.FlagSet, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("delete requires exactly one namespace argument")
+	}
+
+	quota, err := findQuota(ctx, client, args[0])
+	if err != nil {
+		return err
+	}
+	if quota == nil {
+		return fmt.Errorf("no NamespaceQuota found for namespace %s", args[0])
+	}
+
+	err = client.BrasaV1alpha1().NamespaceQuotas().Delete(ctx, quota.Name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete NamespaceQuota: %w", err)
+	}
+
+	fmt.Fprintf(out, "namespacequota/%s deleted\n", quota.Name)
+	return nil
+}
+
+// runSimulation prints the simulation of quota on every node it selects
+func runSimulation(ctx context.Context, fs *flag.FlagSet, quota *v1alpha1.NamespaceQuota, out io.Writer) error {
+	config, err := newRESTConfig(fs.Lookup("kubeconfig").Value.String(), fs.Lookup("context").Value.String())
+	if err != nil {
+		return err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create clientset: %w", err)
+	}
+
+	nodes, err := simulation.CollectNodeInfo(ctx, client)
+	if err != nil {
+		return err
+	}
+	if err := simulation.AddNamespaceUsage(ctx, client, quota.Spec.Namespace, nodes); err != nil {
+		fmt.Fprintf(out, "warning: pod usage not checked: %v\n", err)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NODE\tRESULT")
+	warnings := 0
+	for _, node := range nodes {
+		if !node.Selected(quota.Spec) {
+			continue
+		}
+		result := simulation.Simulate(quota.Spec, node)
+		if result.OK() {
+			fmt.Fprintf(w, "%s\tok\n", result.Node)
+			continue
+		}
+		for _, warning := range result.Warnings {
+			fmt.Fprintf(w, "%s\t%s\n", result.Node, warning)
+			warnings++
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if warnings > 0 {
+		return fmt.Errorf("simulation found %d warning(s)", warnings)
+	}
+	return nil
+}
+
+// findQuota returns the quota targeting the given namespace, or nil if none exists
+func findQuota(ctx context.Context, client versioned.Interface, namespace string) (*v1alpha1.NamespaceQuota, error) {
+	list, err := client.BrasaV1alpha1().NamespaceQuotas().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list NamespaceQuotas: %w", err)
+	}
+
+	for i := range list.Items {
+		if list.Items[i].Spec.Namespace == namespace {
+			return &list.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
+
+func lastUpdated(quota *v1alpha1.NamespaceQuota) string {
+	if quota.Status.LastUpdated == nil {
+		return "<never>"
+	}
+	return quota.Status.LastUpdated.Format(time.RFC3339)
+}
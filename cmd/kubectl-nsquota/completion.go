@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+const bashCompletion = `# bash completion for kubectl-nsquota
+_kubectl_nsquota() {
+    local cur prev words cword
+    _init_completion || return
+
+    local commands="list get set delete completion version help"
+    local global_flags="--kubeconfig --context"
+
+    if [[ ${cword} -eq 1 ]]; then
+        COMPREPLY=($(compgen -W "${commands}" -- "${cur}"))
+        return
+    fi
+
+    case "${prev}" in
+        --kubeconfig)
+            _filedir
+            return
+            ;;
+        --context)
+            COMPREPLY=($(compgen -W "$(kubectl config get-contexts -o name 2>/dev/null)" -- "${cur}"))
+            return
+            ;;
+        --namespace)
+            COMPREPLY=($(compgen -W "$(kubectl get namespaces -o name 2>/dev/null | cut -d/ -f2)" -- "${cur}"))
+            return
+            ;;
+        --enabled)
+            COMPREPLY=($(compgen -W "true false" -- "${cur}"))
+            return
+            ;;
+    esac
+
+    case "${words[1]}" in
+        set)
+            COMPREPLY=($(compgen -W "--namespace --cpu --memory --cpu-weight --enabled --dry-run --simulate ${global_flags}" -- "${cur}"))
+            ;;
+        get|delete)
+            if [[ "${cur}" == -* ]]; then
+                COMPREPLY=($(compgen -W "${global_flags}" -- "${cur}"))
+            else
+                COMPREPLY=($(compgen -W "$(kubectl get namespacequotas -o jsonpath='{.items[*].spec.namespace}' 2>/dev/null)" -- "${cur}"))
+            fi
+            ;;
+        list)
+            COMPREPLY=($(compgen -W "${global_flags}" -- "${cur}"))
+            ;;
+        completion)
+            COMPREPLY=($(compgen -W "bash zsh" -- "${cur}"))
+            ;;
+    esac
+}
+
+complete -F _kubectl_nsquota kubectl-nsquota
+`
+
+const zshCompletion = `#compdef kubectl-nsquota
+
+_kubectl_nsquota() {
+    local -a commands global_flags
+    commands=(
+        'list:List all namespace quotas'
+        'get:Show the quota applied to a namespace'
+        'set:Create or update the quota for a namespace'
+        'delete:Remove the quota for a namespace'
+        'completion:Print a shell completion script'
+        'version:Print the plugin version'
+    )
+    global_flags=(
+        '--kubeconfig[Path to the kubeconfig file]:file:_files'
+        '--context[Kubeconfig context to use]:context:($(kubectl config get-contexts -o name 2>/dev/null))'
+    )
+
+    if (( CURRENT == 2 )); then
+        _describe 'command' commands
+        return
+    fi
+
+    case "${words[2]}" in
+        set)
+            _arguments \
+                '--namespace[Target namespace]:namespace:($(kubectl get namespaces -o name 2>/dev/null | cut -d/ -f2))' \
+                '--cpu[CPU limit as a quantity]:cpu:' \
+                '--memory[Memory limit as a quantity]:memory:' \
+                '--cpu-weight[Relative CPU share under contention]:weight:' \
+                '--enabled[Whether the quota is enforced]:enabled:(true false)' \
+                '--dry-run[Validate without saving]' \
+                '--simulate[Check against node capacity and pod usage]' \
+                "${global_flags[@]}"
+            ;;
+        get|delete)
+            _arguments \
+                "${global_flags[@]}" \
+                '1:namespace:($(kubectl get namespacequotas -o jsonpath="{.items[*].spec.namespace}" 2>/dev/null))'
+            ;;
+        list)
+            _arguments "${global_flags[@]}"
+            ;;
+        completion)
+            _arguments '1:shell:(bash zsh)'
+            ;;
+    esac
+}
+
+compdef _kubectl_nsquota kubectl-nsquota
+`
+
+func runCompletion(args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("completion requires a shell argument (bash or zsh)")
+	}
+
+	switch args[0] {
+	case "bash":
+		fmt.Fprint(out, bashCompletion)
+	case "zsh":
+		fmt.Fprint(out, zshCompletion)
+	default:
+		return fmt.Errorf("unsupported shell %q, expected bash or zsh", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/client/clientset/versioned"
+)
+
+var (
+	Version = "dev"
+	Commit  = "unknown"
+)
+
+const usage = `kubectl nsquota manages NamespaceQuota objects.
+
+Usage:
+  kubectl nsquota <command> [flags]
+
+Commands:
+  list                      List all namespace quotas
+  get <namespace>           Show the quota applied to a namespace
+  set --namespace <ns> ...  Create or update the quota for a namespace
+                            (--dry-run [--simulate] checks it without saving)
+  delete <namespace>        Remove the quota for a namespace
+  completion <bash|zsh>     Print a shell completion script
+  version                   Print the plugin version
+
+Global flags (accepted by every command):
+  --kubeconfig string   Path to the kubeconfig file
+  --context string      Kubeconfig context to use
+`
+
+type command struct {
+	name string
+	run  func(ctx context.Context, client versioned.Interface, fs *flag.FlagSet, args []string, out io.Writer) error
+	// flags registers command-specific flags on the flag set
+	flags func(fs *flag.FlagSet)
+}
+
+var commands = []command{
+	{name: "list", run: runList},
+	{name: "get", run: runGet},
+	{name: "set", run: runSet, flags: setFlags},
+	{name: "delete", run: runDelete},
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(out, usage)
+		return nil
+	}
+
+	switch args[0] {
+	case "-h", "--help", "help":
+		fmt.Fprint(out, usage)
+		return nil
+	case "version":
+		fmt.Fprintf(out, "kubectl-nsquota %s (%s)\n", Version, Commit)
+		return nil
+	case "completion":
+		return runCompletion(args[1:], out)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+
+		fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		kubeconfig := fs.String("kubeconfig", "", "Path to the kubeconfig file")
+		kubeContext := fs.String("context", "", "Kubeconfig context to use")
+		if cmd.flags != nil {
+			cmd.flags(fs)
+		}
+		if err := fs.Parse(args[1:]); err != nil {
+			if err == flag.ErrHelp {
+				return nil
+			}
+			return err
+		}
+
+		client, err := newClient(*kubeconfig, *kubeContext)
+		if err != nil {
+			return err
+		}
+
+		return cmd.run(context.Background(), client, fs, fs.Args(), out)
+	}
+
+	return fmt.Errorf("unknown command %q, run 'kubectl nsquota help' for usage", args[0])
+}
+
+func newRESTConfig(kubeconfig, kubeContext string) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	return config, nil
+}
+
+func newClient(kubeconfig, kubeContext string) (versioned.Interface, error) {
+	config, err := newRESTConfig(kubeconfig, kubeContext)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := versioned.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create NamespaceQuota clientset: %w", err)
+	}
+
+	return client, nil
+}
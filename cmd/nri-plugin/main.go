@@ -9,6 +9,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/fulcro-cloud/namespace-isolation/pkg/agent"
 	"github.com/fulcro-cloud/namespace-isolation/pkg/plugin"
 )
 
@@ -18,67 +19,63 @@ var (
 )
 
 func main() {
-	var (
-		pluginName string
-		pluginIdx  string
-		kubeconfig string
-		logLevel   string
-		logFormat  string
-	)
-
-	flag.StringVar(&pluginName, "name", plugin.DefaultPluginName, "NRI plugin name")
-	flag.StringVar(&pluginIdx, "idx", plugin.DefaultPluginIdx, "NRI plugin index (determines priority)")
-	flag.StringVar(&kubeconfig, "kubeconfig", "", "Path to kubeconfig file (uses in-cluster config if empty)")
-	flag.StringVar(&logLevel, "log-level", "info", "Log level (debug, info, warn, error)")
-	flag.StringVar(&logFormat, "log-format", "json", "Log format (json, text)")
+	cfg := plugin.DefaultPluginConfig()
+	cfg.BindFlags(flag.CommandLine)
+	configFile := flag.String("config-file", "", "YAML file with plugin settings; flags set on the command line take precedence")
 	flag.Parse()
 
 	log := logrus.New()
 
-	if logFormat == "json" {
-		log.SetFormatter(&logrus.JSONFormatter{
-			TimestampFormat: "2006-01-02T15:04:05.000Z07:00",
-		})
-	} else {
-		log.SetFormatter(&logrus.TextFormatter{
-			FullTimestamp:   true,
-			TimestampFormat: "2006-01-02T15:04:05.000Z07:00",
-		})
+	explicit := agent.ExplicitFlags(flag.CommandLine, "config-file")
+	if *configFile != "" {
+		loaded, err := plugin.LoadPluginConfig(*configFile, explicit)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to load config file")
+		}
+		cfg = loaded
+	} else if err := cfg.Validate(); err != nil {
+		log.WithError(err).Fatal("Invalid configuration")
 	}
 
-	level, err := logrus.ParseLevel(logLevel)
+	applyLogSettings(log, cfg)
+	log.SetReportCaller(cfg.LogCaller)
+	log.SetOutput(agent.LogOutputWriter(cfg.LogOutput))
+
+	procs, quota, err := agent.TuneGOMAXPROCS()
 	if err != nil {
-		log.WithError(err).Warn("Invalid log level, defaulting to info")
-		level = logrus.InfoLevel
+		log.WithError(err).Warn("Failed to read the CPU quota of the plugin cgroup")
 	}
-	log.SetLevel(level)
+	log.WithFields(logrus.Fields{
+		"gomaxprocs": procs,
+		"cpu_quota":  quota,
+	}).Info("GOMAXPROCS set")
 
 	log.WithFields(logrus.Fields{
 		"version":    version,
 		"commit":     commit,
-		"pluginName": pluginName,
-		"pluginIdx":  pluginIdx,
+		"pluginName": cfg.Name,
+		"pluginIdx":  cfg.Idx,
 	}).Info("Starting nri-namespace-isolator")
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
 	go func() {
-		sig := <-sigCh
-		log.WithField("signal", sig.String()).Info("Received shutdown signal")
-		cancel()
+		for sig := range sigCh {
+			if sig == syscall.SIGHUP {
+				reloadConfig(log, *configFile, explicit, cfg)
+				continue
+			}
+			log.WithField("signal", sig.String()).Info("Received shutdown signal")
+			cancel()
+			return
+		}
 	}()
 
-	cfg := plugin.Config{
-		Name:       pluginName,
-		Idx:        pluginIdx,
-		Kubeconfig: kubeconfig,
-	}
-
-	p, err := plugin.New(cfg, log)
+	p, err := plugin.New(cfg.Config(), log)
 	if err != nil {
 		log.WithError(err).Fatal("Failed to create plugin")
 	}
@@ -90,3 +87,46 @@ func main() {
 
 	log.Info("Plugin shutdown complete")
 }
+
+func applyLogSettings(log *logrus.Logger, cfg plugin.PluginConfig) {
+	if cfg.LogFormat == "json" {
+		log.SetFormatter(&logrus.JSONFormatter{
+			TimestampFormat: "2006-01-02T15:04:05.000Z07:00",
+		})
+	} else {
+		log.SetFormatter(&logrus.TextFormatter{
+			FullTimestamp:   true,
+			TimestampFormat: "2006-01-02T15:04:05.000Z07:00",
+		})
+	}
+
+	level, _ := logrus.ParseLevel(cfg.LogLevel)
+	log.SetLevel(level)
+}
+
+// reloadConfig re-reads the config file on SIGHUP. The log settings are
+// applied live; other changed settings are logged by name and take effect on
+// restart.
+func reloadConfig(log *logrus.Logger, configFile string, explicit map[string]string, current plugin.PluginConfig) {
+	if configFile == "" {
+		log.Warn("Received SIGHUP but no --config-file is set, ignoring")
+		return
+	}
+
+	reloaded, err := plugin.LoadPluginConfig(configFile, explicit)
+	if err != nil {
+		log.WithError(err).Error("Failed to reload config file, keeping current configuration")
+		return
+	}
+
+	applyLogSettings(log, reloaded)
+	log.SetReportCaller(reloaded.LogCaller)
+	log.SetOutput(agent.LogOutputWriter(reloaded.LogOutput))
+
+	current.LogLevel, current.LogFormat = reloaded.LogLevel, reloaded.LogFormat
+	current.LogCaller, current.LogOutput = reloaded.LogCaller, reloaded.LogOutput
+	if changed := agent.ChangedConfigFields(current, reloaded); len(changed) > 0 {
+		log.WithField("fields", changed).Warn("Config file changed settings that need a restart of the plugin")
+	}
+	log.WithField("log_level", reloaded.LogLevel).Info("Configuration reloaded")
+}
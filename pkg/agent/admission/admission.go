@@ -0,0 +1,139 @@
+// Package admission rejects new pods of namespaces that are already close to
+// their memory limit. The cgroup limits only throttle and OOM kill, so
+// without it such pods are scheduled and fail at runtime.
+package admission
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/agent"
+	"github.com/fulcro-cloud/namespace-isolation/pkg/webhook"
+)
+
+const (
+	Path = "/validate/pod"
+
+	// AnnotationSkipAdmissionCheck set to "true" on a pod admits it
+	// regardless of the namespace usage
+	AnnotationSkipAdmissionCheck = "brasa.cloud/skip-admission-check"
+)
+
+// ValidatingWebhookConfiguration is the manifest registering the pod
+// admission endpoint with the API server. Its caBundle must be filled in at
+// deploy time.
+//
+//go:embed manifests/validatingwebhookconfiguration.yaml
+var ValidatingWebhookConfiguration []byte
+
+// StatsReader reads the usage of a namespace slice; implemented by agent.MetricsServer
+type StatsReader interface {
+	ReadCgroupStats(ctx context.Context, namespace string) (*agent.CgroupStats, error)
+}
+
+// LimitsReader reads the limits applied to a namespace slice; implemented by
+// agent.CgroupManager
+type LimitsReader interface {
+	GetCurrentLimits(namespace string) (cpuQuota, memoryBytes, memoryHigh, cpuWeight int64, err error)
+}
+
+// AdmissionHandler serves the pod admission webhook. Usage and limits are
+// read from the slice on the node of the agent answering the request.
+type AdmissionHandler struct {
+	stats     StatsReader
+	limits    LimitsReader
+	threshold int
+	log       *logrus.Logger
+}
+
+// NewAdmissionHandler returns a handler rejecting pods of namespaces using at
+// least threshold percent of their memory limit
+func NewAdmissionHandler(stats StatsReader, limits LimitsReader, threshold int, log *logrus.Logger) *AdmissionHandler {
+	return &AdmissionHandler{
+		stats:     stats,
+		limits:    limits,
+		threshold: threshold,
+		log:       log,
+	}
+}
+
+func (h *AdmissionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	review, err := webhook.ReadAdmissionReview(r)
+	if err != nil {
+		h.log.WithError(err).Warn("Rejecting malformed admission request")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	review.Response = h.admit(r.Context(), review.Request)
+	review.Request = nil
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		h.log.WithError(err).Error("Failed to write admission response")
+	}
+}
+
+// admit denies the pod if its namespace is over the threshold. Pods are
+// admitted whenever usage cannot be determined.
+func (h *AdmissionHandler) admit(ctx context.Context, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	allowed := &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+	if req.Operation != admissionv1.Create || req.Kind.Kind != "Pod" {
+		return allowed
+	}
+
+	log := h.log.WithFields(logrus.Fields{
+		"uid":       req.UID,
+		"namespace": req.Namespace,
+		"name":      req.Name,
+	})
+
+	pod := &corev1.Pod{}
+	if err := json.Unmarshal(req.Object.Raw, pod); err != nil {
+		log.WithError(err).Warn("Failed to decode pod, admitting it")
+		return allowed
+	}
+	if pod.Annotations[AnnotationSkipAdmissionCheck] == "true" {
+		log.Debug("Admission check skipped by annotation")
+		return allowed
+	}
+
+	_, memoryLimit, _, _, err := h.limits.GetCurrentLimits(req.Namespace)
+	if err != nil || memoryLimit <= 0 {
+		return allowed
+	}
+	stats, err := h.stats.ReadCgroupStats(ctx, req.Namespace)
+	if err != nil {
+		log.WithError(err).Debug("Failed to read namespace usage, admitting pod")
+		return allowed
+	}
+
+	usage := stats.MemoryUsageBytes * 100 / memoryLimit
+	if usage < int64(h.threshold) {
+		return allowed
+	}
+
+	message := fmt.Sprintf("namespace %s uses %d%% of its memory limit (%s of %s), at or above the admission threshold of %d%%; set the %s=true annotation to bypass",
+		req.Namespace, usage,
+		agent.FormatMemoryForDisplay(stats.MemoryUsageBytes), agent.FormatMemoryForDisplay(memoryLimit),
+		h.threshold, AnnotationSkipAdmissionCheck)
+	log.WithField("usage_percent", usage).Info("Denied pod of namespace over its memory threshold")
+	return &admissionv1.AdmissionResponse{
+		UID:     req.UID,
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  metav1.StatusReasonForbidden,
+			Code:    http.StatusForbidden,
+			Message: message,
+		},
+	}
+}
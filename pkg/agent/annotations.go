@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const annotationSyncTimeout = 30 * time.Second
+
+// addAnnotationHandlers makes the namespace informer create quotas from
+// namespace annotations
+func (c *Controller) addAnnotationHandlers(informer cache.SharedIndexInformer) {
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if ns, ok := obj.(*corev1.Namespace); ok {
+				c.syncNamespaceAnnotations(ns)
+			}
+		},
+		UpdateFunc: func(_, newObj interface{}) {
+			if ns, ok := newObj.(*corev1.Namespace); ok {
+				c.syncNamespaceAnnotations(ns)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if ns, ok := obj.(*corev1.Namespace); ok {
+				c.deleteAnnotationQuota(ns.Name)
+			}
+		},
+	})
+}
+
+// syncNamespaceAnnotations creates or updates the quota of an annotated
+// namespace, and deletes the quota it created once the annotations are gone.
+func (c *Controller) syncNamespaceAnnotations(ns *corev1.Namespace) {
+	cpu := ns.Annotations[AnnotationCPULimit]
+	memory := ns.Annotations[AnnotationMemoryLimit]
+
+	if cpu == "" && memory == "" {
+		c.deleteAnnotationQuota(ns.Name)
+		return
+	}
+
+	log := c.log.WithFields(logrus.Fields{
+		"namespace": ns.Name,
+		"cpu":       cpu,
+		"memory":    memory,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), annotationSyncTimeout)
+	defer cancel()
+
+	if err := c.k8sClient.UpsertNamespaceQuota(ctx, ns.Name, cpu, memory); err != nil {
+		log.WithError(err).Warn("Failed to create NamespaceQuota from annotations")
+		return
+	}
+	log.Debug("NamespaceQuota synced from annotations")
+}
+
+func (c *Controller) deleteAnnotationQuota(namespace string) {
+	if _, err := c.lister.Get(namespace); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), annotationSyncTimeout)
+	defer cancel()
+
+	if err := c.k8sClient.DeleteNamespaceQuota(ctx, namespace); err != nil {
+		c.log.WithError(err).WithField("namespace", namespace).Warn("Failed to delete NamespaceQuota created from annotations")
+	}
+}
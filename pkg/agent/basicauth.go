@@ -0,0 +1,29 @@
+package agent
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// basicAuthMiddleware requires HTTP basic auth with user and a password
+// matching the bcrypt passwordHash. The health endpoints stay open for the
+// kubelet probes.
+func basicAuthMiddleware(user, passwordHash string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requestUser, password, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(requestUser), []byte(user)) != 1 ||
+			bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)) != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -2,329 +2,1706 @@ package agent
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"math"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 const (
 	DefaultCPUPeriod    = 100000
+	MinCPUPeriod        = 1000
+	MaxCPUPeriod        = 1000000
+	MinCPUWeight        = 1
+	MaxCPUWeight        = 10000
 	RequiredControllers = "+cpu +memory +pids"
+
+	// defaultCPUWeight is systemd's CPUWeight of a slice without one
+	defaultCPUWeight = 100
+
+	// DefaultPriorityClassWeightDivisor is the PriorityClass value worth one
+	// CPUWeight point, so the 1000000000 of the highest user-defined
+	// PriorityClass maps to the maximum weight
+	DefaultPriorityClassWeightDivisor = 100000
+
+	DefaultSystemdTimeout = 10 * time.Second
+
+	// SystemdProbeInterval is how often RunSystemdProbe checks that systemd
+	// answers
+	SystemdProbeInterval = 30 * time.Second
+
+	// sliceReadyAttempts and sliceReadyPollInterval bound how long
+	// WaitForSliceReady waits for systemd to apply the limits
+	sliceReadyAttempts     = 10
+	sliceReadyPollInterval = 100 * time.Millisecond
+
+	// Default thresholds of GetMemoryPressureLevel, in percent of time
+	// (memory.pressure "some avg10")
+	DefaultMemoryPressureLowThreshold    = 20.0
+	DefaultMemoryPressureMediumThreshold = 50.0
 )
 
 type CgroupStats struct {
-	CPUUsageUsec     int64
-	CPUThrottled     int64
+	CPUUsageUsec int64
+	CPUThrottled int64
+	// CPUNrPeriods and CPUNrThrottled are the nr_periods and nr_throttled
+	// counters of cpu.stat; ThrottledPct is their ratio as a percentage
+	CPUNrPeriods     int64
+	CPUNrThrottled   int64
+	ThrottledPct     float64
 	MemoryUsageBytes int64
 	OOMKills         int64
+	CPUWeight        int64
+	CPUSetEffective  string
+	MemoryMinBytes   int64
+	MemoryLowBytes   int64
+	MemoryHighBytes  int64
+	OOMGroup         bool
+	CPUIdle          bool
+
+	// Pressure stall averages over the last 10s, as percentages (0-100)
+	CPUPressureSomeAvg10    float64
+	MemoryPressureSomeAvg10 float64
+	MemoryPressureFullAvg10 float64
+	IOPressureSomeAvg10     float64
+
+	// HugepagesUsageBytes is hugetlb.<size>.current by hugepage size (e.g. "2Mi")
+	HugepagesUsageBytes map[string]int64
+
+	// PidsCurrent and PidsMax are pids.current and pids.max (0 for "max")
+	PidsCurrent int64
+	PidsMax     int64
+}
+
+// procMountsPath is read by DetectCgroupVersion to find the cgroup mount type
+var procMountsPath = "/proc/mounts"
+
+// cpuSetPattern matches the Linux cpuset list format, e.g. "0-3,8-11" or "5"
+var cpuSetPattern = regexp.MustCompile(`^\d+(-\d+)?(,\d+(-\d+)?)*$`)
+
+// SystemdError reports a failed systemctl invocation on the host, as opposed
+// to an invalid limit or a cgroup filesystem error.
+type SystemdError struct {
+	Err    error
+	Output string
+}
+
+func (e *SystemdError) Error() string {
+	return fmt.Sprintf("%v, output: %s", e.Err, e.Output)
+}
+
+func (e *SystemdError) Unwrap() error {
+	return e.Err
 }
 
 type CgroupManager struct {
-	cgroupRoot  string
+	// fsRoot is where the cgroup v2 hierarchy is mounted; all slice paths are
+	// built under it, so tests can point it at a fake tree.
+	fsRoot      string
 	slicePrefix string
-	log         *logrus.Logger
+	cpuPeriodUs int64
+
+	// slicePrefixOverrides maps namespaces to a parent slice other than slicePrefix
+	slicePrefixOverrides map[string]string
+
+	log     *logrus.Logger
+	systemd SystemdInterface
+	limiter *SystemdCallLimiter
+
+	// systemdTimeout bounds each systemctl call, so a hung systemd cannot
+	// block a reconcile worker forever.
+	systemdTimeout time.Duration
+
+	// systemdHealthy is the outcome of the last RunSystemdProbe check; true
+	// until the first one
+	systemdHealthy atomic.Bool
+
+	// cgroupVersion is the hierarchy version detected at fsRoot (0 if
+	// unknown). EnsureSlice refuses to run on v1 unless requireV2 is false.
+	cgroupVersion int
+	requireV2     bool
+
+	// DryRun makes EnsureSlice and RemoveSlice log the changes they would
+	// make to the host (filesystem writes and systemctl calls) without applying them.
+	DryRun bool
+
+	// MemoryPressureLowThreshold and MemoryPressureMediumThreshold are the
+	// memory.pressure "some avg10" percentages at which GetMemoryPressureLevel
+	// reports the medium and critical levels.
+	MemoryPressureLowThreshold    float64
+	MemoryPressureMediumThreshold float64
+
+	// allowedAttributes are the cgroup files SetCgroupAttribute may write
+	allowedAttributes []string
+
+	// namespaceLocks serializes slice changes per namespace so that parallel
+	// workers never reconfigure the same slice concurrently. An entry is
+	// removed once no goroutine holds or waits for it, so namespaces whose
+	// quota is gone leave none behind.
+	namespaceLocksMu sync.Mutex
+	namespaceLocks   map[string]*namespaceLock
+
+	// waitForReady makes EnsureSlice wait until the kernel reports the limits
+	// set through systemd (see WaitForSliceReady)
+	waitForReady bool
+
+	// expectedLimits maps namespaces to the expectedSliceLimits of their
+	// last EnsureSlice
+	expectedLimits sync.Map
+}
+
+// expectedSliceLimits are the cpu.max quota and memory.max of a slice as
+// systemd writes them; zero values are not checked
+type expectedSliceLimits struct {
+	cpuQuota    int64
+	memoryBytes int64
+}
+
+// CgroupManagerOption customizes a CgroupManager created by NewCgroupManager
+type CgroupManagerOption func(*CgroupManager)
+
+// WithExecutor runs the nsenter systemctl calls with executor
+func WithExecutor(executor Executor) CgroupManagerOption {
+	return func(m *CgroupManager) {
+		m.systemd = SystemdNsenterExecutor{Executor: executor}
+	}
+}
+
+// WithSystemd replaces how slice properties are set, e.g. with
+// SystemdNoopExecutor on hosts without systemd
+func WithSystemd(systemd SystemdInterface) CgroupManagerOption {
+	return func(m *CgroupManager) {
+		m.systemd = systemd
+	}
+}
+
+// WithSystemdCallLimiter replaces the limiter that bounds the rate of systemctl calls
+func WithSystemdCallLimiter(limiter *SystemdCallLimiter) CgroupManagerOption {
+	return func(m *CgroupManager) {
+		m.limiter = limiter
+	}
+}
+
+// WithRequireCgroupV2 controls whether EnsureSlice fails on a cgroup v1 host
+// (the default) or applies limits in degraded mode
+func WithRequireCgroupV2(require bool) CgroupManagerOption {
+	return func(m *CgroupManager) {
+		m.requireV2 = require
+	}
+}
+
+// WithSystemdTimeout sets the maximum duration of a single systemctl call
+func WithSystemdTimeout(timeout time.Duration) CgroupManagerOption {
+	return func(m *CgroupManager) {
+		m.systemdTimeout = timeout
+	}
+}
+
+// WithWaitForSliceReady makes EnsureSlice return only once the slice's
+// cpu.max and memory.max reflect the new limits
+func WithWaitForSliceReady(wait bool) CgroupManagerOption {
+	return func(m *CgroupManager) {
+		m.waitForReady = wait
+	}
+}
+
+// WithAllowedCgroupAttributes sets the cgroup files that SetCgroupAttribute
+// may write, e.g. "memory.zswap.max". None are allowed by default.
+func WithAllowedCgroupAttributes(attributes []string) CgroupManagerOption {
+	return func(m *CgroupManager) {
+		m.allowedAttributes = attributes
+	}
+}
+
+// WithSlicePrefixOverrides places the slices of the given namespaces under
+// another parent slice than the default prefix (key=namespace, value=prefix)
+func WithSlicePrefixOverrides(overrides map[string]string) CgroupManagerOption {
+	return func(m *CgroupManager) {
+		m.slicePrefixOverrides = overrides
+	}
+}
+
+func NewCgroupManager(fsRoot, slicePrefix string, cpuPeriodUs int64, log *logrus.Logger, opts ...CgroupManagerOption) (*CgroupManager, error) {
+	if cpuPeriodUs < MinCPUPeriod || cpuPeriodUs > MaxCPUPeriod {
+		return nil, fmt.Errorf("CPU period must be between %d and %d us, got %d", MinCPUPeriod, MaxCPUPeriod, cpuPeriodUs)
+	}
+
+	m := &CgroupManager{
+		fsRoot:      fsRoot,
+		slicePrefix: slicePrefix,
+		cpuPeriodUs: cpuPeriodUs,
+		log:         log,
+		systemd:     SystemdNsenterExecutor{Executor: RealExecutor{}},
+		limiter:     NewSystemdCallLimiter(DefaultSystemdCallRate, DefaultSystemdCallBurst),
+		requireV2:   true,
+
+		systemdTimeout: DefaultSystemdTimeout,
+		namespaceLocks: make(map[string]*namespaceLock),
+
+		MemoryPressureLowThreshold:    DefaultMemoryPressureLowThreshold,
+		MemoryPressureMediumThreshold: DefaultMemoryPressureMediumThreshold,
+	}
+	m.systemdHealthy.Store(true)
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	version, err := DetectCgroupVersion(fsRoot)
+	if err != nil {
+		log.WithError(err).WithField("cgroup_root", fsRoot).Warn("Failed to detect cgroup version")
+	} else if version == 1 {
+		fields := logrus.Fields{"cgroup_root": fsRoot, "require_cgroup_v2": m.requireV2}
+		if m.requireV2 {
+			log.WithFields(fields).Error("cgroup v1 detected, limits will not be applied")
+		} else {
+			log.WithFields(fields).Warn("cgroup v1 detected, running in degraded mode")
+		}
+	}
+	m.cgroupVersion = version
+	return m, nil
+}
+
+// GetCgroupVersion returns the cgroup version detected at the cgroup root, or
+// 0 if it could not be determined
+func (m *CgroupManager) GetCgroupVersion() int {
+	return m.cgroupVersion
+}
+
+// DetectCgroupVersion reports whether root is a cgroup v2 (cgroup2fs) or v1
+// hierarchy, based on the filesystem type mounted there in /proc/mounts. If
+// root is not a mount point, as with a fake tree in tests, a cgroup v2 root
+// is recognized by its cgroup.controllers file.
+func DetectCgroupVersion(root string) (int, error) {
+	root = filepath.Clean(root)
+
+	content, err := os.ReadFile(procMountsPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", procMountsPath, err)
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || filepath.Clean(fields[1]) != root {
+			continue
+		}
+		switch fields[2] {
+		case "cgroup2":
+			return 2, nil
+		case "cgroup", "tmpfs":
+			// v1 mounts a tmpfs at the root with one cgroup mount per controller
+			return 1, nil
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		return 2, nil
+	}
+	if _, err := os.Stat(filepath.Join(root, "cpu")); err == nil {
+		return 1, nil
+	}
+	return 0, fmt.Errorf("no cgroup filesystem found at %s", root)
+}
+
+func (m *CgroupManager) CPUPeriod() int64 {
+	return m.cpuPeriodUs
+}
+
+// GetSlicePath returns the cgroup path using systemd nested slice format: parent-child.slice
+func (m *CgroupManager) GetSlicePath(namespace string) string {
+	return m.GetSlicePathForNamespace(namespace)
+}
+
+// GetSlicePathForNamespace returns the slice path of namespace under its
+// overridden prefix, if any, or under the default prefix
+func (m *CgroupManager) GetSlicePathForNamespace(namespace string) string {
+	return filepath.Join(m.fsRoot, m.slicePrefixFor(namespace), m.getSliceName(namespace))
+}
+
+func (m *CgroupManager) GetParentSlicePath() string {
+	return filepath.Join(m.fsRoot, m.slicePrefix)
+}
+
+func (m *CgroupManager) slicePrefixFor(namespace string) string {
+	if prefix, ok := m.slicePrefixOverrides[namespace]; ok {
+		return prefix
+	}
+	return m.slicePrefix
+}
+
+// namespaceLock is the mutex of a namespace with the number of goroutines
+// holding or waiting for it
+type namespaceLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func (m *CgroupManager) lockNamespace(namespace string) func() {
+	m.namespaceLocksMu.Lock()
+	lock, ok := m.namespaceLocks[namespace]
+	if !ok {
+		lock = &namespaceLock{}
+		m.namespaceLocks[namespace] = lock
+	}
+	lock.refs++
+	m.namespaceLocksMu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+
+		m.namespaceLocksMu.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(m.namespaceLocks, namespace)
+		}
+		m.namespaceLocksMu.Unlock()
+	}
+}
+
+// SliceLimits are the resource settings applied to a namespace slice. Zero
+// values leave the corresponding systemd property untouched.
+type SliceLimits struct {
+	CPU       string
+	CPUWeight int64
+	CPUSet    string
+	Memory    string
+	MemoryMin string
+	MemoryLow string
+
+	// MemoryHigh throttles the slice instead of OOM killing it like Memory
+	MemoryHigh string
+
+	// OOMGroup sets memory.oom.group when not nil
+	OOMGroup *bool
+
+	// CPUIdle sets cpu.idle when not nil
+	CPUIdle *bool
+
+	// HugepagesLimits maps hugepage sizes (e.g. "2Mi") to their limit, set
+	// with SetHugepagesLimit
+	HugepagesLimits map[string]string
+
+	// RawAttributes are written to the slice's cgroup files with
+	// SetCgroupAttribute
+	RawAttributes map[string]string
+}
+
+// EnsureSlice creates the namespace slice and applies its limits
+func (m *CgroupManager) EnsureSlice(ctx context.Context, namespace string, limits SliceLimits) (err error) {
+	cpuLimit, cpuWeight, cpuSet := limits.CPU, limits.CPUWeight, limits.CPUSet
+
+	_, span := startSpan(ctx, "CgroupManager.EnsureSlice",
+		attribute.String("namespace", namespace),
+		attribute.String("cpu", cpuLimit),
+		attribute.String("memory", limits.Memory),
+		attribute.Int64("cpu_weight", cpuWeight),
+		attribute.String("cpuset", cpuSet),
+		attribute.String("memory_min", limits.MemoryMin),
+		attribute.String("memory_low", limits.MemoryLow),
+		attribute.String("memory_high", limits.MemoryHigh),
+	)
+	defer func() { endSpan(span, err) }()
+
+	if m.cgroupVersion == 1 && m.requireV2 {
+		return fmt.Errorf("cgroup v2 required but cgroup v1 detected at %s", m.fsRoot)
+	}
+
+	defer m.lockNamespace(namespace)()
+
+	slicePath := m.GetSlicePath(namespace)
+	parentPath := filepath.Join(m.fsRoot, m.slicePrefixFor(namespace))
+
+	m.log.WithFields(logrus.Fields{
+		"namespace":    namespace,
+		"slice_path":   slicePath,
+		"cpu_limit":    cpuLimit,
+		"memory_limit": limits.Memory,
+		"memory_min":   limits.MemoryMin,
+		"memory_low":   limits.MemoryLow,
+		"memory_high":  limits.MemoryHigh,
+		"cpu_weight":   cpuWeight,
+		"cpuset":       cpuSet,
+	}).Debug("Ensuring cgroup slice")
+
+	memoryMax, err := parseOptionalMemory(limits.Memory)
+	if err != nil {
+		return fmt.Errorf("failed to parse memory limit for %s: %w", namespace, err)
+	}
+	memoryMin, err := parseOptionalMemory(limits.MemoryMin)
+	if err != nil {
+		return fmt.Errorf("failed to parse memory min for %s: %w", namespace, err)
+	}
+	memoryLow, err := parseOptionalMemory(limits.MemoryLow)
+	if err != nil {
+		return fmt.Errorf("failed to parse memory low for %s: %w", namespace, err)
+	}
+	memoryHigh, err := parseOptionalMemory(limits.MemoryHigh)
+	if err != nil {
+		return fmt.Errorf("failed to parse memory high for %s: %w", namespace, err)
+	}
+	if err := ValidateMemoryProtection(memoryMin, memoryLow, memoryMax); err != nil {
+		return fmt.Errorf("invalid memory protection for %s: %w", namespace, err)
+	}
+	if err := ValidateMemoryHigh(memoryHigh, memoryMax); err != nil {
+		return fmt.Errorf("invalid memory high for %s: %w", namespace, err)
+	}
+
+	if m.DryRun {
+		m.log.WithFields(logrus.Fields{
+			"parent_path": parentPath,
+			"slice_path":  slicePath,
+			"controllers": RequiredControllers,
+		}).Info("Dry run: would create slice directories and enable controllers")
+	} else {
+		if err := m.ensureParentSlice(parentPath); err != nil {
+			return fmt.Errorf("failed to ensure parent slice for %s: %w", namespace, err)
+		}
+
+		if err := os.MkdirAll(slicePath, 0755); err != nil {
+			return fmt.Errorf("failed to create slice directory for %s: %w", namespace, err)
+		}
+
+		if err := m.enableControllers(slicePath); err != nil {
+			m.log.WithError(err).Warn("Failed to enable controllers in namespace slice (may not have children)")
+		}
+
+		// Without its controllers the slice accepts no limits, so fail
+		// instead of reporting a slice that limits nothing.
+		if m.cgroupVersion != 1 {
+			if err := m.verifyControllers(slicePath); err != nil {
+				return fmt.Errorf("failed to verify controllers for %s: %w", namespace, err)
+			}
+		}
+	}
+
+	if limits.OOMGroup != nil {
+		if m.DryRun {
+			m.log.WithFields(logrus.Fields{
+				"slice_path": slicePath,
+				"oom_group":  *limits.OOMGroup,
+			}).Info("Dry run: would set memory.oom.group")
+		} else if err := m.setOOMGroup(slicePath, *limits.OOMGroup); err != nil {
+			return fmt.Errorf("failed to set OOM group for %s: %w", namespace, err)
+		}
+	}
+
+	if len(limits.HugepagesLimits) > 0 && !m.DryRun {
+		if err := enableHugetlb(parentPath); err != nil {
+			m.log.WithError(err).Warn("Failed to enable hugetlb controller in parent slice")
+		}
+	}
+	for _, size := range slices.Sorted(maps.Keys(limits.HugepagesLimits)) {
+		bytes, err := ParseMemory(limits.HugepagesLimits[size])
+		if err != nil {
+			return fmt.Errorf("failed to parse %s hugepages limit for %s: %w", size, namespace, err)
+		}
+		if m.DryRun {
+			m.log.WithFields(logrus.Fields{
+				"slice_path": slicePath,
+				"size":       size,
+				"limit":      bytes,
+			}).Info("Dry run: would set hugepages limit")
+		} else if err := m.SetHugepagesLimit(namespace, size, bytes); err != nil {
+			return err
+		}
+	}
+
+	for _, attribute := range slices.Sorted(maps.Keys(limits.RawAttributes)) {
+		value := limits.RawAttributes[attribute]
+		if m.DryRun {
+			if err := m.checkAttribute(attribute); err != nil {
+				return err
+			}
+			m.log.WithFields(logrus.Fields{
+				"slice_path": slicePath,
+				"attribute":  attribute,
+				"value":      value,
+			}).Info("Dry run: would set cgroup attribute")
+		} else if err := m.SetCgroupAttribute(namespace, attribute, value); err != nil {
+			return err
+		}
+	}
+
+	// Collected into a single systemctl call, so the limits never apply
+	// partially
+	properties := map[string]string{}
+	var expected expectedSliceLimits
+
+	// Also logged once the slice is configured, so CPU is parsed only here
+	var cpuQuota int64
+	if cpuLimit != "" {
+		cpuQuota, err = ParseCPU(cpuLimit, m.cpuPeriodUs)
+		if err != nil {
+			return fmt.Errorf("failed to parse CPU limit for %s: %w", namespace, err)
+		}
+		properties["CPUQuota"] = fmt.Sprintf("%d%%", (cpuQuota*100)/m.cpuPeriodUs)
+		// systemd applies CPUQuota as a whole percentage of the period
+		expected.cpuQuota = (cpuQuota * 100 / m.cpuPeriodUs) * m.cpuPeriodUs / 100
+		// Only pass the period when it differs from the kernel default, so
+		// older systemd versions without CPUQuotaPeriodSec keep working.
+		if m.cpuPeriodUs != DefaultCPUPeriod {
+			properties["CPUQuotaPeriodSec"] = fmt.Sprintf("%dus", m.cpuPeriodUs)
+		}
+	}
+
+	// Before the weight: leaving idle mode resets CPUWeight, which the
+	// weight then overrides
+	if limits.CPUIdle != nil {
+		properties["CPUWeight"] = cpuIdleWeight(*limits.CPUIdle)
+	}
+	if cpuWeight != 0 {
+		properties["CPUWeight"] = strconv.FormatInt(cpuWeight, 10)
+	}
+
+	if cpuSet != "" {
+		if err := ParseCPUSet(cpuSet); err != nil {
+			return fmt.Errorf("failed to parse cpuset for %s: %w", namespace, err)
+		}
+		properties["AllowedCPUs"] = cpuSet
+	}
+
+	if limits.Memory != "" {
+		properties["MemoryMax"] = formatMemoryForSystemd(memoryMax)
+		expected.memoryBytes = memoryMax
+	}
+	if limits.MemoryMin != "" {
+		properties["MemoryMin"] = formatMemoryForSystemd(memoryMin)
+	}
+	if limits.MemoryLow != "" {
+		properties["MemoryLow"] = formatMemoryForSystemd(memoryLow)
+	}
+	if limits.MemoryHigh != "" {
+		properties["MemoryHigh"] = formatMemoryForSystemd(memoryHigh)
+	}
+
+	if len(properties) > 0 {
+		if err := m.setAllLimitsViaSystemd(ctx, namespace, properties); err != nil {
+			return fmt.Errorf("failed to set limits for %s: %w", namespace, err)
+		}
+	}
+
+	if cpuSet != "" && !m.DryRun {
+		if err := m.verifyCPUSet(slicePath, cpuSet); err != nil {
+			return fmt.Errorf("failed to verify cpuset for %s: %w", namespace, err)
+		}
+	}
+
+	m.expectedLimits.Store(namespace, expected)
+	if m.waitForReady && !m.DryRun && m.cgroupVersion != 1 {
+		if err := m.WaitForSliceReady(ctx, namespace); err != nil {
+			return err
+		}
+	}
+
+	m.log.WithFields(logrus.Fields{
+		"namespace":  namespace,
+		"slice_path": slicePath,
+		"cpu":        FormatCPUForDisplay(cpuQuota, m.cpuPeriodUs),
+		"memory":     FormatMemoryForDisplay(memoryMax),
+	}).Info("Cgroup slice configured successfully")
+
+	return nil
+}
+
+// WaitForSliceReady polls the slice until its cpu.max and memory.max match
+// the limits of the last EnsureSlice, as systemd applies them asynchronously.
+// It gives up after sliceReadyAttempts reads.
+func (m *CgroupManager) WaitForSliceReady(ctx context.Context, namespace string) error {
+	value, ok := m.expectedLimits.Load(namespace)
+	if !ok {
+		return nil
+	}
+	expected := value.(expectedSliceLimits)
+
+	var cpuQuota, memoryBytes int64
+	for attempt := 1; ; attempt++ {
+		var err error
+		cpuQuota, memoryBytes, _, _, err = m.GetCurrentLimits(namespace)
+		if err != nil {
+			return fmt.Errorf("failed to read limits of %s: %w", namespace, err)
+		}
+		// Same tolerances as the drift check: systemd may round the quota
+		// and the kernel rounds memory.max down to a page
+		cpuReady := expected.cpuQuota == 0 || absDiff(cpuQuota, expected.cpuQuota) <= m.cpuPeriodUs/100
+		memoryReady := expected.memoryBytes == 0 || absDiff(memoryBytes, expected.memoryBytes) < int64(os.Getpagesize())
+		if cpuReady && memoryReady {
+			return nil
+		}
+		if attempt == sliceReadyAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to wait for slice of %s to be ready: %w", namespace, ctx.Err())
+		case <-time.After(sliceReadyPollInterval):
+		}
+	}
+
+	return fmt.Errorf("slice of %s not ready after %d checks: cpu.max quota %d (expected %d), memory.max %d (expected %d)",
+		namespace, sliceReadyAttempts, cpuQuota, expected.cpuQuota, memoryBytes, expected.memoryBytes)
+}
+
+func (m *CgroupManager) RemoveSlice(namespace string) error {
+	defer m.lockNamespace(namespace)()
+	m.expectedLimits.Delete(namespace)
+
+	slicePath := m.GetSlicePath(namespace)
+
+	m.log.WithFields(logrus.Fields{
+		"namespace":  namespace,
+		"slice_path": slicePath,
+	}).Debug("Removing cgroup slice")
+
+	if _, err := os.Stat(slicePath); os.IsNotExist(err) {
+		m.log.WithField("namespace", namespace).Debug("Slice does not exist, nothing to remove")
+		return nil
+	}
+
+	if m.DryRun {
+		m.log.WithFields(logrus.Fields{
+			"namespace":  namespace,
+			"slice_path": slicePath,
+		}).Info("Dry run: would remove cgroup slice")
+		return nil
+	}
+
+	if err := os.Remove(slicePath); err != nil {
+		return fmt.Errorf("failed to remove slice for %s: %w", namespace, err)
+	}
+
+	m.log.WithField("namespace", namespace).Info("Cgroup slice removed")
+	return nil
+}
+
+// RenameCgroupSlice moves the processes of the slice of oldNamespace to the
+// slice of newNamespace and removes the old slice. The new slice only gets
+// its limits on the next EnsureSlice.
+func (m *CgroupManager) RenameCgroupSlice(oldNamespace, newNamespace string) error {
+	// Locked in a fixed order so concurrent renames cannot deadlock
+	first, second := oldNamespace, newNamespace
+	if second < first {
+		first, second = second, first
+	}
+	defer m.lockNamespace(first)()
+	defer m.lockNamespace(second)()
+
+	src, dst := m.GetSlicePath(oldNamespace), m.GetSlicePath(newNamespace)
+	log := m.log.WithFields(logrus.Fields{
+		"old_namespace": oldNamespace,
+		"new_namespace": newNamespace,
+	})
+
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		log.Debug("Old slice does not exist, nothing to rename")
+		return nil
+	}
+
+	if m.DryRun {
+		log.WithFields(logrus.Fields{
+			"src": src,
+			"dst": dst,
+		}).Info("Dry run: would migrate processes and remove old cgroup slice")
+		return nil
+	}
+
+	if err := m.MigrateExistingProcesses(src, dst); err != nil {
+		return fmt.Errorf("failed to rename slice %s to %s: %w", oldNamespace, newNamespace, err)
+	}
+	m.expectedLimits.Delete(oldNamespace)
+
+	log.Info("Cgroup slice renamed")
+	return nil
+}
+
+// MigrateExistingProcesses moves every process in the cgroup tree at src to
+// the cgroup at the same relative path under dst, creating it if needed, then
+// removes src. Whole processes are moved through cgroup.procs: a thread can
+// only be written to cgroup.threads within its own threaded subtree, which
+// src and dst never share.
+func (m *CgroupManager) MigrateExistingProcesses(src, dst string) error {
+	var dirs []string
+	err := filepath.WalkDir(src, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk %s: %w", src, err)
+	}
+
+	migrated := 0
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(src, dir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", dir, err)
+		}
+		target := filepath.Join(dst, rel)
+
+		content, err := os.ReadFile(filepath.Join(dir, "cgroup.procs"))
+		if err != nil {
+			return fmt.Errorf("failed to read processes of %s: %w", dir, err)
+		}
+		pids := strings.Fields(string(content))
+		if len(pids) == 0 {
+			continue
+		}
+
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", target, err)
+		}
+		for _, pid := range pids {
+			err := os.WriteFile(filepath.Join(target, "cgroup.procs"), []byte(pid), 0644)
+			// The process may have exited since cgroup.procs was read
+			if err != nil && !errors.Is(err, syscall.ESRCH) {
+				return fmt.Errorf("failed to move process %s to %s: %w", pid, target, err)
+			}
+		}
+		migrated += len(pids)
+	}
+
+	// Children before parents, as only empty cgroups can be removed
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Remove(dirs[i]); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", dirs[i], err)
+		}
+	}
+
+	m.log.WithFields(logrus.Fields{
+		"src":       src,
+		"dst":       dst,
+		"processes": migrated,
+	}).Info("Migrated processes between cgroups")
+	return nil
+}
+
+func (m *CgroupManager) GetCgroupStats(namespace string) (*CgroupStats, error) {
+	slicePath := m.GetSlicePath(namespace)
+
+	if _, err := os.Stat(slicePath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("slice does not exist for %s: %w", namespace, err)
+	}
+
+	stats := &CgroupStats{}
+
+	cpuUsage, nrPeriods, nrThrottled, err := m.readCPUStat(slicePath)
+	if err != nil {
+		m.log.WithError(err).WithField("namespace", namespace).Debug("Failed to read cpu.stat")
+	} else {
+		stats.CPUUsageUsec = cpuUsage
+		stats.setThrottling(nrPeriods, nrThrottled)
+	}
+
+	memUsage, err := m.readMemoryCurrent(slicePath)
+	if err != nil {
+		m.log.WithError(err).WithField("namespace", namespace).Debug("Failed to read memory.current")
+	} else {
+		stats.MemoryUsageBytes = memUsage
+	}
+
+	oomKills, err := m.readMemoryEvents(slicePath)
+	if err != nil {
+		m.log.WithError(err).WithField("namespace", namespace).Debug("Failed to read memory.events")
+	} else {
+		stats.OOMKills = oomKills
+	}
+
+	cpuWeight, err := readCPUWeight(slicePath)
+	if err != nil {
+		m.log.WithError(err).WithField("namespace", namespace).Debug("Failed to read cpu.weight")
+	} else {
+		stats.CPUWeight = cpuWeight
+	}
+
+	stats.MemoryMinBytes, stats.MemoryLowBytes = readMemoryProtection(slicePath)
+	stats.MemoryHighBytes = readMemoryHigh(slicePath)
+	stats.OOMGroup = readOOMGroup(slicePath)
+	stats.HugepagesUsageBytes = readHugepagesUsage(slicePath)
+	stats.CPUIdle = readCPUIdle(slicePath)
+	stats.PidsMax = readPidsMax(slicePath)
+
+	pidsCurrent, err := readPidsCurrent(slicePath)
+	if err != nil {
+		m.log.WithError(err).WithField("namespace", namespace).Debug("Failed to read pids.current")
+	} else {
+		stats.PidsCurrent = pidsCurrent
+	}
+
+	cpuSet, err := readCPUSetEffective(slicePath)
+	if err != nil {
+		m.log.WithError(err).WithField("namespace", namespace).Debug("Failed to read cpuset.cpus.effective")
+	} else {
+		stats.CPUSetEffective = cpuSet
+	}
+
+	m.readPressureStats(slicePath, stats)
+
+	return stats, nil
+}
+
+func (m *CgroupManager) SliceExists(namespace string) bool {
+	slicePath := m.GetSlicePath(namespace)
+	_, err := os.Stat(slicePath)
+	return err == nil
+}
+
+// GetCurrentLimits reads the applied limits of the slice. Unlimited values
+// ("max") are reported as 0.
+func (m *CgroupManager) GetCurrentLimits(namespace string) (cpuQuota, memoryBytes, memoryHigh, cpuWeight int64, err error) {
+	slicePath := m.GetSlicePath(namespace)
+
+	cpuMaxPath := filepath.Join(slicePath, "cpu.max")
+	cpuContent, err := os.ReadFile(cpuMaxPath)
+	if err == nil {
+		parts := strings.Fields(string(cpuContent))
+		if len(parts) >= 1 && parts[0] != "max" {
+			cpuQuota, _ = strconv.ParseInt(parts[0], 10, 64)
+		}
+	}
+
+	memoryMaxPath := filepath.Join(slicePath, "memory.max")
+	memoryContent, err := os.ReadFile(memoryMaxPath)
+	if err == nil {
+		memStr := strings.TrimSpace(string(memoryContent))
+		if memStr != "max" {
+			memoryBytes, _ = strconv.ParseInt(memStr, 10, 64)
+		}
+	}
+
+	memoryHigh = readMemoryHigh(slicePath)
+	cpuWeight, _ = readCPUWeight(slicePath)
+
+	return cpuQuota, memoryBytes, memoryHigh, cpuWeight, nil
+}
+
+// parseOptionalMemory parses a memory quantity, returning 0 for an empty value
+func parseOptionalMemory(memory string) (int64, error) {
+	if strings.TrimSpace(memory) == "" {
+		return 0, nil
+	}
+	q, err := resource.ParseQuantity(strings.TrimSpace(memory))
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory format: %s", memory)
+	}
+	return ParseMemoryQuantity(q)
+}
+
+// ValidateMemoryProtection checks that memoryMin <= memoryLow <= memoryMax,
+// ignoring any value that is zero (unset).
+func ValidateMemoryProtection(memoryMin, memoryLow, memoryMax int64) error {
+	if memoryMin > 0 && memoryLow > 0 && memoryMin > memoryLow {
+		return fmt.Errorf("memoryMin (%d) must not exceed memoryLow (%d)", memoryMin, memoryLow)
+	}
+	if memoryMax > 0 {
+		if memoryLow > memoryMax {
+			return fmt.Errorf("memoryLow (%d) must not exceed memory (%d)", memoryLow, memoryMax)
+		}
+		if memoryMin > memoryMax {
+			return fmt.Errorf("memoryMin (%d) must not exceed memory (%d)", memoryMin, memoryMax)
+		}
+	}
+	return nil
+}
+
+// ValidateMemoryHigh checks that memoryHigh is below memoryMax, ignoring
+// either value when zero (unset). A memory.high at or above memory.max would
+// never throttle, as the OOM killer fires first.
+func ValidateMemoryHigh(memoryHigh, memoryMax int64) error {
+	if memoryHigh > 0 && memoryMax > 0 && memoryHigh >= memoryMax {
+		return fmt.Errorf("memoryHigh (%d) must be less than memory (%d)", memoryHigh, memoryMax)
+	}
+	return nil
+}
+
+// ParseCPUSet validates a Linux cpuset list such as "0-3,8-11"
+func ParseCPUSet(cpuSet string) error {
+	if !cpuSetPattern.MatchString(cpuSet) {
+		return fmt.Errorf("invalid cpuset format: %s", cpuSet)
+	}
+
+	for _, cpuRange := range strings.Split(cpuSet, ",") {
+		bounds := strings.SplitN(cpuRange, "-", 2)
+		if len(bounds) == 2 {
+			first, _ := strconv.Atoi(bounds[0])
+			last, _ := strconv.Atoi(bounds[1])
+			if first > last {
+				return fmt.Errorf("invalid cpuset range %s: start is greater than end", cpuRange)
+			}
+		}
+	}
+
+	return nil
+}
+
+// expandCPUSet returns the CPUs of a valid cpuset list in ascending order
+func expandCPUSet(cpuSet string) []int {
+	var cpus []int
+	for _, cpuRange := range strings.Split(cpuSet, ",") {
+		bounds := strings.SplitN(cpuRange, "-", 2)
+		first, _ := strconv.Atoi(bounds[0])
+		last := first
+		if len(bounds) == 2 {
+			last, _ = strconv.Atoi(bounds[1])
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	slices.Sort(cpus)
+	return slices.Compact(cpus)
+}
+
+// verifyCPUSet checks that the kernel applied the requested CPUs. The
+// effective set can differ when the requested CPUs are offline or not
+// available to the parent slice.
+func (m *CgroupManager) verifyCPUSet(slicePath, cpuSet string) error {
+	effective, err := readCPUSetEffective(slicePath)
+	if err != nil {
+		return err
+	}
+	if effective == "" || !slices.Equal(expandCPUSet(effective), expandCPUSet(cpuSet)) {
+		return fmt.Errorf("effective cpuset %q does not match requested %q", effective, cpuSet)
+	}
+	return nil
+}
+
+// setOOMGroup writes memory.oom.group of the slice. systemd has no property
+// for it, so unlike the limits it is written to the cgroup file directly.
+func (m *CgroupManager) setOOMGroup(slicePath string, enable bool) error {
+	value := "0"
+	if enable {
+		value = "1"
+	}
+	if err := os.WriteFile(filepath.Join(slicePath, "memory.oom.group"), []byte(value), 0644); err != nil {
+		return fmt.Errorf("failed to write memory.oom.group: %w", err)
+	}
+
+	m.log.WithFields(logrus.Fields{
+		"slice_path": slicePath,
+		"oom_group":  enable,
+	}).Info("OOM group set")
+	return nil
+}
+
+// SetCgroupAttribute writes value to the cgroup file attribute of the
+// namespace slice, bypassing systemd. attribute must be allowed with
+// WithAllowedCgroupAttributes.
+func (m *CgroupManager) SetCgroupAttribute(namespace, attribute, value string) error {
+	if err := m.checkAttribute(attribute); err != nil {
+		return err
+	}
+
+	slicePath := m.GetSlicePath(namespace)
+	if err := os.WriteFile(filepath.Join(slicePath, attribute), []byte(value), 0644); err != nil {
+		return fmt.Errorf("failed to write %s for %s: %w", attribute, namespace, err)
+	}
+
+	m.log.WithFields(logrus.Fields{
+		"slice_path": slicePath,
+		"attribute":  attribute,
+		"value":      value,
+	}).Info("Cgroup attribute set")
+	return nil
+}
+
+// GetCgroupAttribute reads the cgroup file attribute of the namespace slice,
+// without its trailing newline
+func (m *CgroupManager) GetCgroupAttribute(namespace, attribute string) (string, error) {
+	if err := m.checkAttribute(attribute); err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(filepath.Join(m.GetSlicePath(namespace), attribute))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s for %s: %w", attribute, namespace, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// checkAttribute rejects cgroup files outside the allowlist. Names with a
+// path separator never match, so no file outside the slice can be reached.
+func (m *CgroupManager) checkAttribute(attribute string) error {
+	if !slices.Contains(m.allowedAttributes, attribute) || strings.ContainsRune(attribute, filepath.Separator) {
+		return fmt.Errorf("cgroup attribute %q is not allowed (see --allowed-cgroup-attributes)", attribute)
+	}
+	return nil
+}
+
+// GetCurrentOOMGroup reports whether memory.oom.group is enabled on the slice
+func (m *CgroupManager) GetCurrentOOMGroup(namespace string) bool {
+	return readOOMGroup(m.GetSlicePath(namespace))
+}
+
+// readOOMGroup reads memory.oom.group, reporting false if it is missing
+func readOOMGroup(slicePath string) bool {
+	content, err := os.ReadFile(filepath.Join(slicePath, "memory.oom.group"))
+	return err == nil && strings.TrimSpace(string(content)) == "1"
+}
+
+// GetCurrentCPUIdle reports whether cpu.idle is enabled on the slice
+func (m *CgroupManager) GetCurrentCPUIdle(namespace string) bool {
+	return readCPUIdle(m.GetSlicePath(namespace))
+}
+
+// readCPUIdle reads cpu.idle, reporting false if it is missing
+func readCPUIdle(slicePath string) bool {
+	content, err := os.ReadFile(filepath.Join(slicePath, "cpu.idle"))
+	return err == nil && strings.TrimSpace(string(content)) == "1"
+}
+
+// GetPidCount returns the number of processes and threads in the namespace
+// slice (pids.current)
+func (m *CgroupManager) GetPidCount(namespace string) (int64, error) {
+	return readPidsCurrent(m.GetSlicePath(namespace))
+}
+
+func readPidsCurrent(slicePath string) (int64, error) {
+	content, err := os.ReadFile(filepath.Join(slicePath, "pids.current"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read pids.current: %w", err)
+	}
+	pids, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse pids.current: %w", err)
+	}
+	return pids, nil
+}
+
+// readPidsMax reads pids.max, reporting 0 if it is "max", missing or unparsable
+func readPidsMax(slicePath string) int64 {
+	content, err := os.ReadFile(filepath.Join(slicePath, "pids.max"))
+	if err != nil {
+		return 0
+	}
+	pidsMax, _ := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	return pidsMax
+}
+
+// GetCurrentMemoryProtection returns the memory.min and memory.low of the slice
+func (m *CgroupManager) GetCurrentMemoryProtection(namespace string) (memoryMin, memoryLow int64) {
+	return readMemoryProtection(m.GetSlicePath(namespace))
+}
+
+// readMemoryProtection reads memory.min and memory.low, reporting 0 for
+// files that are missing or unparsable
+func readMemoryProtection(slicePath string) (memoryMin, memoryLow int64) {
+	if content, err := os.ReadFile(filepath.Join(slicePath, "memory.min")); err == nil {
+		memoryMin, _ = strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	}
+	if content, err := os.ReadFile(filepath.Join(slicePath, "memory.low")); err == nil {
+		memoryLow, _ = strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	}
+	return memoryMin, memoryLow
+}
+
+// readMemoryHigh reads memory.high, reporting 0 when it is "max" or unreadable
+func readMemoryHigh(slicePath string) int64 {
+	content, err := os.ReadFile(filepath.Join(slicePath, "memory.high"))
+	if err != nil {
+		return 0
+	}
+	memoryHigh, _ := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	return memoryHigh
+}
+
+// GetCurrentCPUSet returns the effective cpuset of the namespace slice
+func (m *CgroupManager) GetCurrentCPUSet(namespace string) (string, error) {
+	return readCPUSetEffective(m.GetSlicePath(namespace))
+}
+
+func readCPUSetEffective(slicePath string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(slicePath, "cpuset.cpus.effective"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read cpuset.cpus.effective: %w", err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+func readCPUWeight(slicePath string) (int64, error) {
+	content, err := os.ReadFile(filepath.Join(slicePath, "cpu.weight"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cpu.weight: %w", err)
+	}
+	weight, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse cpu.weight: %w", err)
+	}
+	return weight, nil
+}
+
+// ParseCPU converts a CPU quantity (e.g. "2", "1.5", "500m") to a quota in
+// microseconds per period
+func ParseCPU(cpu string, periodUs int64) (int64, error) {
+	cpu = strings.TrimSpace(cpu)
+	if cpu == "" {
+		return 0, fmt.Errorf("empty CPU value")
+	}
+
+	q, err := resource.ParseQuantity(cpu)
+	if err != nil {
+		return 0, fmt.Errorf("invalid CPU value '%s': %w", cpu, err)
+	}
+
+	return ParseCPUQuantity(q, periodUs)
+}
+
+// ParseCPUQuantity converts a CPU quantity to a quota in microseconds per period
+func ParseCPUQuantity(q resource.Quantity, periodUs int64) (int64, error) {
+	if q.Sign() <= 0 {
+		return 0, fmt.Errorf("CPU value must be positive: %s", q.String())
+	}
+	// MilliValue saturates and the multiplication below wraps around for
+	// huge values, which used to surface as a misleading "too small" error
+	if periodUs <= 0 || q.Cmp(*resource.NewMilliQuantity(math.MaxInt64/periodUs, resource.DecimalSI)) > 0 {
+		return 0, fmt.Errorf("CPU value too large for a %dus period: %s", periodUs, q.String())
+	}
+
+	// systemd sets CPUQuota in whole percent of the period, so anything
+	// below 1% would become CPUQuota=0%
+	quota := q.MilliValue() * periodUs / 1000
+	if quota*100 < periodUs {
+		return 0, fmt.Errorf("CPU value too small for a %dus period, minimum is 1%% of a CPU (10m): %s", periodUs, q.String())
+	}
+
+	return quota, nil
+}
+
+// ParseMemory converts a memory quantity (e.g. "512Mi", "1.5Gi", "1G") to bytes.
+// Suffixes are case-sensitive Kubernetes suffixes: k, M, G, T are decimal,
+// Ki, Mi, Gi, Ti binary, and m is milli, so "512m" is one byte after
+// rounding up, not 512 MiB.
+func ParseMemory(memory string) (int64, error) {
+	memory = strings.TrimSpace(memory)
+	if memory == "" {
+		return 0, fmt.Errorf("empty memory value")
+	}
+
+	q, err := resource.ParseQuantity(memory)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory format: %s", memory)
+	}
+
+	return ParseMemoryQuantity(q)
+}
+
+// ParseMemoryQuantity converts a memory quantity to bytes
+func ParseMemoryQuantity(q resource.Quantity) (int64, error) {
+	if q.Sign() < 0 {
+		return 0, fmt.Errorf("memory value must be non-negative: %s", q.String())
+	}
+	// Value saturates or returns 0 (unlimited) past int64, and ParseQuantity
+	// already saturates binary quantities such as "10Ei" to MaxInt64
+	if q.Cmp(*resource.NewQuantity(math.MaxInt64, resource.BinarySI)) >= 0 {
+		return 0, fmt.Errorf("memory value too large: %s", q.String())
+	}
+
+	return q.Value(), nil
+}
+
+func (m *CgroupManager) ensureParentSlice(parentPath string) error {
+	if err := os.MkdirAll(parentPath, 0755); err != nil {
+		return fmt.Errorf("failed to create parent slice %s: %w", parentPath, err)
+	}
+	return m.enableControllers(parentPath)
+}
+
+// ReadCgroupV2Controllers returns the controllers available in the cgroup at
+// slicePath, which are those enabled in its parent's cgroup.subtree_control
+func (m *CgroupManager) ReadCgroupV2Controllers(slicePath string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(slicePath, "cgroup.controllers"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cgroup.controllers: %w", err)
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// verifyControllers checks that every controller in RequiredControllers is
+// available in the slice
+func (m *CgroupManager) verifyControllers(slicePath string) error {
+	controllers, err := m.ReadCgroupV2Controllers(slicePath)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, required := range strings.Fields(RequiredControllers) {
+		name := strings.TrimPrefix(required, "+")
+		if !slices.Contains(controllers, name) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("controllers %s not available in %s (missing from cgroup.subtree_control of a parent cgroup)",
+			strings.Join(missing, ", "), slicePath)
+	}
+	return nil
+}
+
+func (m *CgroupManager) enableControllers(path string) error {
+	subtreeControl := filepath.Join(path, "cgroup.subtree_control")
+	if err := os.WriteFile(subtreeControl, []byte(RequiredControllers), 0644); err != nil {
+		return fmt.Errorf("failed to enable controllers in %s: %w", path, err)
+	}
+	return nil
 }
 
-func NewCgroupManager(cgroupRoot, slicePrefix string, log *logrus.Logger) *CgroupManager {
-	return &CgroupManager{
-		cgroupRoot:  cgroupRoot,
-		slicePrefix: slicePrefix,
-		log:         log,
+// ReadSubtreeControl returns the controllers enabled for the children of the
+// cgroup at path
+func (m *CgroupManager) ReadSubtreeControl(path string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(path, "cgroup.subtree_control"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cgroup.subtree_control: %w", err)
 	}
+	return strings.Fields(string(data)), nil
 }
 
-// GetSlicePath returns the cgroup path using systemd nested slice format: parent-child.slice
-func (m *CgroupManager) GetSlicePath(namespace string) string {
-	prefix := strings.TrimSuffix(m.slicePrefix, ".slice")
-	sliceName := fmt.Sprintf("%s-%s.slice", prefix, namespace)
-	return filepath.Join(m.cgroupRoot, m.slicePrefix, sliceName)
+// DiagnosticCheck is the outcome of one check of a SliceDiagnostic
+type DiagnosticCheck struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
 }
 
-func (m *CgroupManager) GetParentSlicePath() string {
-	return filepath.Join(m.cgroupRoot, m.slicePrefix)
+// SliceDiagnostic reports why the slice of a namespace may not enforce its
+// limits. Checks stop at the first missing cgroup.
+type SliceDiagnostic struct {
+	Namespace  string            `json:"namespace"`
+	ParentPath string            `json:"parentPath"`
+	SlicePath  string            `json:"slicePath"`
+	Healthy    bool              `json:"healthy"`
+	Checks     []DiagnosticCheck `json:"checks"`
 }
 
-func (m *CgroupManager) EnsureSlice(namespace string, cpuLimit string, memoryLimit string) error {
-	slicePath := m.GetSlicePath(namespace)
-	parentPath := m.GetParentSlicePath()
-
-	m.log.WithFields(logrus.Fields{
-		"namespace":    namespace,
-		"slice_path":   slicePath,
-		"cpu_limit":    cpuLimit,
-		"memory_limit": memoryLimit,
-	}).Debug("Ensuring cgroup slice")
-
-	if err := m.ensureParentSlice(parentPath); err != nil {
-		return fmt.Errorf("failed to ensure parent slice for %s: %w", namespace, err)
+func (d *SliceDiagnostic) add(name string, err error, message string) bool {
+	check := DiagnosticCheck{Name: name, OK: err == nil, Message: message}
+	if err != nil {
+		check.Message = err.Error()
+		d.Healthy = false
 	}
+	d.Checks = append(d.Checks, check)
+	return err == nil
+}
 
-	if err := os.MkdirAll(slicePath, 0755); err != nil {
-		return fmt.Errorf("failed to create slice directory for %s: %w", namespace, err)
+// DiagnoseSlice checks the cgroup hierarchy of a namespace slice: that the
+// parent and namespace slices exist with the required controllers, and that
+// cpu.max and memory.max hold valid limits. The limits are not compared with
+// the NamespaceQuota.
+func (m *CgroupManager) DiagnoseSlice(namespace string) (*SliceDiagnostic, error) {
+	if m.cgroupVersion == 1 {
+		return nil, fmt.Errorf("slice diagnostics require cgroup v2")
 	}
 
-	if err := m.enableControllers(slicePath); err != nil {
-		m.log.WithError(err).Warn("Failed to enable controllers in namespace slice (may not have children)")
+	parentPath := filepath.Join(m.fsRoot, m.slicePrefixFor(namespace))
+	slicePath := m.GetSlicePath(namespace)
+	d := &SliceDiagnostic{
+		Namespace:  namespace,
+		ParentPath: parentPath,
+		SlicePath:  slicePath,
+		Healthy:    true,
 	}
 
-	if cpuLimit != "" {
-		cpuQuota, err := ParseCPU(cpuLimit)
-		if err != nil {
-			return fmt.Errorf("failed to parse CPU limit for %s: %w", namespace, err)
-		}
-		if err := m.setCPULimitViaSystemd(namespace, cpuQuota); err != nil {
-			return fmt.Errorf("failed to set CPU limit for %s: %w", namespace, err)
-		}
+	if !d.add("parent_slice_exists", checkDirExists(parentPath), parentPath) {
+		return d, nil
 	}
-
-	if memoryLimit != "" {
-		memoryBytes, err := ParseMemory(memoryLimit)
-		if err != nil {
-			return fmt.Errorf("failed to parse memory limit for %s: %w", namespace, err)
-		}
-		if err := m.setMemoryLimitViaSystemd(namespace, memoryBytes); err != nil {
-			return fmt.Errorf("failed to set memory limit for %s: %w", namespace, err)
-		}
+	if !d.add("parent_controllers", m.checkSubtreeControl(parentPath), RequiredControllers) {
+		return d, nil
 	}
+	if !d.add("slice_exists", checkDirExists(slicePath), slicePath) {
+		return d, nil
+	}
+	d.add("slice_controllers", m.verifyControllers(slicePath), RequiredControllers)
 
-	m.log.WithFields(logrus.Fields{
-		"namespace":  namespace,
-		"slice_path": slicePath,
-	}).Info("Cgroup slice configured successfully")
+	cpuMax, err := m.checkCPUMax(slicePath)
+	d.add("cpu_max", err, cpuMax)
+	memoryMax, err := checkMemoryMax(slicePath)
+	d.add("memory_max", err, memoryMax)
 
-	return nil
+	return d, nil
 }
 
-func (m *CgroupManager) RemoveSlice(namespace string) error {
-	slicePath := m.GetSlicePath(namespace)
-
-	m.log.WithFields(logrus.Fields{
-		"namespace":  namespace,
-		"slice_path": slicePath,
-	}).Debug("Removing cgroup slice")
-
-	if _, err := os.Stat(slicePath); os.IsNotExist(err) {
-		m.log.WithField("namespace", namespace).Debug("Slice does not exist, nothing to remove")
-		return nil
+func checkDirExists(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
 	}
-
-	if err := os.Remove(slicePath); err != nil {
-		return fmt.Errorf("failed to remove slice for %s: %w", namespace, err)
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
 	}
-
-	m.log.WithField("namespace", namespace).Info("Cgroup slice removed")
 	return nil
 }
 
-func (m *CgroupManager) GetCgroupStats(namespace string) (*CgroupStats, error) {
-	slicePath := m.GetSlicePath(namespace)
-
-	if _, err := os.Stat(slicePath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("slice does not exist for %s: %w", namespace, err)
+// checkSubtreeControl checks that every controller in RequiredControllers is
+// enabled for the children of path
+func (m *CgroupManager) checkSubtreeControl(path string) error {
+	enabled, err := m.ReadSubtreeControl(path)
+	if err != nil {
+		return err
 	}
 
-	stats := &CgroupStats{}
-
-	cpuUsage, cpuThrottled, err := m.readCPUStat(slicePath)
-	if err != nil {
-		m.log.WithError(err).WithField("namespace", namespace).Debug("Failed to read cpu.stat")
-	} else {
-		stats.CPUUsageUsec = cpuUsage
-		stats.CPUThrottled = cpuThrottled
+	var missing []string
+	for _, required := range strings.Fields(RequiredControllers) {
+		name := strings.TrimPrefix(required, "+")
+		if !slices.Contains(enabled, name) {
+			missing = append(missing, name)
+		}
 	}
+	if len(missing) > 0 {
+		return fmt.Errorf("controllers %s not enabled in cgroup.subtree_control of %s",
+			strings.Join(missing, ", "), path)
+	}
+	return nil
+}
 
-	memUsage, err := m.readMemoryCurrent(slicePath)
+// checkCPUMax checks that cpu.max holds "max" or a positive quota with the
+// period the agent applies, and returns its content
+func (m *CgroupManager) checkCPUMax(slicePath string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(slicePath, "cpu.max"))
 	if err != nil {
-		m.log.WithError(err).WithField("namespace", namespace).Debug("Failed to read memory.current")
-	} else {
-		stats.MemoryUsageBytes = memUsage
+		return "", fmt.Errorf("failed to read cpu.max: %w", err)
 	}
+	content := strings.TrimSpace(string(data))
 
-	oomKills, err := m.readMemoryEvents(slicePath)
+	parts := strings.Fields(content)
+	if len(parts) != 2 {
+		return content, fmt.Errorf("malformed cpu.max %q", content)
+	}
+	period, err := strconv.ParseInt(parts[1], 10, 64)
 	if err != nil {
-		m.log.WithError(err).WithField("namespace", namespace).Debug("Failed to read memory.events")
-	} else {
-		stats.OOMKills = oomKills
+		return content, fmt.Errorf("malformed cpu.max period %q", parts[1])
 	}
-
-	return stats, nil
+	if parts[0] == "max" {
+		return content, nil
+	}
+	quota, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || quota <= 0 {
+		return content, fmt.Errorf("malformed cpu.max quota %q", parts[0])
+	}
+	if period != m.cpuPeriodUs {
+		return content, fmt.Errorf("cpu.max period is %dus, expected %dus", period, m.cpuPeriodUs)
+	}
+	return content, nil
 }
 
-func (m *CgroupManager) SliceExists(namespace string) bool {
-	slicePath := m.GetSlicePath(namespace)
-	_, err := os.Stat(slicePath)
-	return err == nil
+// checkMemoryMax checks that memory.max holds "max" or a positive byte count,
+// and returns its content
+func checkMemoryMax(slicePath string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(slicePath, "memory.max"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read memory.max: %w", err)
+	}
+	content := strings.TrimSpace(string(data))
+	if content == "max" {
+		return content, nil
+	}
+	if bytes, err := strconv.ParseInt(content, 10, 64); err != nil || bytes <= 0 {
+		return content, fmt.Errorf("malformed memory.max %q", content)
+	}
+	return content, nil
 }
 
-func (m *CgroupManager) GetCurrentLimits(namespace string) (cpuQuota int64, memoryBytes int64, err error) {
-	slicePath := m.GetSlicePath(namespace)
-
-	cpuMaxPath := filepath.Join(slicePath, "cpu.max")
-	cpuContent, err := os.ReadFile(cpuMaxPath)
-	if err == nil {
-		parts := strings.Fields(string(cpuContent))
-		if len(parts) >= 1 && parts[0] != "max" {
-			cpuQuota, _ = strconv.ParseInt(parts[0], 10, 64)
+// ListSlices returns the namespaces that have a slice under the parent slice
+// or, for namespaces with an overridden prefix, under their own parent slice,
+// sorted by name. A missing parent slice yields an empty list.
+func (m *CgroupManager) ListSlices() ([]string, error) {
+	prefixes := []string{m.slicePrefix}
+	for _, prefix := range m.slicePrefixOverrides {
+		if !slices.Contains(prefixes, prefix) {
+			prefixes = append(prefixes, prefix)
 		}
 	}
 
-	memoryMaxPath := filepath.Join(slicePath, "memory.max")
-	memoryContent, err := os.ReadFile(memoryMaxPath)
-	if err == nil {
-		memStr := strings.TrimSpace(string(memoryContent))
-		if memStr != "max" {
-			memoryBytes, _ = strconv.ParseInt(memStr, 10, 64)
+	var namespaces []string
+	for _, slicePrefix := range prefixes {
+		entries, err := os.ReadDir(filepath.Join(m.fsRoot, slicePrefix))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list slices: %w", err)
 		}
-	}
-
-	return cpuQuota, memoryBytes, nil
-}
 
-// ParseCPU converts CPU cores to microseconds quota (e.g., "4" -> 400000)
-func ParseCPU(cpu string) (int64, error) {
-	cpu = strings.TrimSpace(cpu)
-	if cpu == "" {
-		return 0, fmt.Errorf("empty CPU value")
+		prefix := strings.TrimSuffix(slicePrefix, ".slice") + "-"
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			namespace, ok := strings.CutPrefix(entry.Name(), prefix)
+			if !ok {
+				continue
+			}
+			namespace, ok = strings.CutSuffix(namespace, ".slice")
+			// Only slices where GetSlicePath would find them, so that
+			// callers can remove what is listed
+			if !ok || namespace == "" || m.slicePrefixFor(namespace) != slicePrefix {
+				continue
+			}
+			namespaces = append(namespaces, namespace)
+		}
 	}
 
-	cores, err := strconv.ParseFloat(cpu, 64)
-	if err != nil {
-		return 0, fmt.Errorf("invalid CPU value '%s': %w", cpu, err)
-	}
+	slices.Sort(namespaces)
+	return slices.Compact(namespaces), nil
+}
 
-	if cores <= 0 {
-		return 0, fmt.Errorf("CPU value must be positive: %s", cpu)
-	}
+// maxCgroupHierarchyDepth bounds the walk of GetCgroupHierarchy below the
+// cgroup root, which reaches the containers of pods routed to a namespace slice
+const maxCgroupHierarchyDepth = 5
 
-	quota := int64(cores * float64(DefaultCPUPeriod))
-	return quota, nil
+// hierarchyLimitFiles are the interface files reported as limits of a
+// CgroupNode, when the cgroup has them
+var hierarchyLimitFiles = []string{
+	"cpu.max", "cpu.weight", "cpuset.cpus", "memory.max", "memory.high",
+	"memory.low", "memory.min", "pids.max",
 }
 
-// ParseMemory converts memory string to bytes (supports Ki, Mi, Gi, Ti suffixes)
-func ParseMemory(memory string) (int64, error) {
-	memory = strings.TrimSpace(memory)
-	if memory == "" {
-		return 0, fmt.Errorf("empty memory value")
-	}
+// CgroupNode is a cgroup of the tree returned by GetCgroupHierarchy
+type CgroupNode struct {
+	Name        string            `json:"name"`
+	Path        string            `json:"path"`
+	Controllers []string          `json:"controllers"`
+	Limits      map[string]string `json:"limits,omitempty"`
+	Children    []CgroupNode      `json:"children,omitempty"`
+}
 
-	re := regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*(Ki|Mi|Gi|Ti|K|M|G|T|k|m|g|t)?$`)
-	matches := re.FindStringSubmatch(memory)
-	if matches == nil {
-		return 0, fmt.Errorf("invalid memory format: %s", memory)
+// GetCgroupHierarchy returns the cgroup tree below the cgroup root, down to
+// maxCgroupHierarchyDepth levels, with the enabled controllers and limits of
+// every cgroup. Cgroups removed during the walk are left out.
+func (m *CgroupManager) GetCgroupHierarchy() (*CgroupNode, error) {
+	if m.cgroupVersion == 1 {
+		return nil, fmt.Errorf("cgroup hierarchy requires cgroup v2")
 	}
+	return m.readCgroupNode(m.fsRoot, 0)
+}
 
-	value, err := strconv.ParseFloat(matches[1], 64)
+func (m *CgroupManager) readCgroupNode(path string, depth int) (*CgroupNode, error) {
+	entries, err := os.ReadDir(path)
 	if err != nil {
-		return 0, fmt.Errorf("invalid memory value: %w", err)
+		return nil, fmt.Errorf("failed to read cgroup %s: %w", path, err)
 	}
 
-	if value < 0 {
-		return 0, fmt.Errorf("memory value must be non-negative: %s", memory)
+	controllers, err := m.ReadCgroupV2Controllers(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
 	}
-
-	suffix := strings.ToUpper(matches[2])
-
-	var multiplier float64 = 1
-	switch suffix {
-	case "":
-		multiplier = 1
-	case "K", "KI":
-		multiplier = 1024
-	case "M", "MI":
-		multiplier = 1024 * 1024
-	case "G", "GI":
-		multiplier = 1024 * 1024 * 1024
-	case "T", "TI":
-		multiplier = 1024 * 1024 * 1024 * 1024
-	default:
-		return 0, fmt.Errorf("unknown memory suffix: %s", suffix)
+	node := &CgroupNode{
+		Name:        filepath.Base(path),
+		Path:        path,
+		Controllers: controllers,
+		Limits:      make(map[string]string),
+	}
+	if node.Controllers == nil {
+		node.Controllers = []string{}
 	}
 
-	bytes := int64(value * multiplier)
-	return bytes, nil
-}
-
-func (m *CgroupManager) ensureParentSlice(parentPath string) error {
-	if err := os.MkdirAll(parentPath, 0755); err != nil {
-		return fmt.Errorf("failed to create parent slice %s: %w", parentPath, err)
+	for _, file := range hierarchyLimitFiles {
+		if data, err := os.ReadFile(filepath.Join(path, file)); err == nil {
+			node.Limits[file] = strings.TrimSpace(string(data))
+		}
 	}
-	return m.enableControllers(parentPath)
-}
 
-func (m *CgroupManager) enableControllers(path string) error {
-	subtreeControl := filepath.Join(path, "cgroup.subtree_control")
-	if err := os.WriteFile(subtreeControl, []byte(RequiredControllers), 0644); err != nil {
-		return fmt.Errorf("failed to enable controllers in %s: %w", path, err)
+	if depth >= maxCgroupHierarchyDepth {
+		return node, nil
 	}
-	return nil
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		child, err := m.readCgroupNode(filepath.Join(path, entry.Name()), depth+1)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, *child)
+	}
+	return node, nil
 }
 
 func (m *CgroupManager) getSliceName(namespace string) string {
-	prefix := strings.TrimSuffix(m.slicePrefix, ".slice")
+	prefix := strings.TrimSuffix(m.slicePrefixFor(namespace), ".slice")
 	return fmt.Sprintf("%s-%s.slice", prefix, namespace)
 }
 
-// setCPULimitViaSystemd and setMemoryLimitViaSystemd use nsenter to run systemctl
-// in the host namespace. This is required because systemd manages the cgroup hierarchy
-// and silently ignores direct writes to cpu.max/memory.max files.
-func (m *CgroupManager) setCPULimitViaSystemd(namespace string, cpuQuota int64) error {
+// setAllLimitsViaSystemd sets the properties (e.g. CPUQuota=50%) of the
+// namespace slice in a single systemctl call. Limits go through systemd, which
+// manages the cgroup hierarchy and silently ignores direct writes to
+// cpu.max/memory.max files.
+func (m *CgroupManager) setAllLimitsViaSystemd(ctx context.Context, namespace string, props map[string]string) error {
 	sliceName := m.getSliceName(namespace)
-	cpuPercent := (cpuQuota * 100) / DefaultCPUPeriod
 
-	m.log.WithFields(logrus.Fields{
-		"slice":      sliceName,
-		"cpuPercent": cpuPercent,
-	}).Debug("Setting CPU limit via systemd")
+	properties := make([]string, 0, len(props))
+	for _, key := range slices.Sorted(maps.Keys(props)) {
+		properties = append(properties, key+"="+props[key])
+	}
 
-	cmd := exec.Command("nsenter", "-t", "1", "-m", "-u", "-n", "--",
-		"systemctl", "set-property", sliceName,
-		fmt.Sprintf("CPUQuota=%d%%", cpuPercent),
-		"--runtime")
+	if m.DryRun {
+		m.logPlannedProperties(sliceName, properties...)
+		return nil
+	}
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to set CPU via systemd for %s: %w, output: %s", namespace, err, string(output))
+	if err := m.setSystemdProperties(ctx, sliceName, properties...); err != nil {
+		return fmt.Errorf("failed to set properties via systemd for %s: %w", namespace, err)
 	}
 
 	m.log.WithFields(logrus.Fields{
 		"slice":      sliceName,
-		"cpuPercent": cpuPercent,
-	}).Info("CPU limit set via systemd")
+		"properties": strings.Join(properties, " "),
+	}).Info("Limits set via systemd")
 
 	return nil
 }
 
-func (m *CgroupManager) setMemoryLimitViaSystemd(namespace string, memoryBytes int64) error {
-	sliceName := m.getSliceName(namespace)
-	memoryStr := formatMemoryForSystemd(memoryBytes)
-
-	m.log.WithFields(logrus.Fields{
-		"slice":  sliceName,
-		"memory": memoryStr,
-	}).Debug("Setting memory limit via systemd")
+// SetCPUIdlePolicy switches the namespace slice in or out of idle mode
+// (cpu.idle), where it only gets CPU time no other cgroup wants
+func (m *CgroupManager) SetCPUIdlePolicy(namespace string, idle bool) error {
+	defer m.lockNamespace(namespace)()
+	return m.setAllLimitsViaSystemd(context.Background(), namespace, map[string]string{"CPUWeight": cpuIdleWeight(idle)})
+}
 
-	cmd := exec.Command("nsenter", "-t", "1", "-m", "-u", "-n", "--",
-		"systemctl", "set-property", sliceName,
-		fmt.Sprintf("MemoryMax=%s", memoryStr),
-		"--runtime")
+// cpuIdleWeight is the CPUWeight value for idle mode. systemd maps "idle" to
+// cpu.idle=1; leaving idle mode resets CPUWeight to the default.
+func cpuIdleWeight(idle bool) string {
+	if idle {
+		return "idle"
+	}
+	return ""
+}
 
-	output, err := cmd.CombinedOutput()
+// displayCPU formats a CPU quantity with FormatCPUForDisplay, falling back to
+// the raw value if it does not parse
+func (m *CgroupManager) displayCPU(cpu string) string {
+	if cpu == "" {
+		return FormatCPUForDisplay(0, m.cpuPeriodUs)
+	}
+	quota, err := ParseCPU(cpu, m.cpuPeriodUs)
 	if err != nil {
-		return fmt.Errorf("failed to set memory via systemd for %s: %w, output: %s", namespace, err, string(output))
+		return cpu
+	}
+	return FormatCPUForDisplay(quota, m.cpuPeriodUs)
+}
+
+// setSystemdProperties sets runtime properties of a slice once the call
+// limiter allows it, giving up after systemdTimeout. A timeout is reported as
+// a SystemdError wrapping context.DeadlineExceeded.
+func (m *CgroupManager) setSystemdProperties(ctx context.Context, sliceName string, properties ...string) error {
+	if err := m.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("failed to wait for systemd call limiter: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.systemdTimeout)
+	defer cancel()
+
+	err := m.systemd.SetProperties(ctx, sliceName, properties...)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		systemdTimeouts.Inc()
+		return &SystemdError{Err: fmt.Errorf("systemctl did not finish within %s: %w", m.systemdTimeout, context.DeadlineExceeded)}
+	}
+	return err
+}
+
+// SystemdHealthy reports whether systemd answered the last probe of
+// RunSystemdProbe
+func (m *CgroupManager) SystemdHealthy() bool {
+	return m.systemdHealthy.Load()
+}
+
+// RunSystemdProbe checks every interval that systemd answers (systemctl
+// status) until ctx is cancelled, and calls onChange when the outcome flips
+func (m *CgroupManager) RunSystemdProbe(ctx context.Context, interval time.Duration, onChange func(healthy bool)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		probeCtx, cancel := context.WithTimeout(ctx, m.systemdTimeout)
+		err := m.systemd.Ping(probeCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		healthy := err == nil
+		if healthy {
+			systemdReachable.Set(1)
+		} else {
+			systemdReachable.Set(0)
+		}
+		if m.systemdHealthy.Swap(healthy) != healthy {
+			if healthy {
+				m.log.Info("systemd reachable again")
+			} else {
+				m.log.WithError(err).Error("systemd unreachable, pausing limit changes")
+			}
+			if onChange != nil {
+				onChange(healthy)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
+}
 
+func (m *CgroupManager) logPlannedProperties(sliceName string, properties ...string) {
 	m.log.WithFields(logrus.Fields{
-		"slice":  sliceName,
-		"memory": memoryStr,
-	}).Info("Memory limit set via systemd")
+		"slice":      sliceName,
+		"properties": strings.Join(properties, " "),
+	}).Info("Dry run: would set systemd properties")
+}
 
-	return nil
+// FormatCPUForDisplay renders a CPU quota for people, e.g. "4.00 cores" or
+// "500m" below one core. A zero quota is "unlimited".
+func FormatCPUForDisplay(quota int64, period int64) string {
+	if quota <= 0 || period <= 0 {
+		return "unlimited"
+	}
+	if quota < period {
+		return fmt.Sprintf("%dm", quota*1000/period)
+	}
+	return fmt.Sprintf("%.2f cores", float64(quota)/float64(period))
+}
+
+// FormatMemoryForDisplay renders a byte count with a binary unit, e.g.
+// "1.50 GiB". Zero is "unlimited".
+func FormatMemoryForDisplay(bytes int64) string {
+	const (
+		GiB = 1024 * 1024 * 1024
+		MiB = 1024 * 1024
+		KiB = 1024
+	)
+
+	switch {
+	case bytes <= 0:
+		return "unlimited"
+	case bytes >= GiB:
+		return fmt.Sprintf("%.2f GiB", float64(bytes)/GiB)
+	case bytes >= MiB:
+		return fmt.Sprintf("%.2f MiB", float64(bytes)/MiB)
+	case bytes >= KiB:
+		return fmt.Sprintf("%.2f KiB", float64(bytes)/KiB)
+	}
+	return fmt.Sprintf("%d B", bytes)
 }
 
 func formatMemoryForSystemd(bytes int64) string {
@@ -346,11 +1723,11 @@ func formatMemoryForSystemd(bytes int64) string {
 	return fmt.Sprintf("%d", bytes)
 }
 
-func (m *CgroupManager) readCPUStat(slicePath string) (usageUsec, throttled int64, err error) {
+func (m *CgroupManager) readCPUStat(slicePath string) (usageUsec, nrPeriods, nrThrottled int64, err error) {
 	cpuStatPath := filepath.Join(slicePath, "cpu.stat")
 	file, err := os.Open(cpuStatPath)
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to open cpu.stat: %w", err)
+		return 0, 0, 0, fmt.Errorf("failed to open cpu.stat: %w", err)
 	}
 	defer file.Close()
 
@@ -364,16 +1741,30 @@ func (m *CgroupManager) readCPUStat(slicePath string) (usageUsec, throttled int6
 		switch fields[0] {
 		case "usage_usec":
 			usageUsec = val
+		case "nr_periods":
+			nrPeriods = val
 		case "nr_throttled":
-			throttled = val
+			nrThrottled = val
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		return 0, 0, fmt.Errorf("failed to read cpu.stat: %w", err)
+		return 0, 0, 0, fmt.Errorf("failed to read cpu.stat: %w", err)
 	}
 
-	return usageUsec, throttled, nil
+	return usageUsec, nrPeriods, nrThrottled, nil
+}
+
+// setThrottling stores the cpu.stat period counters and the share of periods
+// that were throttled, which is 0 before the first period with a CPU limit.
+func (s *CgroupStats) setThrottling(nrPeriods, nrThrottled int64) {
+	s.CPUNrPeriods = nrPeriods
+	s.CPUNrThrottled = nrThrottled
+	s.CPUThrottled = nrThrottled
+	s.ThrottledPct = 0
+	if nrPeriods > 0 {
+		s.ThrottledPct = float64(nrThrottled) / float64(nrPeriods) * 100
+	}
 }
 
 func (m *CgroupManager) readMemoryCurrent(slicePath string) (int64, error) {
@@ -393,6 +1784,11 @@ func (m *CgroupManager) readMemoryCurrent(slicePath string) (int64, error) {
 }
 
 func (m *CgroupManager) readMemoryEvents(slicePath string) (int64, error) {
+	return readMemoryEvent(slicePath, "oom_kill")
+}
+
+// readMemoryEvent reads a counter of memory.events, 0 if it is not listed
+func readMemoryEvent(slicePath, event string) (int64, error) {
 	memoryEventsPath := filepath.Join(slicePath, "memory.events")
 	file, err := os.Open(memoryEventsPath)
 	if err != nil {
@@ -400,12 +1796,12 @@ func (m *CgroupManager) readMemoryEvents(slicePath string) (int64, error) {
 	}
 	defer file.Close()
 
-	var oomKills int64
+	var value int64
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		fields := strings.Fields(scanner.Text())
-		if len(fields) == 2 && fields[0] == "oom_kill" {
-			oomKills, _ = strconv.ParseInt(fields[1], 10, 64)
+		if len(fields) == 2 && fields[0] == event {
+			value, _ = strconv.ParseInt(fields[1], 10, 64)
 			break
 		}
 	}
@@ -414,5 +1810,145 @@ func (m *CgroupManager) readMemoryEvents(slicePath string) (int64, error) {
 		return 0, fmt.Errorf("failed to read memory.events: %w", err)
 	}
 
-	return oomKills, nil
+	return value, nil
+}
+
+// WatchCgroupEvents sends the value of a memory.events counter of the
+// namespace slice, such as oom_kill: first its current value, then every new
+// value as soon as the kernel updates the file. The channel is closed when
+// ctx is cancelled or the slice is removed.
+func (m *CgroupManager) WatchCgroupEvents(ctx context.Context, namespace, event string) (<-chan int64, error) {
+	slicePath := m.GetSlicePath(namespace)
+
+	ctx, cancel := context.WithCancel(ctx)
+	changes, err := watchFileModified(ctx, filepath.Join(slicePath, "memory.events"))
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to watch memory.events of %s: %w", namespace, err)
+	}
+	value, err := readMemoryEvent(slicePath, event)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	values := make(chan int64, 1)
+	values <- value
+	go func() {
+		defer cancel()
+		defer close(values)
+
+		for range changes {
+			current, err := readMemoryEvent(slicePath, event)
+			if err != nil {
+				m.log.WithError(err).WithField("namespace", namespace).Debug("Failed to read memory.events")
+				continue
+			}
+			// The file also changes when other counters do
+			if current == value {
+				continue
+			}
+			value = current
+
+			select {
+			case values <- value:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return values, nil
+}
+
+func (m *CgroupManager) readPressureStats(slicePath string, stats *CgroupStats) {
+	if some, _, err := m.readPSI(slicePath, "cpu"); err != nil {
+		m.log.WithError(err).Debug("Failed to read cpu.pressure")
+	} else {
+		stats.CPUPressureSomeAvg10 = some
+	}
+
+	if some, full, err := m.readPSI(slicePath, "memory"); err != nil {
+		m.log.WithError(err).Debug("Failed to read memory.pressure")
+	} else {
+		stats.MemoryPressureSomeAvg10 = some
+		stats.MemoryPressureFullAvg10 = full
+	}
+
+	if some, _, err := m.readPSI(slicePath, "io"); err != nil {
+		m.log.WithError(err).Debug("Failed to read io.pressure")
+	} else {
+		stats.IOPressureSomeAvg10 = some
+	}
+}
+
+// readPSI parses the avg10 values from <subsystem>.pressure, e.g.:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func (m *CgroupManager) readPSI(slicePath, subsystem string) (someAvg10, fullAvg10 float64, err error) {
+	pressurePath := filepath.Join(slicePath, subsystem+".pressure")
+	file, err := os.Open(pressurePath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open %s.pressure: %w", subsystem, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		var avg10 float64
+		for _, field := range fields[1:] {
+			if value, ok := strings.CutPrefix(field, "avg10="); ok {
+				avg10, _ = strconv.ParseFloat(value, 64)
+				break
+			}
+		}
+
+		switch fields[0] {
+		case "some":
+			someAvg10 = avg10
+		case "full":
+			fullAvg10 = avg10
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, 0, fmt.Errorf("failed to read %s.pressure: %w", subsystem, err)
+	}
+
+	return someAvg10, fullAvg10, nil
+}
+
+// Levels reported by GetMemoryPressureLevel
+const (
+	MemoryPressureLow      = "low"
+	MemoryPressureMedium   = "medium"
+	MemoryPressureCritical = "critical"
+)
+
+// MemoryPressureLevels lists the levels in increasing order of pressure
+var MemoryPressureLevels = []string{MemoryPressureLow, MemoryPressureMedium, MemoryPressureCritical}
+
+// GetMemoryPressureLevel classifies the "some avg10" value of memory.pressure
+// of the namespace slice: critical from MemoryPressureMediumThreshold,
+// medium from MemoryPressureLowThreshold, low below.
+func (m *CgroupManager) GetMemoryPressureLevel(namespace string) (string, error) {
+	some, _, err := m.readPSI(m.GetSlicePath(namespace), "memory")
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case some >= m.MemoryPressureMediumThreshold:
+		return MemoryPressureCritical, nil
+	case some >= m.MemoryPressureLowThreshold:
+		return MemoryPressureMedium, nil
+	default:
+		return MemoryPressureLow, nil
+	}
 }
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchFileModified signals on the returned channel when the file at path is
+// modified. Signals are coalesced while the receiver is busy. The channel is
+// closed when ctx is cancelled or the file is removed, as with the cgroup
+// files of a removed slice.
+func watchFileModified(ctx context.Context, path string) (<-chan struct{}, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize inotify: %w", err)
+	}
+	if _, err := unix.InotifyAddWatch(fd, path, unix.IN_MODIFY); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to watch %s: %w", path, err)
+	}
+
+	// A non-blocking descriptor goes through the runtime poller, so closing
+	// the file interrupts a pending Read
+	file := os.NewFile(uintptr(fd), "inotify")
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stopped:
+		}
+		file.Close()
+	}()
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+		defer close(stopped)
+
+		buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+		for {
+			n, err := file.Read(buf)
+			if err != nil {
+				return
+			}
+			for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+				mask := binary.NativeEndian.Uint32(buf[offset+4:])
+				nameLen := binary.NativeEndian.Uint32(buf[offset+12:])
+				if mask&unix.IN_IGNORED != 0 {
+					return
+				}
+				offset += unix.SizeofInotifyEvent + int(nameLen)
+			}
+
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return changes, nil
+}
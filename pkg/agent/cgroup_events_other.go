@@ -0,0 +1,12 @@
+//go:build !linux
+
+package agent
+
+import (
+	"context"
+	"errors"
+)
+
+func watchFileModified(context.Context, string) (<-chan struct{}, error) {
+	return nil, errors.New("watching cgroup files requires inotify, available on Linux only")
+}
@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"math"
+	"testing"
+)
+
+func FuzzParseCPU(f *testing.F) {
+	for _, seed := range []string{
+		"2", "1.5", "500m", "10m", "1e30", "10Ei", "9223372036854775807",
+		"−1", "-1", "0", "1\n", "1\n2", "5m\n", "",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, cpu string) {
+		quota, err := ParseCPU(cpu, DefaultCPUPeriod)
+		if err != nil {
+			return
+		}
+		if quota*100 < DefaultCPUPeriod {
+			t.Errorf("ParseCPU(%q) = %d, want at least 1%% of the period", cpu, quota)
+		}
+	})
+}
+
+func FuzzParseMemory(f *testing.F) {
+	for _, seed := range []string{
+		"512Mi", "1.5Gi", "1G", "512m", "8Ei", "10Ei", "1e30",
+		"9223372036854775807", "9223372036854775808", "−1Gi", "-1Gi",
+		"0", "1Gi\n", "1\nGi", "",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, memory string) {
+		bytes, err := ParseMemory(memory)
+		if err != nil {
+			return
+		}
+		if bytes < 0 || bytes == math.MaxInt64 {
+			t.Errorf("ParseMemory(%q) = %d, want a value in [0, MaxInt64)", memory, bytes)
+		}
+	})
+}
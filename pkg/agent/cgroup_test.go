@@ -0,0 +1,367 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/agent/testutil"
+)
+
+func TestParseCPU(t *testing.T) {
+	tests := []struct {
+		cpu     string
+		want    int64
+		wantErr bool
+	}{
+		{cpu: "2", want: 200000},
+		{cpu: "1.5", want: 150000},
+		{cpu: "0.5", want: 50000},
+		{cpu: "500m", want: 50000},
+		{cpu: "10m", want: 1000},
+		{cpu: "1500m", want: 150000},
+		{cpu: " 2 ", want: 200000},
+		{cpu: "2\n", want: 200000},
+		{cpu: "5m", wantErr: true},
+		{cpu: "0", wantErr: true},
+		{cpu: "0m", wantErr: true},
+		{cpu: "-1", wantErr: true},
+		{cpu: "−1", wantErr: true},
+		{cpu: "", wantErr: true},
+		{cpu: "   ", wantErr: true},
+		{cpu: "500M", want: 50000000000000},
+		{cpu: "1e30", wantErr: true},
+		{cpu: "10Ei", wantErr: true},
+		{cpu: "2 cores", wantErr: true},
+		{cpu: "abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cpu, func(t *testing.T) {
+			got, err := ParseCPU(tt.cpu, DefaultCPUPeriod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCPU(%q) error = %v, wantErr %v", tt.cpu, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseCPU(%q) = %d, want %d", tt.cpu, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	tests := []struct {
+		memory  string
+		want    int64
+		wantErr bool
+	}{
+		{memory: "512Mi", want: 512 << 20},
+		{memory: "1Gi", want: 1 << 30},
+		{memory: "1.5Gi", want: 1536 << 20},
+		{memory: "1Ki", want: 1024},
+		{memory: "1Ti", want: 1 << 40},
+		{memory: "1k", want: 1000},
+		{memory: "1M", want: 1000000},
+		{memory: "1G", want: 1000000000},
+		{memory: "1T", want: 1000000000000},
+		{memory: "1.5G", want: 1500000000},
+		{memory: "512m", want: 1},
+		{memory: "1048576", want: 1 << 20},
+		{memory: "0", want: 0},
+		{memory: " 1Gi ", want: 1 << 30},
+		{memory: "1Gi\n", want: 1 << 30},
+		{memory: "7Ei", want: 7 << 60},
+		{memory: "1gi", wantErr: true},
+		{memory: "1g", wantErr: true},
+		{memory: "1K", wantErr: true},
+		{memory: "1GB", wantErr: true},
+		{memory: "1 Gi", wantErr: true},
+		{memory: "1\nGi", wantErr: true},
+		{memory: "-1Gi", wantErr: true},
+		{memory: "−1Gi", wantErr: true},
+		{memory: "", wantErr: true},
+		{memory: "   ", wantErr: true},
+		{memory: "8Ei", wantErr: true},
+		{memory: "10Ei", wantErr: true},
+		{memory: "9223372036854775807", wantErr: true},
+		{memory: "1e30", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.memory, func(t *testing.T) {
+			got, err := ParseMemory(tt.memory)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMemory(%q) error = %v, wantErr %v", tt.memory, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMemory(%q) = %d, want %d", tt.memory, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatMemoryForSystemd(t *testing.T) {
+	const (
+		KB = 1024
+		MB = 1024 * KB
+		GB = 1024 * MB
+	)
+
+	tests := []struct {
+		bytes int64
+		want  string
+	}{
+		{bytes: 0, want: "0"},
+		{bytes: 1, want: "1"},
+		{bytes: KB - 1, want: "1023"},
+		{bytes: KB, want: "1K"},
+		{bytes: KB + 1, want: "1025"},
+		{bytes: 1536, want: "1536"},
+		{bytes: MB - KB, want: "1023K"},
+		{bytes: MB, want: "1M"},
+		{bytes: MB + KB, want: "1025K"},
+		{bytes: GB - MB, want: "1023M"},
+		{bytes: GB, want: "1G"},
+		{bytes: GB + MB, want: "1025M"},
+		{bytes: GB + KB, want: "1048577K"},
+		{bytes: GB + 1, want: "1073741825"},
+		{bytes: 1536 * MB, want: "1536M"},
+		{bytes: 8 * GB, want: "8G"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			got := formatMemoryForSystemd(tt.bytes)
+			if got != tt.want {
+				t.Fatalf("formatMemoryForSystemd(%d) = %q, want %q", tt.bytes, got, tt.want)
+			}
+			if back := parseSystemdBytes(t, got); back != tt.bytes {
+				t.Errorf("formatMemoryForSystemd(%d) = %q, which systemd reads as %d bytes", tt.bytes, got, back)
+			}
+		})
+	}
+}
+
+// parseSystemdBytes reads a size the way systemd does, with binary K, M and
+// G suffixes
+func parseSystemdBytes(t *testing.T, value string) int64 {
+	t.Helper()
+
+	multiplier := int64(1)
+	for suffix, factor := range map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30} {
+		if trimmed, ok := strings.CutSuffix(value, suffix); ok {
+			value, multiplier = trimmed, factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		t.Fatalf("failed to parse systemd size %q: %v", value, err)
+	}
+	return n * multiplier
+}
+
+// newTestCgroupManager returns a CgroupManager on a fake cgroup tree whose
+// systemctl calls are recorded by executor
+func newTestCgroupManager(t *testing.T, executor *testutil.FakeExecutor, cpuPeriodUs int64, opts ...CgroupManagerOption) (*CgroupManager, *testutil.FakeCgroupFS) {
+	t.Helper()
+
+	fs := testutil.NewFakeCgroupFS(t)
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	opts = append([]CgroupManagerOption{WithExecutor(executor)}, opts...)
+	m, err := NewCgroupManager(fs.Root(), fs.SlicePrefix(), cpuPeriodUs, log, opts...)
+	if err != nil {
+		t.Fatalf("failed to create cgroup manager: %v", err)
+	}
+	return m, fs
+}
+
+// addTestSlice creates the slice of namespace with the controllers
+// EnsureSlice verifies
+func addTestSlice(fs *testutil.FakeCgroupFS, namespace string) {
+	fs.AddSlice(namespace, testutil.SliceValues{})
+	rel := strings.TrimPrefix(fs.SlicePath(namespace), fs.Root())
+	fs.WriteFile(filepath.Join(rel, "cgroup.controllers"), "cpu memory pids")
+}
+
+// addRemovableTestSlice creates an empty slice directory for namespace. The
+// kernel lets a cgroup with interface files be removed, a plain directory
+// does not.
+func addRemovableTestSlice(t *testing.T, fs *testutil.FakeCgroupFS, namespace string) {
+	t.Helper()
+	if err := os.MkdirAll(fs.SlicePath(namespace), 0755); err != nil {
+		t.Fatalf("failed to create slice of %s: %v", namespace, err)
+	}
+}
+
+func TestEnsureSliceSystemdArgs(t *testing.T) {
+	nsenter := []string{"-t", "1", "-m", "-u", "-n", "--", "systemctl", "set-property", "brasa-team-a.slice"}
+
+	tests := []struct {
+		name        string
+		cpuPeriodUs int64
+		limits      SliceLimits
+		want        []string
+	}{
+		{
+			name:        "one CPU",
+			cpuPeriodUs: DefaultCPUPeriod,
+			limits:      SliceLimits{CPU: "1"},
+			want:        []string{"CPUQuota=100%"},
+		},
+		{
+			name:        "minimum CPU",
+			cpuPeriodUs: DefaultCPUPeriod,
+			limits:      SliceLimits{CPU: "10m"},
+			want:        []string{"CPUQuota=1%"},
+		},
+		{
+			name:        "millicores rounded down to a percent",
+			cpuPeriodUs: DefaultCPUPeriod,
+			limits:      SliceLimits{CPU: "19m"},
+			want:        []string{"CPUQuota=1%"},
+		},
+		{
+			name:        "just below one CPU",
+			cpuPeriodUs: DefaultCPUPeriod,
+			limits:      SliceLimits{CPU: "999m"},
+			want:        []string{"CPUQuota=99%"},
+		},
+		{
+			name:        "fractional cores",
+			cpuPeriodUs: DefaultCPUPeriod,
+			limits:      SliceLimits{CPU: "2.555"},
+			want:        []string{"CPUQuota=255%"},
+		},
+		{
+			name:        "custom period",
+			cpuPeriodUs: 50000,
+			limits:      SliceLimits{CPU: "250m"},
+			want:        []string{"CPUQuota=25%", "CPUQuotaPeriodSec=50000us"},
+		},
+		{
+			name:        "memory and weight",
+			cpuPeriodUs: DefaultCPUPeriod,
+			limits:      SliceLimits{CPU: "500m", Memory: "1.5Gi", MemoryHigh: "1Gi", CPUWeight: 200},
+			want:        []string{"CPUQuota=50%", "CPUWeight=200", "MemoryHigh=1G", "MemoryMax=1536M"},
+		},
+		{
+			name:        "decimal memory",
+			cpuPeriodUs: DefaultCPUPeriod,
+			limits:      SliceLimits{Memory: "1G"},
+			want:        []string{"MemoryMax=1000000000"},
+		},
+		{
+			name:        "memory protection",
+			cpuPeriodUs: DefaultCPUPeriod,
+			limits:      SliceLimits{Memory: "2Gi", MemoryMin: "512Mi", MemoryLow: "1Gi"},
+			want:        []string{"MemoryLow=1G", "MemoryMax=2G", "MemoryMin=512M"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := &testutil.FakeExecutor{}
+			m, fs := newTestCgroupManager(t, executor, tt.cpuPeriodUs)
+			addTestSlice(fs, "team-a")
+
+			if err := m.EnsureSlice(context.Background(), "team-a", tt.limits); err != nil {
+				t.Fatalf("EnsureSlice() error = %v", err)
+			}
+
+			calls := executor.Calls()
+			if len(calls) != 1 {
+				t.Fatalf("EnsureSlice() ran %d commands, want 1: %v", len(calls), calls)
+			}
+			want := append(append(append([]string(nil), nsenter...), tt.want...), "--runtime")
+			if calls[0].Name != "nsenter" || !slices.Equal(calls[0].Args, want) {
+				t.Errorf("EnsureSlice() ran %q, want %q", calls[0], "nsenter "+strings.Join(want, " "))
+			}
+		})
+	}
+}
+
+func TestEnsureSliceRejectsCPUBelowOnePercent(t *testing.T) {
+	executor := &testutil.FakeExecutor{}
+	m, fs := newTestCgroupManager(t, executor, DefaultCPUPeriod)
+	addTestSlice(fs, "team-a")
+
+	if err := m.EnsureSlice(context.Background(), "team-a", SliceLimits{CPU: "5m"}); err == nil {
+		t.Fatal("EnsureSlice() with cpu 5m succeeded, want an error")
+	}
+	if calls := executor.Calls(); len(calls) != 0 {
+		t.Errorf("EnsureSlice() ran %v, want no command", calls)
+	}
+}
+
+func TestDryRunRunsNoCommand(t *testing.T) {
+	executor := &testutil.FakeExecutor{}
+	m, fs := newTestCgroupManager(t, executor, DefaultCPUPeriod)
+	m.DryRun = true
+	addRemovableTestSlice(t, fs, "team-a")
+
+	limits := SliceLimits{CPU: "500m", Memory: "1Gi", CPUWeight: 200}
+	if err := m.EnsureSlice(context.Background(), "team-a", limits); err != nil {
+		t.Fatalf("EnsureSlice() error = %v", err)
+	}
+	if err := m.EnsureSlice(context.Background(), "team-b", limits); err != nil {
+		t.Fatalf("EnsureSlice() of a new slice error = %v", err)
+	}
+	if err := m.RemoveSlice("team-a"); err != nil {
+		t.Fatalf("RemoveSlice() error = %v", err)
+	}
+
+	if calls := executor.Calls(); len(calls) != 0 {
+		t.Errorf("dry run ran %v, want no command", calls)
+	}
+	if !m.SliceExists("team-a") {
+		t.Error("dry run removed the slice of team-a")
+	}
+	if m.SliceExists("team-b") {
+		t.Error("dry run created the slice of team-b")
+	}
+}
+
+func TestNamespaceLocksReleased(t *testing.T) {
+	m, fs := newTestCgroupManager(t, &testutil.FakeExecutor{}, DefaultCPUPeriod)
+	addTestSlice(fs, "team-a")
+	addRemovableTestSlice(t, fs, "team-b")
+
+	if err := m.EnsureSlice(context.Background(), "team-a", SliceLimits{CPU: "500m"}); err != nil {
+		t.Fatalf("EnsureSlice() error = %v", err)
+	}
+	if err := m.RemoveSlice("team-b"); err != nil {
+		t.Fatalf("RemoveSlice() error = %v", err)
+	}
+
+	// Waiters share the lock of the holder until the last one releases it
+	var wg sync.WaitGroup
+	var inside atomic.Int32
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer m.lockNamespace("team-c")()
+			if n := inside.Add(1); n != 1 {
+				t.Errorf("%d goroutines hold the lock of team-c", n)
+			}
+			inside.Add(-1)
+		}()
+	}
+	wg.Wait()
+
+	if n := len(m.namespaceLocks); n != 0 {
+		t.Errorf("%d namespace locks left after use, want none", n)
+	}
+}
@@ -0,0 +1,440 @@
+package agent
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultAdmissionMemoryThreshold is the memory usage, in percent of the
+// namespace limit, above which the pod admission webhook rejects new pods
+const DefaultAdmissionMemoryThreshold = 95
+
+// Values of --log-output
+const (
+	LogOutputStdout = "stdout"
+	LogOutputStderr = "stderr"
+)
+
+// LogOutputWriter returns the stream named by --log-output
+func LogOutputWriter(output string) io.Writer {
+	if output == LogOutputStdout {
+		return os.Stdout
+	}
+	return os.Stderr
+}
+
+// ValidateLogOutput checks a --log-output value
+func ValidateLogOutput(output string) error {
+	if output != LogOutputStdout && output != LogOutputStderr {
+		return fmt.Errorf("invalid logOutput %q: must be %s or %s", output, LogOutputStdout, LogOutputStderr)
+	}
+	return nil
+}
+
+// metricsNamespacePattern matches the characters allowed in a Prometheus metric name prefix
+var metricsNamespacePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// AgentConfig mirrors the agent command-line flags so they can also be read
+// from a YAML file (--config-file). Durations use Go syntax, e.g. "30s".
+type AgentConfig struct {
+	Kubeconfig  string `json:"kubeconfig,omitempty"`
+	CgroupRoot  string `json:"cgroupRoot,omitempty"`
+	SlicePrefix string `json:"slicePrefix,omitempty"`
+
+	SlicePrefixConfigMap          string `json:"slicePrefixConfigMap,omitempty"`
+	SlicePrefixConfigMapNamespace string `json:"slicePrefixConfigMapNamespace,omitempty"`
+
+	NodeName         string `json:"nodeName,omitempty"`
+	LogLevel         string `json:"logLevel,omitempty"`
+	LogCaller        bool   `json:"logCaller,omitempty"`
+	LogOutput        string `json:"logOutput,omitempty"`
+	MetricsPort      string `json:"metricsPort,omitempty"`
+	MetricsNamespace string `json:"metricsNamespace,omitempty"`
+
+	MetricsTLSCert          string `json:"metricsTLSCert,omitempty"`
+	MetricsTLSKey           string `json:"metricsTLSKey,omitempty"`
+	MetricsAuthUser         string `json:"metricsAuthUser,omitempty"`
+	MetricsAuthPasswordHash string `json:"metricsAuthPasswordHash,omitempty"`
+
+	CPUPeriod         int64           `json:"cpuPeriod,omitempty"`
+	Workers           int             `json:"workers,omitempty"`
+	MaxRetries        int             `json:"maxRetries"`
+	RetryBaseDelay    metav1.Duration `json:"retryBaseDelay,omitempty"`
+	RetryMaxDelay     metav1.Duration `json:"retryMaxDelay,omitempty"`
+	ReconcileInterval metav1.Duration `json:"reconcileInterval,omitempty"`
+	ShutdownTimeout   metav1.Duration `json:"shutdownTimeout,omitempty"`
+	ResyncPeriod      metav1.Duration `json:"resyncPeriod,omitempty"`
+	ReportInterval    metav1.Duration `json:"reportInterval,omitempty"`
+	DryRun            bool            `json:"dryRun,omitempty"`
+
+	NamespaceFilterLabel string `json:"namespaceFilterLabel,omitempty"`
+	NamespacePrefix      string `json:"namespacePrefix,omitempty"`
+
+	AutoCreateFromAnnotations bool `json:"autoCreateFromAnnotations,omitempty"`
+	EnablePolicies            bool `json:"enablePolicies,omitempty"`
+	CleanupOrphans            bool `json:"cleanupOrphans"`
+	ResyncOnStartup           bool `json:"resyncOnStartup"`
+	UseResourceQuotaFallback  bool `json:"useResourceQuotaFallback,omitempty"`
+
+	EmitEventsForOOM  bool            `json:"emitEventsForOOM"`
+	OOMEventRateLimit metav1.Duration `json:"oomEventRateLimit,omitempty"`
+
+	PriorityClassWeightDivisor int  `json:"priorityClassWeightDivisor,omitempty"`
+	FastWatch                  bool `json:"fastWatch,omitempty"`
+
+	SystemdCallRate  float64 `json:"systemdCallRate,omitempty"`
+	SystemdCallBurst int     `json:"systemdCallBurst,omitempty"`
+	RequireCgroupV2  bool    `json:"requireCgroupV2"`
+
+	SystemdTimeout  metav1.Duration `json:"systemdTimeout,omitempty"`
+	SystemdExecutor string          `json:"systemdExecutor,omitempty"`
+
+	WaitForSliceReady bool `json:"waitForSliceReady,omitempty"`
+
+	AllowedCgroupAttributes string `json:"allowedCgroupAttributes,omitempty"`
+	DisableSSA              bool   `json:"disableSSA,omitempty"`
+
+	EventRateLimit float64 `json:"eventRateLimit,omitempty"`
+	EventBurst     int     `json:"eventBurst,omitempty"`
+
+	LeaderElect              bool            `json:"leaderElect,omitempty"`
+	LeaderElectLeaseDuration metav1.Duration `json:"leaderElectLeaseDuration,omitempty"`
+	LeaderElectRenewDeadline metav1.Duration `json:"leaderElectRenewDeadline,omitempty"`
+	LeaderElectRetryPeriod   metav1.Duration `json:"leaderElectRetryPeriod,omitempty"`
+
+	OTelEndpoint    string `json:"otelEndpoint,omitempty"`
+	OTelServiceName string `json:"otelServiceName,omitempty"`
+
+	WebhookPort string `json:"webhookPort,omitempty"`
+	TLSCertFile string `json:"tlsCertFile,omitempty"`
+	TLSKeyFile  string `json:"tlsKeyFile,omitempty"`
+
+	AdmissionMemoryThreshold int `json:"admissionMemoryThreshold"`
+}
+
+// DefaultAgentConfig returns the configuration used when neither a flag nor
+// the config file sets a value.
+func DefaultAgentConfig() AgentConfig {
+	return AgentConfig{
+		CgroupRoot:  "/sys/fs/cgroup",
+		SlicePrefix: "brasa.slice",
+
+		SlicePrefixConfigMapNamespace: "kube-system",
+
+		NodeName:          os.Getenv("NODE_NAME"),
+		LogLevel:          "info",
+		LogOutput:         LogOutputStderr,
+		MetricsPort:       "9090",
+		MetricsNamespace:  DefaultMetricsNamespace,
+		CPUPeriod:         DefaultCPUPeriod,
+		Workers:           DefaultWorkers,
+		MaxRetries:        DefaultMaxRetries,
+		RetryBaseDelay:    metav1.Duration{Duration: DefaultRetryBaseDelay},
+		RetryMaxDelay:     metav1.Duration{Duration: DefaultRetryMaxDelay},
+		ReconcileInterval: metav1.Duration{Duration: DefaultReconcileInterval},
+		ShutdownTimeout:   metav1.Duration{Duration: DefaultShutdownTimeout},
+		ResyncPeriod:      metav1.Duration{Duration: DefaultResyncPeriod},
+
+		LeaderElectLeaseDuration: metav1.Duration{Duration: 15 * time.Second},
+		LeaderElectRenewDeadline: metav1.Duration{Duration: 10 * time.Second},
+		LeaderElectRetryPeriod:   metav1.Duration{Duration: 2 * time.Second},
+
+		OTelServiceName: DefaultOTelServiceName,
+		WebhookPort:     "9443",
+
+		AdmissionMemoryThreshold: DefaultAdmissionMemoryThreshold,
+
+		CleanupOrphans:  true,
+		ResyncOnStartup: true,
+
+		EmitEventsForOOM:  true,
+		OOMEventRateLimit: metav1.Duration{Duration: DefaultOOMEventInterval},
+
+		PriorityClassWeightDivisor: DefaultPriorityClassWeightDivisor,
+
+		SystemdCallRate:  DefaultSystemdCallRate,
+		SystemdCallBurst: DefaultSystemdCallBurst,
+		RequireCgroupV2:  true,
+		SystemdTimeout:   metav1.Duration{Duration: DefaultSystemdTimeout},
+
+		EventBurst: DefaultEventBurst,
+	}
+}
+
+// BindFlags registers a flag for every field, using the current values as defaults
+func (c *AgentConfig) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Kubeconfig, "kubeconfig", c.Kubeconfig, "Path to kubeconfig file (uses in-cluster config if empty)")
+	fs.StringVar(&c.CgroupRoot, "cgroup-root", c.CgroupRoot, "Root path for cgroup v2 filesystem")
+	fs.StringVar(&c.SlicePrefix, "slice-prefix", c.SlicePrefix, "Prefix for cgroup slice names")
+	fs.StringVar(&c.SlicePrefixConfigMap, "slice-prefix-config-map", c.SlicePrefixConfigMap, "ConfigMap overriding the slice prefix of individual namespaces (key=namespace, value=prefix)")
+	fs.StringVar(&c.SlicePrefixConfigMapNamespace, "slice-prefix-config-map-namespace", c.SlicePrefixConfigMapNamespace, "Namespace of --slice-prefix-config-map")
+	fs.StringVar(&c.NodeName, "node-name", c.NodeName, "Name of the node the agent runs on, added as the node label to the metrics (default $NODE_NAME, else the hostname)")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "Log level (debug, info, warn, error)")
+	fs.BoolVar(&c.LogCaller, "log-caller", c.LogCaller, "Include the source file and line of each log entry")
+	fs.StringVar(&c.LogOutput, "log-output", c.LogOutput, "Stream logs are written to (stdout, stderr)")
+	fs.StringVar(&c.MetricsPort, "metrics-port", c.MetricsPort, "Port for Prometheus metrics server")
+	fs.StringVar(&c.MetricsNamespace, "metrics-namespace", c.MetricsNamespace, "Prefix of the metric names, which are <namespace>_quota_*")
+	fs.StringVar(&c.MetricsTLSCert, "metrics-tls-cert", c.MetricsTLSCert, "TLS certificate for the metrics server (plain HTTP if empty)")
+	fs.StringVar(&c.MetricsTLSKey, "metrics-tls-key", c.MetricsTLSKey, "TLS private key for the metrics server")
+	fs.StringVar(&c.MetricsAuthUser, "metrics-auth-user", c.MetricsAuthUser, "User required by basic auth on the metrics server (no auth if empty)")
+	fs.StringVar(&c.MetricsAuthPasswordHash, "metrics-auth-password-hash", c.MetricsAuthPasswordHash, "bcrypt hash of the password required with --metrics-auth-user")
+	fs.Int64Var(&c.CPUPeriod, "cpu-period", c.CPUPeriod, "CPU quota period in microseconds (1000-1000000)")
+	fs.IntVar(&c.Workers, "workers", c.Workers, "Number of concurrent reconciliation workers")
+	fs.IntVar(&c.MaxRetries, "max-retries", c.MaxRetries, "Number of times a failed reconcile is retried before the key is dropped (-1 for unlimited)")
+	fs.DurationVar(&c.RetryBaseDelay.Duration, "retry-base-delay", c.RetryBaseDelay.Duration, "Delay before the first retry of a failed reconcile, doubled on every further failure")
+	fs.DurationVar(&c.RetryMaxDelay.Duration, "retry-max-delay", c.RetryMaxDelay.Duration, "Maximum delay between retries of a failed reconcile")
+	fs.StringVar(&c.NamespaceFilterLabel, "namespace-filter-label", c.NamespaceFilterLabel, "Only manage the quotas of namespaces matching this label selector (e.g. managed-by=team-a)")
+	fs.StringVar(&c.NamespacePrefix, "namespace-prefix", c.NamespacePrefix, "Only manage the quotas of namespaces whose name starts with this prefix")
+	fs.DurationVar(&c.ReconcileInterval.Duration, "reconcile-interval", c.ReconcileInterval.Duration, "Interval between full reconciliations that detect cgroup drift (0 disables)")
+	fs.DurationVar(&c.ShutdownTimeout.Duration, "shutdown-timeout", c.ShutdownTimeout.Duration, "Time to wait for in-flight reconciles after SIGTERM before cancelling them")
+	fs.DurationVar(&c.ResyncPeriod.Duration, "resync-period", c.ResyncPeriod.Duration, "Interval at which the informers replay every cached object as an update (minimum 10s)")
+	fs.DurationVar(&c.ReportInterval.Duration, "report-interval", c.ReportInterval.Duration, "Interval between logged reports of all managed namespaces (0 disables)")
+	fs.BoolVar(&c.DryRun, "dry-run", c.DryRun, "Log planned cgroup changes without applying them")
+	fs.BoolVar(&c.AutoCreateFromAnnotations, "auto-create-from-annotations", c.AutoCreateFromAnnotations, "Create NamespaceQuotas from the brasa.cloud/cpu-limit and brasa.cloud/memory-limit namespace annotations")
+	fs.BoolVar(&c.EnablePolicies, "enable-policies", c.EnablePolicies, "Create NamespaceQuotas for the namespaces selected by NamespaceIsolationPolicies")
+	fs.BoolVar(&c.CleanupOrphans, "cleanup-orphans", c.CleanupOrphans, "Remove cgroup slices without a NamespaceQuota at startup")
+	fs.BoolVar(&c.ResyncOnStartup, "resync-on-startup", c.ResyncOnStartup, "Check the slice of every quota once after startup or regaining leadership, even if its generation was already applied")
+	fs.BoolVar(&c.UseResourceQuotaFallback, "use-resource-quota-fallback", c.UseResourceQuotaFallback, "Take CPU and memory limits missing from a NamespaceQuota from the namespace's ResourceQuota limits.cpu and limits.memory")
+	fs.IntVar(&c.PriorityClassWeightDivisor, "priority-class-weight-divisor", c.PriorityClassWeightDivisor, "PriorityClass value worth one CPUWeight point for quotas with a priorityClass (weight = 100 + value / divisor)")
+	fs.BoolVar(&c.EmitEventsForOOM, "emit-events-for-oom", c.EmitEventsForOOM, "Emit an OOMKilled Warning event on the namespace when a process of its slice is OOM killed (cgroup v2)")
+	fs.DurationVar(&c.OOMEventRateLimit.Duration, "oom-event-rate-limit", c.OOMEventRateLimit.Duration, "Minimum interval between OOMKilled events of a namespace; kills in between are reported with the next event (0 disables)")
+	fs.BoolVar(&c.FastWatch, "fast-watch", c.FastWatch, "Enqueue NamespaceQuota changes from a dedicated watch as soon as they arrive, ahead of the informer")
+	fs.Float64Var(&c.SystemdCallRate, "systemd-call-rate", c.SystemdCallRate, "Maximum systemctl calls per second made while applying limits")
+	fs.IntVar(&c.SystemdCallBurst, "systemd-call-burst", c.SystemdCallBurst, "Number of systemctl calls allowed in a burst above --systemd-call-rate")
+	fs.DurationVar(&c.SystemdTimeout.Duration, "systemd-timeout", c.SystemdTimeout.Duration, "Maximum duration of a single systemctl call before it is killed")
+	fs.BoolVar(&c.WaitForSliceReady, "wait-for-slice-ready", c.WaitForSliceReady, "Wait until cpu.max and memory.max reflect new limits before reporting a slice as configured")
+	fs.StringVar(&c.SystemdExecutor, "systemd-executor", c.SystemdExecutor, "How systemctl is run: nsenter, direct or noop (default nsenter on Linux, noop elsewhere)")
+	fs.Float64Var(&c.EventRateLimit, "event-rate-limit", c.EventRateLimit, "Maximum Kubernetes events per second emitted by the agent; events over the limit are delayed, keeping only the latest (0 disables)")
+	fs.IntVar(&c.EventBurst, "event-burst", c.EventBurst, "Number of Kubernetes events allowed in a burst above --event-rate-limit")
+	fs.StringVar(&c.AllowedCgroupAttributes, "allowed-cgroup-attributes", c.AllowedCgroupAttributes, "Comma-separated cgroup files NamespaceQuotas may set through rawAttributes, e.g. memory.zswap.max,cpu.uclamp.min (none if empty)")
+	fs.BoolVar(&c.DisableSSA, "disable-ssa", c.DisableSSA, "Update NamespaceQuota status with a merge patch instead of server-side apply (for API servers without SSA)")
+	fs.BoolVar(&c.RequireCgroupV2, "require-cgroup-v2", c.RequireCgroupV2, "Refuse to apply limits on cgroup v1 nodes (set to false to run in degraded mode)")
+	fs.BoolVar(&c.LeaderElect, "leader-elect", c.LeaderElect, "Enable leader election so only one agent replica reconciles at a time")
+	fs.DurationVar(&c.LeaderElectLeaseDuration.Duration, "leader-elect-lease-duration", c.LeaderElectLeaseDuration.Duration, "Duration non-leaders wait before trying to acquire the lease")
+	fs.DurationVar(&c.LeaderElectRenewDeadline.Duration, "leader-elect-renew-deadline", c.LeaderElectRenewDeadline.Duration, "Duration the leader retries refreshing the lease before giving up")
+	fs.DurationVar(&c.LeaderElectRetryPeriod.Duration, "leader-elect-retry-period", c.LeaderElectRetryPeriod.Duration, "Duration between leader election attempts")
+	fs.StringVar(&c.OTelEndpoint, "otel-endpoint", c.OTelEndpoint, "OTLP gRPC endpoint (host:port) for trace export (tracing disabled if empty)")
+	fs.StringVar(&c.OTelServiceName, "otel-service-name", c.OTelServiceName, "Service name reported on exported traces")
+	fs.StringVar(&c.WebhookPort, "webhook-port", c.WebhookPort, "Port for the admission webhook server")
+	fs.StringVar(&c.TLSCertFile, "tls-cert-file", c.TLSCertFile, "TLS certificate for the webhook server (webhook disabled if empty)")
+	fs.StringVar(&c.TLSKeyFile, "tls-key-file", c.TLSKeyFile, "TLS private key for the webhook server (webhook disabled if empty)")
+	fs.IntVar(&c.AdmissionMemoryThreshold, "admission-memory-threshold", c.AdmissionMemoryThreshold, "Percentage of its memory limit above which new pods of a namespace are rejected by the pod admission webhook (0 disables)")
+}
+
+// Validate reports the first invalid setting
+func (c *AgentConfig) Validate() error {
+	if _, err := logrus.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("invalid logLevel: %w", err)
+	}
+	if err := ValidateLogOutput(c.LogOutput); err != nil {
+		return err
+	}
+	if err := validatePort(c.MetricsPort); err != nil {
+		return fmt.Errorf("invalid metricsPort: %w", err)
+	}
+	if !metricsNamespacePattern.MatchString(c.MetricsNamespace) {
+		return fmt.Errorf("invalid metricsNamespace %q: must match %s", c.MetricsNamespace, metricsNamespacePattern)
+	}
+	if (c.MetricsTLSCert == "") != (c.MetricsTLSKey == "") {
+		return fmt.Errorf("metricsTLSCert and metricsTLSKey must be set together")
+	}
+	if (c.MetricsAuthUser == "") != (c.MetricsAuthPasswordHash == "") {
+		return fmt.Errorf("metricsAuthUser and metricsAuthPasswordHash must be set together")
+	}
+	if c.MetricsAuthPasswordHash != "" {
+		if _, err := bcrypt.Cost([]byte(c.MetricsAuthPasswordHash)); err != nil {
+			return fmt.Errorf("invalid metricsAuthPasswordHash: %w", err)
+		}
+	}
+	if err := validatePort(c.WebhookPort); err != nil {
+		return fmt.Errorf("invalid webhookPort: %w", err)
+	}
+	if c.AdmissionMemoryThreshold < 0 || c.AdmissionMemoryThreshold > 100 {
+		return fmt.Errorf("invalid admissionMemoryThreshold: must be between 0 and 100, got %d", c.AdmissionMemoryThreshold)
+	}
+	if c.CPUPeriod < MinCPUPeriod || c.CPUPeriod > MaxCPUPeriod {
+		return fmt.Errorf("invalid cpuPeriod: must be between %d and %d us, got %d", MinCPUPeriod, MaxCPUPeriod, c.CPUPeriod)
+	}
+	if c.Workers < 1 {
+		return fmt.Errorf("invalid workers: must be at least 1, got %d", c.Workers)
+	}
+	if c.MaxRetries < -1 {
+		return fmt.Errorf("invalid maxRetries: must be -1 (unlimited) or more, got %d", c.MaxRetries)
+	}
+	if c.RetryBaseDelay.Duration <= 0 {
+		return fmt.Errorf("invalid retryBaseDelay: must be positive")
+	}
+	if c.RetryMaxDelay.Duration < c.RetryBaseDelay.Duration {
+		return fmt.Errorf("invalid retryMaxDelay: must be at least retryBaseDelay (%s), got %s", c.RetryBaseDelay.Duration, c.RetryMaxDelay.Duration)
+	}
+	if c.OOMEventRateLimit.Duration < 0 {
+		return fmt.Errorf("invalid oomEventRateLimit: must not be negative, got %s", c.OOMEventRateLimit.Duration)
+	}
+	if _, err := labels.Parse(c.NamespaceFilterLabel); err != nil {
+		return fmt.Errorf("invalid namespaceFilterLabel %q: %w", c.NamespaceFilterLabel, err)
+	}
+	if c.SystemdCallRate <= 0 {
+		return fmt.Errorf("invalid systemdCallRate: must be positive, got %g", c.SystemdCallRate)
+	}
+	if c.SystemdCallBurst < 1 {
+		return fmt.Errorf("invalid systemdCallBurst: must be at least 1, got %d", c.SystemdCallBurst)
+	}
+	if c.PriorityClassWeightDivisor < 1 || c.PriorityClassWeightDivisor > math.MaxInt32 {
+		return fmt.Errorf("invalid priorityClassWeightDivisor: must be between 1 and %d, got %d", math.MaxInt32, c.PriorityClassWeightDivisor)
+	}
+	if c.EventRateLimit < 0 {
+		return fmt.Errorf("invalid eventRateLimit: must not be negative, got %g", c.EventRateLimit)
+	}
+	if c.EventBurst < 1 {
+		return fmt.Errorf("invalid eventBurst: must be at least 1, got %d", c.EventBurst)
+	}
+	if c.SystemdTimeout.Duration <= 0 {
+		return fmt.Errorf("invalid systemdTimeout: must be positive")
+	}
+	switch c.SystemdExecutor {
+	case "", SystemdExecutorNsenter, SystemdExecutorDirect, SystemdExecutorNoop:
+	default:
+		return fmt.Errorf("invalid systemdExecutor: must be %s, %s or %s, got %q",
+			SystemdExecutorNsenter, SystemdExecutorDirect, SystemdExecutorNoop, c.SystemdExecutor)
+	}
+	if c.ReconcileInterval.Duration < 0 {
+		return fmt.Errorf("invalid reconcileInterval: must not be negative")
+	}
+	if c.ShutdownTimeout.Duration < 0 {
+		return fmt.Errorf("invalid shutdownTimeout: must not be negative")
+	}
+	if c.ResyncPeriod.Duration < MinResyncPeriod {
+		return fmt.Errorf("invalid resyncPeriod: must be at least %s, got %s", MinResyncPeriod, c.ResyncPeriod.Duration)
+	}
+	if c.ReportInterval.Duration < 0 {
+		return fmt.Errorf("invalid reportInterval: must not be negative")
+	}
+	if c.CgroupRoot == "" || c.SlicePrefix == "" {
+		return fmt.Errorf("cgroupRoot and slicePrefix are required")
+	}
+	if c.SlicePrefixConfigMap != "" && c.SlicePrefixConfigMapNamespace == "" {
+		return fmt.Errorf("slicePrefixConfigMapNamespace is required with slicePrefixConfigMap")
+	}
+	for _, attribute := range c.CgroupAttributeAllowlist() {
+		if !cgroupAttributePattern.MatchString(attribute) {
+			return fmt.Errorf("invalid allowedCgroupAttributes: %q is not a cgroup file name", attribute)
+		}
+	}
+	return nil
+}
+
+// CgroupAttributeAllowlist splits AllowedCgroupAttributes into file names
+func (c *AgentConfig) CgroupAttributeAllowlist() []string {
+	var attributes []string
+	for attribute := range strings.SplitSeq(c.AllowedCgroupAttributes, ",") {
+		if attribute = strings.TrimSpace(attribute); attribute != "" {
+			attributes = append(attributes, attribute)
+		}
+	}
+	return attributes
+}
+
+// ValidateSlicePrefix checks that prefix names a single slice unit, such as
+// "team-a.slice"
+func ValidateSlicePrefix(prefix string) error {
+	if !strings.HasSuffix(prefix, ".slice") || prefix == ".slice" {
+		return fmt.Errorf("slice prefix %q must be a slice name ending in .slice", prefix)
+	}
+	if strings.ContainsAny(prefix, "/ ") {
+		return fmt.Errorf("slice prefix %q must not contain slashes or spaces", prefix)
+	}
+	return nil
+}
+
+func validatePort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return fmt.Errorf("port %q is not a number", port)
+	}
+	if n < 1 || n > 65535 {
+		return fmt.Errorf("port %d out of range 1-65535", n)
+	}
+	return nil
+}
+
+// ExplicitFlags returns the flags set on the command line, except exclude
+func ExplicitFlags(fs *flag.FlagSet, exclude ...string) map[string]string {
+	explicit := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+	for _, name := range exclude {
+		delete(explicit, name)
+	}
+	return explicit
+}
+
+// LoadConfigFile decodes the YAML file at path into cfg, then applies the
+// explicit flag values through fs so they take precedence over the file.
+// The flags of fs must be bound to fields of cfg.
+func LoadConfigFile(path string, cfg any, fs *flag.FlagSet, explicit map[string]string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	for name, value := range explicit {
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("failed to apply flag --%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ChangedConfigFields returns the config file keys of the fields that differ
+// between two configurations of the same struct type
+func ChangedConfigFields(current, reloaded any) []string {
+	a, b := reflect.ValueOf(current), reflect.ValueOf(reloaded)
+	var changed []string
+	for i := 0; i < a.NumField(); i++ {
+		if reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			continue
+		}
+		field := a.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+		changed = append(changed, name)
+	}
+	return changed
+}
+
+// LoadAgentConfig builds the agent configuration from the defaults, the YAML
+// file at path and the explicit flags, in increasing order of precedence.
+func LoadAgentConfig(path string, explicit map[string]string) (AgentConfig, error) {
+	cfg := DefaultAgentConfig()
+	fs := flag.NewFlagSet("agent", flag.ContinueOnError)
+	cfg.BindFlags(fs)
+
+	if err := LoadConfigFile(path, &cfg, fs, explicit); err != nil {
+		return AgentConfig{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return AgentConfig{}, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,22 @@
+package agent
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestChangedConfigFields(t *testing.T) {
+	current := DefaultAgentConfig()
+	reloaded := DefaultAgentConfig()
+	if changed := ChangedConfigFields(current, reloaded); len(changed) != 0 {
+		t.Errorf("ChangedConfigFields() of equal configs = %q, want none", changed)
+	}
+
+	reloaded.Workers++
+	reloaded.CgroupRoot = "/tmp/cgroup"
+	reloaded.PriorityClassWeightDivisor = 0
+	want := []string{"cgroupRoot", "workers", "priorityClassWeightDivisor"}
+	if changed := ChangedConfigFields(current, reloaded); !slices.Equal(changed, want) {
+		t.Errorf("ChangedConfigFields() = %q, want %q", changed, want)
+	}
+}
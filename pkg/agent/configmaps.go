@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/api/v1alpha1"
+)
+
+// newConfigMapInformer watches ConfigMaps so the quotas reading their limits
+// from one (cpuFromConfigMapKeyRef, memoryFromConfigMapKeyRef) are reconciled
+// when it changes. It is only started by the replica running the controller.
+func (c *Controller) newConfigMapInformer() cache.SharedIndexInformer {
+	factory := informers.NewSharedInformerFactory(c.k8sClient.GetClientset(), c.resyncPeriod)
+	informer := factory.Core().V1().ConfigMaps().Informer()
+
+	// Only the metadata is needed to find the quotas; the reconcile reads the
+	// values from the API
+	if err := informer.SetTransform(func(obj interface{}) (interface{}, error) {
+		if configMap, ok := obj.(*corev1.ConfigMap); ok {
+			configMap.Data = nil
+			configMap.BinaryData = nil
+			configMap.ManagedFields = nil
+		}
+		return obj, nil
+	}); err != nil {
+		c.log.WithError(err).Warn("Failed to set ConfigMap informer transform")
+	}
+
+	informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			// Existing ConfigMaps are covered by the initial reconcile
+			if !isInInitialList {
+				c.enqueueConfigMapQuotas(obj)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldConfigMap, ok1 := oldObj.(*corev1.ConfigMap)
+			newConfigMap, ok2 := newObj.(*corev1.ConfigMap)
+			// Resyncs replay unchanged objects
+			if ok1 && ok2 && oldConfigMap.ResourceVersion == newConfigMap.ResourceVersion {
+				return
+			}
+			c.enqueueConfigMapQuotas(newObj)
+		},
+		DeleteFunc: c.enqueueConfigMapQuotas,
+	})
+
+	return informer
+}
+
+// enqueueConfigMapQuotas enqueues every quota reading a limit from the
+// ConfigMap obj
+func (c *Controller) enqueueConfigMapQuotas(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	configMap, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return
+	}
+
+	quotas, err := c.lister.List(labels.Everything())
+	if err != nil {
+		c.log.WithError(err).Warn("Failed to list NamespaceQuotas")
+		return
+	}
+	for _, quota := range quotas {
+		if !referencesConfigMap(&quota.Spec, configMap) {
+			continue
+		}
+		key, err := cache.MetaNamespaceKeyFunc(quota)
+		if err != nil {
+			c.log.WithError(err).Error("Failed to get key for ConfigMap event")
+			continue
+		}
+		c.log.WithFields(logrus.Fields{
+			"key":        key,
+			"namespace":  configMap.Namespace,
+			"config_map": configMap.Name,
+		}).Debug("ConfigMap event received")
+		c.reconciler.forgetGeneration(key)
+		c.workqueue.Add(key)
+	}
+}
+
+func referencesConfigMap(spec *v1alpha1.NamespaceQuotaSpec, configMap *corev1.ConfigMap) bool {
+	if spec.Namespace != configMap.Namespace {
+		return false
+	}
+	return (spec.CPUFromConfigMapKeyRef != nil && spec.CPUFromConfigMapKeyRef.Name == configMap.Name) ||
+		(spec.MemoryFromConfigMapKeyRef != nil && spec.MemoryFromConfigMapKeyRef.Name == configMap.Name)
+}
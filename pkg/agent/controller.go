@@ -2,44 +2,221 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/watch"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	"k8s.io/client-go/util/workqueue"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/agent/report"
+	"github.com/fulcro-cloud/namespace-isolation/pkg/api/v1alpha1"
+	"github.com/fulcro-cloud/namespace-isolation/pkg/client/informers/externalversions"
+	listers "github.com/fulcro-cloud/namespace-isolation/pkg/client/listers/brasa/v1alpha1"
 )
 
 const (
-	maxRetries   = 5
-	resyncPeriod = 30 * time.Second
+	DefaultWorkers = 2
+
+	// DefaultResyncPeriod is how often informers replay their cache as
+	// updates; MinResyncPeriod is the lowest accepted value.
+	DefaultResyncPeriod = 30 * time.Second
+	MinResyncPeriod     = 10 * time.Second
+
+	// DefaultMaxRetries is how often a failed reconcile is retried before the
+	// key is dropped until its next change or periodic reconcile
+	DefaultMaxRetries = 5
+
+	DefaultRetryBaseDelay = 500 * time.Millisecond
+	DefaultRetryMaxDelay  = 5 * time.Minute
+
+	DefaultReconcileInterval = 5 * time.Minute
+	DefaultShutdownTimeout   = 30 * time.Second
+
+	reasonCgroupConfigured   = "CgroupConfigured"
+	reasonCgroupFailed       = "CgroupFailed"
+	reasonCgroupRemoved      = "CgroupRemoved"
+	reasonQuotaDisabled      = "QuotaDisabled"
+	reasonMaxRetries         = "MaxRetriesExceeded"
+	reasonOOMKilled          = "OOMKilled"
+	reasonNamespaceNotFound  = "NamespaceNotFound"
+	reasonExceedsAllocatable = "ExceedsAllocatable"
+
+	// cgroupCleanupFinalizer keeps a NamespaceQuota around until its cgroup
+	// slice has been removed, so a crash during deletion cannot leak slices.
+	cgroupCleanupFinalizer = "brasa.cloud/cgroup-cleanup"
+
+	dryRunStatusMessage = "dry-run: planned"
 
-	reasonCgroupConfigured = "CgroupConfigured"
-	reasonCgroupFailed     = "CgroupFailed"
-	reasonCgroupRemoved    = "CgroupRemoved"
-	reasonQuotaDisabled    = "QuotaDisabled"
+	// workqueueName labels the work queue metrics
+	workqueueName = "namespacequota"
+
+	// fastWatchRetryInterval is the wait before reopening a failed fast watch
+	fastWatchRetryInterval = 5 * time.Second
+
+	leaderElectionLeaseName = "namespace-isolator-agent"
+	defaultLeaseNamespace   = "kube-system"
 )
 
+// ErrNoNamespaceQuota is returned by EnsureNamespaceSlice for namespaces
+// without a NamespaceQuota
+var ErrNoNamespaceQuota = errors.New("no NamespaceQuota for namespace")
+
+type LeaderElectionConfig struct {
+	Enabled       bool
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
 type ControllerConfig struct {
-	Kubeconfig    string
-	CgroupRoot    string
-	SlicePrefix   string
-	Log           *logrus.Logger
-	MetricsServer *MetricsServer
+	Kubeconfig string
+	// NodeName is the node the agent runs on, used to evaluate NamespaceQuota
+	// node selectors
+	NodeName    string
+	CgroupRoot  string
+	SlicePrefix string
+	CPUPeriodUs int64
+	// SlicePrefixOverrides places the slices of individual namespaces under
+	// another parent slice (key=namespace, value=prefix)
+	SlicePrefixOverrides map[string]string
+	Workers              int
+	// MaxRetries is how often a failed reconcile is retried; -1 retries forever
+	MaxRetries int
+	// NamespaceFilterLabel (a label selector) and NamespacePrefix restrict the
+	// namespaces whose quotas are managed; empty values match every namespace
+	NamespaceFilterLabel string
+	NamespacePrefix      string
+	// RetryBaseDelay and RetryMaxDelay bound the jittered exponential backoff
+	// between retries
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	DryRun         bool
+	// ReconcileInterval is how often every known quota is re-enqueued to
+	// detect cgroup drift; zero disables the periodic pass.
+	ReconcileInterval time.Duration
+	// ResyncPeriod is the informer resync interval; zero uses DefaultResyncPeriod
+	ResyncPeriod time.Duration
+	// ShutdownTimeout bounds how long in-flight reconciles may run after the
+	// controller is stopped before their context is cancelled.
+	ShutdownTimeout time.Duration
+	// ReportInterval is how often a report of all managed namespaces is
+	// logged; zero disables reports.
+	ReportInterval time.Duration
+	// AutoCreateFromAnnotations creates NamespaceQuotas from the
+	// brasa.cloud/cpu-limit and brasa.cloud/memory-limit namespace annotations.
+	AutoCreateFromAnnotations bool
+	// EnablePolicies creates NamespaceQuotas for the namespaces selected by
+	// NamespaceIsolationPolicies
+	EnablePolicies bool
+	// CleanupOrphans removes slices without a NamespaceQuota at startup
+	CleanupOrphans bool
+	// ResyncOnStartup makes the first reconcile of each quota after startup,
+	// or after regaining the leader lease, check its slice even if its
+	// generation was already applied
+	ResyncOnStartup bool
+	// EmitEventsForOOM emits an OOMKilled event on the namespace when a
+	// process of its slice is OOM killed, at most once per OOMEventInterval
+	// (zero emits every kill)
+	EmitEventsForOOM bool
+	OOMEventInterval time.Duration
+	// FastWatch runs a second watch on NamespaceQuotas that enqueues changes
+	// as soon as they arrive, without waiting for the informer to process them
+	FastWatch bool
+	// UseResourceQuotaFallback takes the CPU and memory limits missing from a
+	// NamespaceQuota from the namespace's ResourceQuota limits.cpu/limits.memory
+	UseResourceQuotaFallback bool
+	// PriorityClassWeightDivisor is the PriorityClass value worth one
+	// CPUWeight point for quotas with a priorityClass; zero uses
+	// DefaultPriorityClassWeightDivisor.
+	PriorityClassWeightDivisor int32
+	// SystemdCallRate (calls per second) and SystemdCallBurst bound the
+	// systemctl calls made while applying limits; zero uses the defaults.
+	SystemdCallRate  float64
+	SystemdCallBurst int
+	// SystemdTimeout bounds each systemctl call; zero uses DefaultSystemdTimeout
+	SystemdTimeout time.Duration
+	// SystemdExecutor selects how systemctl is run (see NewSystemd)
+	SystemdExecutor string
+	// WaitForSliceReady makes each slice update wait until the kernel
+	// reports the new CPU and memory limits
+	WaitForSliceReady bool
+	// AllowedCgroupAttributes are the cgroup files quotas may set through
+	// rawAttributes
+	AllowedCgroupAttributes []string
+	// DisableSSA writes status with a merge patch instead of server-side apply
+	DisableSSA bool
+	// EventRateLimit (events per second) and EventBurst throttle the
+	// Kubernetes events emitted; zero EventRateLimit disables throttling and
+	// zero EventBurst uses DefaultEventBurst.
+	EventRateLimit rate.Limit
+	EventBurst     int
+	// RequireCgroupV2 makes reconciles fail on cgroup v1 nodes instead of
+	// applying limits in degraded mode
+	RequireCgroupV2 bool
+	Log             *logrus.Logger
+	MetricsServer   *MetricsServer
+
+	LeaderElection LeaderElectionConfig
 }
 
 type Controller struct {
-	k8sClient     *K8sClient
-	cgroupManager *CgroupManager
-	metricsServer *MetricsServer
-	informer      cache.SharedIndexInformer
-	workqueue     workqueue.TypedRateLimitingInterface[string]
-	log           *logrus.Logger
+	k8sClient         *K8sClient
+	cgroupManager     *CgroupManager
+	metricsServer     *MetricsServer
+	informer          cache.SharedIndexInformer
+	namespaceInformer cache.SharedIndexInformer
+	configMapInformer cache.SharedIndexInformer
+	policyController  *PolicyController
+	lister            listers.NamespaceQuotaLister
+	workqueue         workqueue.TypedRateLimitingInterface[string]
+	workers           int
+	maxRetries        int
+	reconcileInterval time.Duration
+	shutdownTimeout   time.Duration
+	resyncPeriod      time.Duration
+	reportInterval    time.Duration
+	reporter          *report.ReportGenerator
+	cleanupOrphans    bool
+	resyncOnStartup   bool
+	fastWatch         bool
+	emitOOMEvents     bool
+	oomEventInterval  time.Duration
+	autoCreate        bool
+	reconciler        *NamespaceQuotaReconciler
+	log               *logrus.Logger
+
+	// inFlight counts reconciles in progress, which shutdown waits for.
+	// stopping, guarded by inFlightMu, keeps new reconciles from starting.
+	inFlight   sync.WaitGroup
+	inFlightMu sync.Mutex
+	stopping   bool
+
+	leaderElection LeaderElectionConfig
+	leading        atomic.Bool
+
+	// cacheReady is set once the informer cache has synced, and
+	// initialReconciled once every key present at that point was processed.
+	cacheReady        atomic.Bool
+	initialReconciled atomic.Bool
+	initialMu         sync.Mutex
+	initialPending    map[string]struct{}
 }
 
 func NewController(config ControllerConfig) (*Controller, error) {
@@ -47,34 +224,125 @@ func NewController(config ControllerConfig) (*Controller, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create k8s client: %w", err)
 	}
+	k8sClient.DisableSSA = config.DisableSSA
+	if config.EventRateLimit > 0 {
+		eventBurst := config.EventBurst
+		if eventBurst < 1 {
+			eventBurst = DefaultEventBurst
+		}
+		k8sClient.EventLimiter = NewEventLimiter(config.EventRateLimit, eventBurst)
+	}
 
-	cgroupManager := NewCgroupManager(config.CgroupRoot, config.SlicePrefix, config.Log)
+	callRate, callBurst := config.SystemdCallRate, config.SystemdCallBurst
+	if callRate <= 0 {
+		callRate = DefaultSystemdCallRate
+	}
+	if callBurst < 1 {
+		callBurst = DefaultSystemdCallBurst
+	}
+	systemdTimeout := config.SystemdTimeout
+	if systemdTimeout <= 0 {
+		systemdTimeout = DefaultSystemdTimeout
+	}
+	systemd, err := NewSystemd(config.SystemdExecutor, config.Log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create systemd executor: %w", err)
+	}
+	cgroupManager, err := NewCgroupManager(config.CgroupRoot, config.SlicePrefix, config.CPUPeriodUs, config.Log,
+		WithSystemdCallLimiter(NewSystemdCallLimiter(callRate, callBurst)),
+		WithRequireCgroupV2(config.RequireCgroupV2),
+		WithSystemdTimeout(systemdTimeout),
+		WithSystemd(systemd),
+		WithWaitForSliceReady(config.WaitForSliceReady),
+		WithSlicePrefixOverrides(config.SlicePrefixOverrides),
+		WithAllowedCgroupAttributes(config.AllowedCgroupAttributes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cgroup manager: %w", err)
+	}
 
-	rateLimiter := workqueue.DefaultTypedControllerRateLimiter[string]()
-	queue := workqueue.NewTypedRateLimitingQueue(rateLimiter)
+	workers := config.Workers
+	if workers < 1 {
+		workers = DefaultWorkers
+	}
 
-	resource := k8sClient.GetDynamicClient().Resource(NamespaceQuotaGVR)
-	informer := cache.NewSharedIndexInformer(
-		&cache.ListWatch{
-			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
-				return resource.List(context.Background(), options)
-			},
-			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
-				return resource.Watch(context.Background(), options)
-			},
-		},
-		&unstructured.Unstructured{},
-		resyncPeriod,
-		cache.Indexers{},
-	)
+	resyncPeriod := config.ResyncPeriod
+	if resyncPeriod <= 0 {
+		resyncPeriod = DefaultResyncPeriod
+	}
+
+	maxRetries := config.MaxRetries
+	if maxRetries < 0 {
+		maxRetries = math.MaxInt
+	}
+
+	cgroupManager.DryRun = config.DryRun
+
+	var namespaceSelector labels.Selector
+	if config.NamespaceFilterLabel != "" {
+		namespaceSelector, err = labels.Parse(config.NamespaceFilterLabel)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace filter label %q: %w", config.NamespaceFilterLabel, err)
+		}
+	}
+
+	retryBaseDelay := config.RetryBaseDelay
+	if retryBaseDelay <= 0 {
+		retryBaseDelay = DefaultRetryBaseDelay
+	}
+	retryMaxDelay := config.RetryMaxDelay
+	if retryMaxDelay <= 0 {
+		retryMaxDelay = DefaultRetryMaxDelay
+	}
+
+	rateLimiter := NewRetryRateLimiter(retryBaseDelay, retryMaxDelay)
+	queue := workqueue.NewTypedRateLimitingQueueWithConfig(rateLimiter,
+		workqueue.TypedRateLimitingQueueConfig[string]{Name: workqueueName})
+
+	informerFactory := externalversions.NewSharedInformerFactory(k8sClient.GetQuotaClientset(), resyncPeriod)
+	quotaInformer := informerFactory.Brasa().V1alpha1().NamespaceQuotas()
+	informer := quotaInformer.Informer()
+
+	lister := quotaInformer.Lister()
+	reconciler := &NamespaceQuotaReconciler{
+		k8sClient:             k8sClient,
+		cgroupManager:         cgroupManager,
+		metricsServer:         config.MetricsServer,
+		lister:                lister,
+		log:                   config.Log,
+		nodeName:              config.NodeName,
+		resourceQuotaFallback: config.UseResourceQuotaFallback,
+		pendingRenames:        map[string]string{},
+		processed:             map[string]processedQuota{},
+		quotaNamespaces:       map[string]string{},
+		lastEventState:        map[string]string{},
+
+		priorityClassWeightDivisor: config.PriorityClassWeightDivisor,
+	}
 
 	controller := &Controller{
-		k8sClient:     k8sClient,
-		cgroupManager: cgroupManager,
-		metricsServer: config.MetricsServer,
-		informer:      informer,
-		workqueue:     queue,
-		log:           config.Log,
+		k8sClient:         k8sClient,
+		cgroupManager:     cgroupManager,
+		metricsServer:     config.MetricsServer,
+		informer:          informer,
+		lister:            lister,
+		workqueue:         queue,
+		workers:           workers,
+		maxRetries:        maxRetries,
+		reconcileInterval: config.ReconcileInterval,
+		shutdownTimeout:   config.ShutdownTimeout,
+		resyncPeriod:      resyncPeriod,
+		reportInterval:    config.ReportInterval,
+		reporter:          report.NewReportGenerator(lister, reportCgroupReader{cgroupManager}),
+		cleanupOrphans:    config.CleanupOrphans,
+		resyncOnStartup:   config.ResyncOnStartup,
+		fastWatch:         config.FastWatch,
+		emitOOMEvents:     config.EmitEventsForOOM,
+		oomEventInterval:  config.OOMEventInterval,
+		autoCreate:        config.AutoCreateFromAnnotations,
+		reconciler:        reconciler,
+		log:               config.Log,
+
+		leaderElection: config.LeaderElection,
 	}
 
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -83,10 +351,111 @@ func NewController(config ControllerConfig) (*Controller, error) {
 		DeleteFunc: controller.onDelete,
 	})
 
+	var namespaceLister corelisters.NamespaceLister
+	controller.namespaceInformer, namespaceLister = controller.newNamespaceInformer(config.NamespaceFilterLabel)
+	reconciler.namespaceFilter = namespaceFilter{
+		selector: namespaceSelector,
+		prefix:   config.NamespacePrefix,
+		lister:   namespaceLister,
+	}
+	if config.AutoCreateFromAnnotations {
+		controller.addAnnotationHandlers(controller.namespaceInformer)
+	}
+	controller.configMapInformer = controller.newConfigMapInformer()
+	if config.EnablePolicies {
+		controller.policyController = NewPolicyController(k8sClient, informer, lister, resyncPeriod, maxRetries, config.Log)
+	}
+
 	return controller, nil
 }
 
+// Run starts the controller, first acquiring the leader lease when leader
+// election is enabled. It blocks until ctx is cancelled or the lease is lost.
 func (c *Controller) Run(ctx context.Context) error {
+	if !c.leaderElection.Enabled {
+		return c.run(ctx)
+	}
+
+	lock, err := c.newLeaseLock()
+	if err != nil {
+		return err
+	}
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   c.leaderElection.LeaseDuration,
+		RenewDeadline:   c.leaderElection.RenewDeadline,
+		RetryPeriod:     c.leaderElection.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            leaderElectionLeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				c.log.Info("Acquired leader lease")
+				c.setLeaderStatus(true)
+				if err := c.run(ctx); err != nil {
+					c.log.WithError(err).Error("Controller exited with error")
+				}
+			},
+			OnStoppedLeading: func() {
+				c.log.Info("Stopped leading")
+				c.setLeaderStatus(false)
+			},
+			OnNewLeader: func(identity string) {
+				if identity != lock.Identity() {
+					c.log.WithField("leader", identity).Info("New leader elected")
+				}
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create leader elector: %w", err)
+	}
+
+	c.setLeaderStatus(false)
+	c.log.WithField("identity", lock.Identity()).Info("Waiting for leader lease")
+	elector.Run(ctx)
+
+	if ctx.Err() == nil {
+		return fmt.Errorf("leader election lost")
+	}
+	return nil
+}
+
+func (c *Controller) newLeaseLock() (*resourcelock.LeaseLock, error) {
+	identity := os.Getenv("POD_NAME")
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine leader election identity: %w", err)
+		}
+		identity = hostname
+	}
+
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		namespace = defaultLeaseNamespace
+	}
+
+	return &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      leaderElectionLeaseName,
+			Namespace: namespace,
+		},
+		Client: c.k8sClient.GetClientset().CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}, nil
+}
+
+func (c *Controller) setLeaderStatus(leader bool) {
+	c.leading.Store(leader)
+	if c.metricsServer != nil {
+		c.metricsServer.SetLeaderElectionStatus(leader)
+	}
+}
+
+func (c *Controller) run(ctx context.Context) error {
 	defer c.workqueue.ShutDown()
 
 	c.log.Info("Starting controller")
@@ -98,169 +467,485 @@ func (c *Controller) Run(ctx context.Context) error {
 		return fmt.Errorf("failed to sync informer cache")
 	}
 	c.log.Info("Informer cache synced")
+	c.startInitialReconcile(c.informer.GetStore().ListKeys())
+	if c.cleanupOrphans {
+		c.cleanupOrphanSlices()
+	}
+	c.checkStaleQuotas(ctx)
+	c.cacheReady.Store(true)
+
+	// Started after the quota cache has synced, so namespace and ConfigMap
+	// events can check the lister
+	if c.autoCreate {
+		c.log.Info("Creating NamespaceQuotas from namespace annotations")
+	}
+	go c.namespaceInformer.Run(ctx.Done())
+	go c.configMapInformer.Run(ctx.Done())
+	// The namespace filter reads the namespace labels from its cache
+	if !cache.WaitForCacheSync(ctx.Done(), c.namespaceInformer.HasSynced) {
+		return fmt.Errorf("failed to sync namespace informer cache")
+	}
+	if c.policyController != nil {
+		go c.policyController.Run(ctx)
+	}
+
+	// Reconciles get a context that survives ctx, so a shutdown lets
+	// in-flight systemd calls and API patches finish instead of aborting them.
+	workCtx, forceCancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer forceCancel()
 
-	c.log.Info("Starting worker")
-	go c.runWorker(ctx)
+	c.log.WithField("workers", c.workers).Info("Starting workers")
+	for i := 0; i < c.workers; i++ {
+		go c.runWorker(workCtx)
+	}
+
+	if c.reconcileInterval > 0 {
+		go c.runPeriodicReconcile(ctx)
+	}
+	if c.reportInterval > 0 {
+		go c.runPeriodicReport(ctx)
+	}
+	if c.fastWatch {
+		go c.runFastWatch(ctx)
+	}
+	if c.emitOOMEvents && c.cgroupManager.GetCgroupVersion() != 1 {
+		go c.runOOMWatch(ctx)
+	}
+	go c.cgroupManager.RunSystemdProbe(ctx, SystemdProbeInterval, c.onSystemdHealthChange)
 
 	<-ctx.Done()
 	c.log.Info("Shutting down controller")
 
+	c.inFlightMu.Lock()
+	c.stopping = true
+	c.inFlightMu.Unlock()
+
+	c.workqueue.ShutDown()
+	c.waitForInFlight(forceCancel)
+
 	return nil
 }
 
-func (c *Controller) runWorker(ctx context.Context) {
-	for c.processNextItem(ctx) {
+// beginReconcile registers an in-flight reconcile, unless shutdown has started
+func (c *Controller) beginReconcile() bool {
+	c.inFlightMu.Lock()
+	defer c.inFlightMu.Unlock()
+
+	if c.stopping {
+		return false
 	}
+	c.inFlight.Add(1)
+	return true
 }
 
-func (c *Controller) processNextItem(ctx context.Context) bool {
-	key, shutdown := c.workqueue.Get()
-	if shutdown {
-		return false
+// waitForInFlight waits up to the shutdown timeout for running reconciles,
+// then cancels them.
+func (c *Controller) waitForInFlight(forceCancel context.CancelFunc) {
+	done := make(chan struct{})
+	go func() {
+		c.inFlight.Wait()
+		close(done)
+	}()
+
+	timeout := c.shutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
 	}
-	defer c.workqueue.Done(key)
 
-	err := c.reconcile(ctx, key)
-	if err == nil {
-		c.workqueue.Forget(key)
-		return true
+	select {
+	case <-done:
+		c.log.Info("In-flight reconciles finished")
+	case <-time.After(timeout):
+		c.log.WithField("timeout", timeout).Warn("Shutdown timeout expired, cancelling in-flight reconciles")
+		forceCancel()
+		<-done
 	}
+}
 
-	if c.workqueue.NumRequeues(key) < maxRetries {
-		c.log.WithFields(logrus.Fields{
-			"key":     key,
-			"error":   err,
-			"retries": c.workqueue.NumRequeues(key),
-		}).Warn("Error processing item, retrying")
-		c.workqueue.AddRateLimited(key)
-		return true
+// cleanupOrphanSlices removes slices left behind by quotas deleted while the
+// agent was not running.
+func (c *Controller) cleanupOrphanSlices() {
+	namespaces, err := c.cgroupManager.ListSlices()
+	if err != nil {
+		c.log.WithError(err).Warn("Failed to list slices for orphan cleanup")
+		return
 	}
 
-	c.log.WithFields(logrus.Fields{
-		"key":   key,
-		"error": err,
-	}).Error("Max retries exceeded, dropping item")
-	c.workqueue.Forget(key)
+	quotas, err := c.lister.List(labels.Everything())
+	if err != nil {
+		c.log.WithError(err).Warn("Failed to list quotas for orphan cleanup")
+		return
+	}
+	managed := make(map[string]bool, len(quotas))
+	for _, quota := range quotas {
+		managed[quota.Spec.Namespace] = true
+	}
 
-	return true
+	for _, namespace := range namespaces {
+		if managed[namespace] {
+			continue
+		}
+		log := c.log.WithFields(logrus.Fields{
+			"namespace": namespace,
+			"reason":    "no NamespaceQuota targets this namespace",
+		})
+		if err := c.cgroupManager.RemoveSlice(namespace); err != nil {
+			log.WithError(err).Warn("Failed to remove orphaned slice")
+			continue
+		}
+		if c.metricsServer != nil {
+			c.metricsServer.IncOrphanSlicesCleaned()
+		}
+		log.Info("Removed orphaned slice")
+	}
 }
 
-func (c *Controller) reconcile(ctx context.Context, key string) error {
-	log := c.log.WithField("key", key)
-	log.Debug("Reconciling NamespaceQuota")
+// checkStaleQuotas warns about enabled NamespaceQuotas whose namespace does
+// not exist, e.g. because it was deleted after the quota was created
+func (c *Controller) checkStaleQuotas(ctx context.Context) {
+	managed, err := c.k8sClient.ListManagedNamespaces(ctx)
+	if err != nil {
+		c.log.WithError(err).Warn("Failed to list managed namespaces for the stale quota check")
+		return
+	}
 
-	obj, exists, err := c.informer.GetStore().GetByKey(key)
+	namespaces, err := c.k8sClient.GetClientset().CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to get object from cache: %w", err)
+		c.log.WithError(err).Warn("Failed to list namespaces for the stale quota check")
+		return
+	}
+	existing := make(map[string]bool, len(namespaces.Items))
+	for _, ns := range namespaces.Items {
+		existing[ns.Name] = true
 	}
 
-	if !exists {
-		log.Info("NamespaceQuota deleted, removing cgroup")
-		return c.handleDelete(key)
+	stale := 0
+	for _, namespace := range managed {
+		if existing[namespace] {
+			continue
+		}
+		stale++
+		c.log.WithField("namespace", namespace).Warn("NamespaceQuota targets a namespace that does not exist")
+	}
+	if c.metricsServer != nil {
+		c.metricsServer.SetStaleQuotas(stale)
 	}
+}
 
-	u, ok := obj.(*unstructured.Unstructured)
-	if !ok {
-		return fmt.Errorf("unexpected object type: %T", obj)
+func (c *Controller) runWorker(ctx context.Context) {
+	for c.processNextItem(ctx) {
 	}
+}
 
-	spec, err := ParseNamespaceQuota(u)
-	if err != nil {
-		log.WithError(err).Error("Failed to parse NamespaceQuota")
-		c.updateStatus(ctx, u.GetName(), false, fmt.Sprintf("Parse error: %v", err))
-		c.k8sClient.EmitEventForObject(u, corev1.EventTypeWarning, reasonCgroupFailed,
-			fmt.Sprintf("Failed to parse NamespaceQuota: %v", err))
-		return err
+// CacheSynced implements HealthChecker. Replicas waiting for the leader lease
+// never start their informer and are reported healthy while on standby.
+func (c *Controller) CacheSynced() bool {
+	if c.standby() {
+		return true
 	}
+	return c.cacheReady.Load()
+}
 
-	return c.handleQuota(ctx, u, spec)
+// InitialReconcileDone implements HealthChecker
+func (c *Controller) InitialReconcileDone() bool {
+	if c.standby() {
+		return true
+	}
+	return c.cacheReady.Load() && c.initialReconciled.Load()
 }
 
-func (c *Controller) handleQuota(ctx context.Context, obj *unstructured.Unstructured, spec *NamespaceQuotaSpec) error {
-	name := obj.GetName()
-	log := c.log.WithFields(logrus.Fields{
-		"name":      name,
-		"namespace": spec.Namespace,
-		"cpu":       spec.CPU,
-		"memory":    spec.Memory,
-		"enabled":   spec.Enabled,
+// EnsureNamespaceSlice implements SliceEnsurer. It reconciles the quota of
+// namespace right away unless its slice already exists, so that the NRI
+// plugin can have the slice in place before the first container of a pod.
+func (c *Controller) EnsureNamespaceSlice(ctx context.Context, namespace string) error {
+	if c.standby() || !c.cacheReady.Load() {
+		return fmt.Errorf("controller not ready")
+	}
+	if c.cgroupManager.SliceExists(namespace) {
+		return nil
+	}
+
+	quotas, err := c.lister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list NamespaceQuotas: %w", err)
+	}
+	idx := slices.IndexFunc(quotas, func(q *v1alpha1.NamespaceQuota) bool {
+		return q.Spec.Namespace == namespace
 	})
+	if idx < 0 {
+		return fmt.Errorf("%w %s", ErrNoNamespaceQuota, namespace)
+	}
+
+	if !c.beginReconcile() {
+		return fmt.Errorf("controller shutting down")
+	}
+	defer c.inFlight.Done()
 
-	if !spec.Enabled {
-		log.Info("Quota disabled, removing cgroup if exists")
-		if err := c.cgroupManager.RemoveSlice(spec.Namespace); err != nil {
-			log.WithError(err).Warn("Failed to remove cgroup slice")
+	// A worker may reconcile the same key concurrently; EnsureSlice
+	// serializes per namespace, so both converge on the same slice.
+	c.reconciler.forgetGeneration(quotas[idx].Name)
+	_, err = c.reconciler.Reconcile(ctx, ReconcileRequest{Key: quotas[idx].Name})
+	return err
+}
+
+func (c *Controller) standby() bool {
+	return c.leaderElection.Enabled && !c.leading.Load()
+}
+
+func (c *Controller) startInitialReconcile(keys []string) {
+	c.initialMu.Lock()
+	defer c.initialMu.Unlock()
+
+	c.initialPending = make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		c.initialPending[key] = struct{}{}
+		// The slices may have changed while the agent was down or another
+		// replica was leading
+		if c.resyncOnStartup {
+			c.reconciler.forgetGeneration(key)
 		}
-		c.updateStatus(ctx, name, true, "Quota disabled")
-		c.k8sClient.EmitEventForObject(obj, corev1.EventTypeNormal, reasonQuotaDisabled,
-			"Quota disabled, cgroup removed")
-		return nil
 	}
+	if len(c.initialPending) == 0 {
+		c.initialReconciled.Store(true)
+	}
+}
 
-	log.Info("Ensuring cgroup slice")
-	if err := c.cgroupManager.EnsureSlice(spec.Namespace, spec.CPU, spec.Memory); err != nil {
-		log.WithError(err).Error("Failed to ensure cgroup slice")
-		c.updateStatus(ctx, name, false, fmt.Sprintf("Cgroup error: %v", err))
-		c.k8sClient.EmitEventForObject(obj, corev1.EventTypeWarning, reasonCgroupFailed,
-			fmt.Sprintf("Failed to configure cgroup: %v", err))
-		return err
+// markInitialReconciled records that key has been processed at least once,
+// whether or not its reconciliation succeeded.
+func (c *Controller) markInitialReconciled(key string) {
+	if c.initialReconciled.Load() {
+		return
 	}
 
-	c.updateStatus(ctx, name, true, "Cgroup configured successfully")
-	c.k8sClient.EmitEventForObject(obj, corev1.EventTypeNormal, reasonCgroupConfigured,
-		fmt.Sprintf("Cgroup configured with CPU=%s, Memory=%s", spec.CPU, spec.Memory))
+	c.initialMu.Lock()
+	defer c.initialMu.Unlock()
 
-	c.updateMetrics(spec)
+	delete(c.initialPending, key)
+	if len(c.initialPending) == 0 {
+		c.initialReconciled.Store(true)
+		c.log.Info("Initial reconciliation complete")
+	}
+}
 
-	return nil
+// runPeriodicReconcile re-enqueues every known quota on each tick so that
+// manual changes to the cgroup files are detected and reverted.
+func (c *Controller) runPeriodicReconcile(ctx context.Context) {
+	ticker := time.NewTicker(c.reconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			keys := c.informer.GetStore().ListKeys()
+			c.log.WithField("count", len(keys)).Debug("Enqueueing quotas for drift detection")
+			for _, key := range keys {
+				c.reconciler.forgetGeneration(key)
+				c.workqueue.Add(key)
+			}
+		}
+	}
 }
 
-func (c *Controller) updateMetrics(spec *NamespaceQuotaSpec) {
-	if c.metricsServer == nil {
+// onSystemdHealthChange reconciles every quota once systemd answers again, as
+// quotas skipped while it was unreachable are not retried
+func (c *Controller) onSystemdHealthChange(healthy bool) {
+	if !healthy {
 		return
 	}
+	keys := c.informer.GetStore().ListKeys()
+	c.log.WithField("count", len(keys)).Info("Enqueueing quotas after systemd recovered")
+	for _, key := range keys {
+		c.reconciler.forgetGeneration(key)
+		c.workqueue.Add(key)
+	}
+}
+
+// runFastWatch enqueues added and modified quotas straight from a watch
+// stream. The informer enqueues the same changes once it has updated its
+// cache; this path only saves that processing delay. A reconcile it triggers
+// may still read the previous object from the cache, in which case the
+// informer's event reconciles the change again.
+func (c *Controller) runFastWatch(ctx context.Context) {
+	resourceVersion := c.informer.LastSyncResourceVersion()
+
+	for ctx.Err() == nil {
+		w, err := c.k8sClient.WatchNamespaceQuota(ctx, resourceVersion)
+		if err != nil {
+			c.log.WithError(err).Warn("Failed to open fast watch, retrying")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(fastWatchRetryInterval):
+			}
+			continue
+		}
+		resourceVersion = c.consumeFastWatch(w, resourceVersion)
+	}
+}
+
+// consumeFastWatch handles the events of w until it closes and returns the
+// resource version to resume from
+func (c *Controller) consumeFastWatch(w watch.Interface, resourceVersion string) string {
+	defer w.Stop()
+
+	for event := range w.ResultChan() {
+		switch event.Type {
+		case watch.Added, watch.Modified:
+			quota, ok := event.Object.(*v1alpha1.NamespaceQuota)
+			if !ok {
+				continue
+			}
+			resourceVersion = quota.ResourceVersion
+			key, err := cache.MetaNamespaceKeyFunc(quota)
+			if err != nil {
+				continue
+			}
+			c.log.WithField("key", key).Debug("Fast watch event received")
+			c.workqueue.Add(key)
+		case watch.Deleted, watch.Bookmark:
+			if obj, err := meta.Accessor(event.Object); err == nil {
+				resourceVersion = obj.GetResourceVersion()
+			}
+		case watch.Error:
+			// Usually an expired resource version; restart from the informer's
+			c.log.WithField("error", apierrors.FromObject(event.Object)).Debug("Fast watch interrupted")
+			return c.informer.LastSyncResourceVersion()
+		}
+	}
+	return resourceVersion
+}
+
+// runPeriodicReport logs a report of every managed namespace on each tick
+func (c *Controller) runPeriodicReport(ctx context.Context) {
+	ticker := time.NewTicker(c.reportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.logReport(ctx)
+		}
+	}
+}
 
-	stats, err := c.metricsServer.ReadCgroupStats(spec.Namespace)
+func (c *Controller) logReport(ctx context.Context) {
+	r, err := c.reporter.Generate(ctx)
 	if err != nil {
-		c.log.WithError(err).Debug("Failed to read cgroup stats for metrics")
+		c.log.WithError(err).Warn("Failed to generate report")
 		return
 	}
+	reportGenerated.Inc()
 
-	var cpuLimitUsec, memoryLimitBytes int64
-	if spec.CPU != "" {
-		cpuLimitUsec, _ = ParseCPU(spec.CPU)
+	data, err := r.JSON()
+	if err != nil {
+		c.log.WithError(err).Warn("Failed to encode report")
+		return
 	}
-	if spec.Memory != "" {
-		memoryLimitBytes, _ = ParseMemory(spec.Memory)
+	c.log.WithFields(logrus.Fields{
+		"namespaces":        len(r.Namespaces),
+		"throttled_periods": r.ThrottledPeriods(),
+		"report":            string(data),
+	}).Info("Namespace report")
+}
+
+// reportCgroupReader adapts CgroupManager to report.CgroupReader
+type reportCgroupReader struct {
+	m *CgroupManager
+}
+
+func (r reportCgroupReader) GetCgroupStats(namespace string) (report.Stats, error) {
+	stats, err := r.m.GetCgroupStats(namespace)
+	if err != nil {
+		return report.Stats{}, err
 	}
+	return report.Stats{
+		CPUUsageUsec:     stats.CPUUsageUsec,
+		CPUThrottled:     stats.CPUThrottled,
+		MemoryUsageBytes: stats.MemoryUsageBytes,
+		OOMKills:         stats.OOMKills,
+	}, nil
+}
 
-	c.metricsServer.UpdateMetrics(spec.Namespace, stats, cpuLimitUsec, memoryLimitBytes)
+func (r reportCgroupReader) GetCurrentLimits(namespace string) (report.Limits, error) {
+	cpuQuota, memoryBytes, memoryHigh, cpuWeight, err := r.m.GetCurrentLimits(namespace)
+	if err != nil {
+		return report.Limits{}, err
+	}
+	return report.Limits{
+		CPUQuotaUs:      cpuQuota,
+		MemoryBytes:     memoryBytes,
+		MemoryHighBytes: memoryHigh,
+		CPUWeight:       cpuWeight,
+	}, nil
 }
 
-func (c *Controller) handleDelete(name string) error {
-	c.log.WithField("name", name).Info("Attempting to remove cgroup for deleted quota")
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	key, shutdown := c.workqueue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.workqueue.Done(key)
+	if !c.beginReconcile() {
+		return false
+	}
+	defer c.inFlight.Done()
+	defer c.updateQueueDepth()
 
-	if err := c.cgroupManager.RemoveSlice(name); err != nil {
-		c.log.WithError(err).Warn("Failed to remove cgroup slice on delete")
-	} else {
-		c.k8sClient.EmitEvent(name, corev1.EventTypeNormal, reasonCgroupRemoved,
-			fmt.Sprintf("Cgroup removed for deleted NamespaceQuota %s", name))
+	result, err := c.reconciler.Reconcile(ctx, ReconcileRequest{Key: key})
+	c.markInitialReconciled(key)
+	if err == nil {
+		c.workqueue.Forget(key)
+		switch {
+		case result.RequeueAfter > 0:
+			c.workqueue.AddAfter(key, result.RequeueAfter)
+		case result.Requeue:
+			c.workqueue.AddRateLimited(key)
+		}
+		return true
 	}
 
-	return nil
+	if c.workqueue.NumRequeues(key) < c.maxRetries {
+		c.log.WithFields(logrus.Fields{
+			"key":     key,
+			"error":   err,
+			"retries": c.workqueue.NumRequeues(key),
+		}).Warn("Error processing item, retrying")
+		c.workqueue.AddRateLimited(key)
+		return true
+	}
+
+	c.log.WithFields(logrus.Fields{
+		"key":   key,
+		"error": err,
+	}).Error("Max retries exceeded, dropping item")
+	c.workqueue.Forget(key)
+	c.reportMaxRetriesExceeded(key, err)
+
+	return true
 }
 
-func (c *Controller) updateStatus(ctx context.Context, name string, ready bool, message string) {
-	log := c.log.WithFields(logrus.Fields{
-		"name":    name,
-		"ready":   ready,
-		"message": message,
-	})
+// reportMaxRetriesExceeded records a dropped key in the metrics and as a
+// Warning event on its quota, if the quota still exists
+func (c *Controller) reportMaxRetriesExceeded(key string, err error) {
+	if c.metricsServer != nil {
+		c.metricsServer.IncMaxRetriesExceeded()
+	}
+
+	quota, getErr := c.lister.Get(key)
+	if getErr != nil {
+		return
+	}
+	c.k8sClient.EmitEventForObject(quota, corev1.EventTypeWarning, reasonMaxRetries,
+		fmt.Sprintf("Giving up after %d retries: %v", c.maxRetries, err))
+}
 
-	if err := c.k8sClient.UpdateStatus(ctx, name, ready, message); err != nil {
-		log.WithError(err).Warn("Failed to update status")
-	} else {
-		log.Debug("Status updated")
+func (c *Controller) updateQueueDepth() {
+	if c.metricsServer != nil {
+		c.metricsServer.SetReconcileQueueDepth(c.workqueue.Len())
 	}
 }
 
@@ -281,6 +966,16 @@ func (c *Controller) onUpdate(oldObj, newObj interface{}) {
 		return
 	}
 	c.log.WithField("key", key).Debug("Update event received")
+
+	oldQuota, oldOK := oldObj.(*v1alpha1.NamespaceQuota)
+	newQuota, newOK := newObj.(*v1alpha1.NamespaceQuota)
+	if oldOK && newOK && oldQuota.Spec.Namespace != "" && oldQuota.Spec.Namespace != newQuota.Spec.Namespace {
+		c.reconciler.addPendingRename(key, oldQuota.Spec.Namespace)
+	}
+	if oldOK && newOK && oldQuota.Generation != newQuota.Generation {
+		c.reconciler.resetEventState(newQuota.Spec.Namespace)
+	}
+
 	c.workqueue.Add(key)
 }
 
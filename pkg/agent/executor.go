@@ -0,0 +1,21 @@
+package agent
+
+import (
+	"context"
+	"os/exec"
+)
+
+// Executor runs host commands on behalf of CgroupManager. It exists so the
+// systemctl calls can be replaced in tests.
+type Executor interface {
+	// Run executes name with args and returns its combined stdout and stderr.
+	// The command is killed if ctx is done before it exits.
+	Run(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// RealExecutor runs commands with os/exec
+type RealExecutor struct{}
+
+func (RealExecutor) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).CombinedOutput()
+}
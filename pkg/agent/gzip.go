@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gzipMiddleware compresses responses for clients accepting gzip and counts
+// the bytes served in metricsResponseBytes
+func gzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if !acceptsGzip(r) {
+			body := &byteCounter{Writer: w}
+			next.ServeHTTP(&bodyResponseWriter{ResponseWriter: w, body: body}, r)
+			metricsResponseBytes.WithLabelValues("uncompressed").Add(float64(body.n))
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		sent := &byteCounter{Writer: w}
+		gz := gzip.NewWriter(sent)
+		body := &byteCounter{Writer: gz}
+		next.ServeHTTP(&bodyResponseWriter{ResponseWriter: w, body: body}, r)
+		_ = gz.Close()
+
+		metricsResponseBytes.WithLabelValues("uncompressed").Add(float64(body.n))
+		metricsResponseBytes.WithLabelValues("compressed").Add(float64(sent.n))
+	})
+}
+
+// acceptsGzip reports whether the Accept-Encoding header allows gzip
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			continue
+		}
+		// "gzip;q=0" explicitly refuses gzip
+		q, found := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !found {
+			return true
+		}
+		weight, err := strconv.ParseFloat(q, 64)
+		return err == nil && weight > 0
+	}
+	return false
+}
+
+// bodyResponseWriter sends the response body through body, e.g. a gzip writer
+type bodyResponseWriter struct {
+	http.ResponseWriter
+	body io.Writer
+}
+
+func (w *bodyResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+type byteCounter struct {
+	io.Writer
+	n int64
+}
+
+func (c *byteCounter) Write(b []byte) (int, error) {
+	n, err := c.Writer.Write(b)
+	c.n += int64(n)
+	return n, err
+}
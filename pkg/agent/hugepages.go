@@ -0,0 +1,192 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// hugepagesSysfsPath holds a hugepages-<size>kB directory for every hugepage
+// size the kernel supports
+var hugepagesSysfsPath = "/sys/kernel/mm/hugepages"
+
+// SupportedHugepageSizes returns the hugepage sizes of the node in bytes,
+// sorted
+func SupportedHugepageSizes() ([]int64, error) {
+	entries, err := os.ReadDir(hugepagesSysfsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list hugepage sizes: %w", err)
+	}
+
+	var sizes []int64
+	for _, entry := range entries {
+		kb, ok := strings.CutPrefix(entry.Name(), "hugepages-")
+		if !ok {
+			continue
+		}
+		kb, ok = strings.CutSuffix(kb, "kB")
+		if !ok {
+			continue
+		}
+		size, err := strconv.ParseInt(kb, 10, 64)
+		if err != nil {
+			continue
+		}
+		sizes = append(sizes, size*1024)
+	}
+	slices.Sort(sizes)
+	return sizes, nil
+}
+
+// ParseHugepageSize parses a hugepage size such as "2Mi" or "1Gi" into bytes
+func ParseHugepageSize(size string) (int64, error) {
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hugepage size %q: %w", size, err)
+	}
+	bytes := quantity.Value()
+	if bytes <= 0 || bits.OnesCount64(uint64(bytes)) != 1 {
+		return 0, fmt.Errorf("invalid hugepage size %q: must be a power of two", size)
+	}
+	return bytes, nil
+}
+
+// hugetlbSizeName formats a hugepage size the way the kernel names the
+// hugetlb.<size>.* files, e.g. 2MB or 1GB
+func hugetlbSizeName(bytes int64) string {
+	switch {
+	case bytes >= 1<<30:
+		return fmt.Sprintf("%dGB", bytes>>30)
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%dMB", bytes>>20)
+	default:
+		return fmt.Sprintf("%dKB", bytes>>10)
+	}
+}
+
+// hugepageSizeFromHugetlb converts the size in a hugetlb file name back to
+// the Kubernetes notation of the spec, e.g. 2MB to 2Mi
+func hugepageSizeFromHugetlb(name string) (string, bool) {
+	shifts := map[string]uint{"KB": 10, "MB": 20, "GB": 30}
+	for unit, shift := range shifts {
+		if number, ok := strings.CutSuffix(name, unit); ok {
+			value, err := strconv.ParseInt(number, 10, 64)
+			if err != nil {
+				return "", false
+			}
+			return resource.NewQuantity(value<<shift, resource.BinarySI).String(), true
+		}
+	}
+	return "", false
+}
+
+// hugetlbLimitPath returns the hugetlb.<size>.max file of the namespace slice
+// after checking that the node supports the size
+func (m *CgroupManager) hugetlbLimitPath(namespace, size string) (string, int64, error) {
+	sizeBytes, err := ParseHugepageSize(size)
+	if err != nil {
+		return "", 0, err
+	}
+	supported, err := SupportedHugepageSizes()
+	if err != nil {
+		return "", 0, err
+	}
+	if !slices.Contains(supported, sizeBytes) {
+		names := make([]string, len(supported))
+		for i, s := range supported {
+			names[i] = resource.NewQuantity(s, resource.BinarySI).String()
+		}
+		return "", 0, fmt.Errorf("hugepage size %s is not supported on this node (supported: %s)", size, strings.Join(names, ", "))
+	}
+	file := "hugetlb." + hugetlbSizeName(sizeBytes) + ".max"
+	return filepath.Join(m.GetSlicePath(namespace), file), sizeBytes, nil
+}
+
+// SetHugepagesLimit writes the limit of hugepages of size (e.g. "2Mi") to
+// hugetlb.<size>.max of the namespace slice. systemd has no property for it,
+// so the file is written directly. A negative bytes removes the limit.
+func (m *CgroupManager) SetHugepagesLimit(namespace, size string, bytes int64) error {
+	path, _, err := m.hugetlbLimitPath(namespace, size)
+	if err != nil {
+		return err
+	}
+
+	value := "max"
+	if bytes >= 0 {
+		value = strconv.FormatInt(bytes, 10)
+	}
+	if err := os.WriteFile(path, []byte(value), 0644); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to set %s hugepages limit for %s: hugetlb controller not enabled for the slice: %w", size, namespace, err)
+		}
+		return fmt.Errorf("failed to set %s hugepages limit for %s: %w", size, namespace, err)
+	}
+
+	m.log.WithFields(logrus.Fields{
+		"namespace": namespace,
+		"size":      size,
+		"limit":     value,
+	}).Info("Hugepages limit set")
+	return nil
+}
+
+// GetHugepagesLimit reads the hugepages limit of size of the namespace slice
+// in bytes, -1 if unlimited
+func (m *CgroupManager) GetHugepagesLimit(namespace, size string) (int64, error) {
+	path, _, err := m.hugetlbLimitPath(namespace, size)
+	if err != nil {
+		return 0, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s hugepages limit for %s: %w", size, namespace, err)
+	}
+	content := strings.TrimSpace(string(data))
+	if content == "max" {
+		return -1, nil
+	}
+	return strconv.ParseInt(content, 10, 64)
+}
+
+// enableHugetlb enables the hugetlb controller for the children of the
+// parent slice, which is not among RequiredControllers
+func enableHugetlb(parentPath string) error {
+	if err := os.WriteFile(filepath.Join(parentPath, "cgroup.subtree_control"), []byte("+hugetlb"), 0644); err != nil {
+		return fmt.Errorf("failed to enable hugetlb controller in %s: %w", parentPath, err)
+	}
+	return nil
+}
+
+// readHugepagesUsage reads hugetlb.<size>.current of the slice for every
+// hugepage size, keyed by size in Kubernetes notation (e.g. "2Mi")
+func readHugepagesUsage(slicePath string) map[string]int64 {
+	files, _ := filepath.Glob(filepath.Join(slicePath, "hugetlb.*.current"))
+	if len(files) == 0 {
+		return nil
+	}
+
+	usage := make(map[string]int64, len(files))
+	for _, file := range files {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "hugetlb."), ".current")
+		size, ok := hugepageSizeFromHugetlb(name)
+		if !ok {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if value, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil {
+			usage[size] = value
+		}
+	}
+	return usage
+}
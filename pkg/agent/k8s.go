@@ -2,12 +2,23 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"strconv"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -15,14 +26,60 @@ import (
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/api/v1alpha1"
+	"github.com/fulcro-cloud/namespace-isolation/pkg/client/clientset/versioned"
+)
+
+const (
+	eventComponentName = "namespace-isolator"
+
+	// fieldManager owns the status fields written with server-side apply
+	fieldManager = "namespace-isolator"
+
+	// statusPatchAttempts bounds the tries of a status merge patch that
+	// fails with a conflict
+	statusPatchAttempts = 3
 )
 
-const eventComponentName = "namespace-isolator"
+var statusPatchBackoff = wait.Backoff{
+	Steps:    statusPatchAttempts,
+	Duration: 10 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+}
+
+// upsertBackoff retries an annotation quota upsert that raced with another
+// agent creating or updating the same quota
+var upsertBackoff = wait.Backoff{
+	Steps:    5,
+	Duration: 50 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.5,
+}
 
 type K8sClient struct {
 	dynamicClient dynamic.Interface
 	clientset     kubernetes.Interface
+	quotaClient   versioned.Interface
 	recorder      record.EventRecorder
+
+	// DisableSSA makes UpdateStatus use a merge patch instead of server-side
+	// apply, for API servers that do not support it.
+	DisableSSA bool
+
+	// EventLimiter throttles EmitEvent and EmitEventForObject; nil emits
+	// every event at once.
+	EventLimiter *EventLimiter
+}
+
+// namespaceQuotaStatusApply is the server-side apply configuration for the
+// status subresource: only the fields the agent owns are sent.
+type namespaceQuotaStatusApply struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Status            v1alpha1.NamespaceQuotaStatus `json:"status"`
 }
 
 func NewK8sClient(kubeconfig string) (*K8sClient, error) {
@@ -41,11 +98,17 @@ func NewK8sClient(kubeconfig string) (*K8sClient, error) {
 		return nil, fmt.Errorf("failed to create clientset: %w", err)
 	}
 
+	quotaClient, err := versioned.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create NamespaceQuota clientset: %w", err)
+	}
+
 	recorder := createEventRecorder(clientset)
 
 	return &K8sClient{
 		dynamicClient: dynamicClient,
 		clientset:     clientset,
+		quotaClient:   quotaClient,
 		recorder:      recorder,
 	}, nil
 }
@@ -84,6 +147,10 @@ func (c *K8sClient) GetClientset() kubernetes.Interface {
 	return c.clientset
 }
 
+func (c *K8sClient) GetQuotaClientset() versioned.Interface {
+	return c.quotaClient
+}
+
 func (c *K8sClient) GetEventRecorder() record.EventRecorder {
 	return c.recorder
 }
@@ -98,42 +165,493 @@ func (c *K8sClient) EmitEvent(namespace, eventType, reason, message string) {
 		Name:      namespace,
 		Namespace: namespace,
 	}
-	c.recorder.Event(ref, eventType, reason, message)
+	c.EventLimiter.Emit(func() {
+		c.recorder.Event(ref, eventType, reason, message)
+	})
 }
 
-func (c *K8sClient) EmitEventForObject(obj *unstructured.Unstructured, eventType, reason, message string) {
+func (c *K8sClient) EmitEventForObject(quota *v1alpha1.NamespaceQuota, eventType, reason, message string) {
+	// Objects served by typed informers have an empty TypeMeta, so the
+	// reference is built from the known group version instead.
 	ref := &corev1.ObjectReference{
-		APIVersion: obj.GetAPIVersion(),
-		Kind:       obj.GetKind(),
-		Name:       obj.GetName(),
-		Namespace:  obj.GetNamespace(),
-		UID:        obj.GetUID(),
+		APIVersion: v1alpha1.SchemeGroupVersion.String(),
+		Kind:       "NamespaceQuota",
+		Name:       quota.Name,
+		Namespace:  quota.Namespace,
+		UID:        quota.UID,
 	}
-	c.recorder.Event(ref, eventType, reason, message)
+	c.EventLimiter.Emit(func() {
+		c.recorder.Event(ref, eventType, reason, message)
+	})
+}
+
+// PolicyQuotaName is the name of the NamespaceQuota created for a namespace
+// selected by a NamespaceIsolationPolicy
+func PolicyQuotaName(namespace string) string {
+	return "policy-" + namespace
 }
 
-func (c *K8sClient) UpdateStatus(ctx context.Context, name string, ready bool, message string) error {
-	resource := c.GetNamespaceQuotaResource()
+// UpsertPolicyQuota creates or updates the NamespaceQuota of a namespace
+// selected by policy. Quotas not created from a policy are left untouched and
+// reported as an error.
+func (c *K8sClient) UpsertPolicyQuota(ctx context.Context, policy, namespace, cpu, memory string) error {
+	quotas := c.quotaClient.BrasaV1alpha1().NamespaceQuotas()
+	name := PolicyQuotaName(namespace)
 
-	obj, err := resource.Get(ctx, name, metav1.GetOptions{})
+	existing, err := quotas.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		quota := &v1alpha1.NamespaceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{LabelPolicy: policy},
+			},
+			Spec: v1alpha1.NamespaceQuotaSpec{
+				Namespace: namespace,
+				CPU:       cpu,
+				Memory:    memory,
+			},
+		}
+		if _, err := quotas.Create(ctx, quota, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create NamespaceQuota %s: %w", name, err)
+		}
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("failed to get NamespaceQuota %s: %w", name, err)
 	}
 
-	status := map[string]interface{}{
-		"ready":       ready,
-		"message":     message,
-		"lastUpdated": time.Now().UTC().Format(time.RFC3339),
+	if existing.Labels[LabelPolicy] == "" {
+		return fmt.Errorf("NamespaceQuota %s was not created from a policy, not overwriting it", name)
+	}
+	if existing.Labels[LabelPolicy] == policy && existing.Spec.CPU == cpu && existing.Spec.Memory == memory {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]string{LabelPolicy: policy},
+		},
+		"spec": map[string]interface{}{
+			"cpu":    cpu,
+			"memory": memory,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode spec patch: %w", err)
 	}
 
-	if err := unstructured.SetNestedMap(obj.Object, status, "status"); err != nil {
-		return fmt.Errorf("failed to set status: %w", err)
+	if _, err := quotas.Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to update NamespaceQuota %s: %w", name, err)
 	}
+	return nil
+}
+
+// DeletePolicyQuota deletes the NamespaceQuota created from a policy for
+// namespace, if there is one
+func (c *K8sClient) DeletePolicyQuota(ctx context.Context, namespace string) error {
+	quotas := c.quotaClient.BrasaV1alpha1().NamespaceQuotas()
+	name := PolicyQuotaName(namespace)
 
-	_, err = resource.UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+	existing, err := quotas.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get NamespaceQuota %s: %w", name, err)
+	}
+	if existing.Labels[LabelPolicy] == "" {
+		return nil
+	}
+
+	err = quotas.Delete(ctx, name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &existing.UID},
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete NamespaceQuota %s: %w", name, err)
+	}
+	return nil
+}
+
+// UpsertNamespaceQuota creates or updates the NamespaceQuota named after the
+// namespace with the given limits. Quotas not created from annotations are
+// left untouched and reported as an error. Every agent watching the
+// namespace upserts the same quota, so losing a race with another one is
+// retried against the quota it wrote.
+func (c *K8sClient) UpsertNamespaceQuota(ctx context.Context, name, cpu, memory string) error {
+	return retry.OnError(upsertBackoff, isUpsertRace, func() error {
+		return c.upsertNamespaceQuota(ctx, name, cpu, memory)
+	})
+}
+
+// isUpsertRace reports whether an upsert failed because another writer
+// created or changed the quota since it was read
+func isUpsertRace(err error) bool {
+	return apierrors.IsAlreadyExists(err) || apierrors.IsConflict(err)
+}
+
+func (c *K8sClient) upsertNamespaceQuota(ctx context.Context, name, cpu, memory string) error {
+	quotas := c.quotaClient.BrasaV1alpha1().NamespaceQuotas()
+
+	existing, err := quotas.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		quota := &v1alpha1.NamespaceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{LabelCreatedFromAnnotations: "true"},
+			},
+			Spec: v1alpha1.NamespaceQuotaSpec{
+				Namespace: name,
+				CPU:       cpu,
+				Memory:    memory,
+			},
+		}
+		if _, err := quotas.Create(ctx, quota, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create NamespaceQuota %s: %w", name, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get NamespaceQuota %s: %w", name, err)
+	}
+
+	if existing.Labels[LabelCreatedFromAnnotations] != "true" {
+		return fmt.Errorf("NamespaceQuota %s was not created from annotations, not overwriting it", name)
+	}
+	if existing.Spec.CPU == cpu && existing.Spec.Memory == memory {
+		return nil
+	}
+
+	// The resourceVersion makes the patch fail with a conflict if another
+	// agent updated the quota since it was read
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": existing.ResourceVersion,
+		},
+		"spec": map[string]interface{}{
+			"cpu":    cpu,
+			"memory": memory,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode spec patch: %w", err)
+	}
+
+	if _, err := quotas.Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to update NamespaceQuota %s: %w", name, err)
+	}
+	return nil
+}
+
+// enabledQuotasFieldSelector selects the NamespaceQuotas that are enforced
+const enabledQuotasFieldSelector = "spec.enabled=true"
+
+// ListManagedNamespaces returns the sorted target namespaces of every enabled
+// NamespaceQuota, read from the API server rather than an informer cache
+func (c *K8sClient) ListManagedNamespaces(ctx context.Context) ([]string, error) {
+	quotas, err := c.ListNamespaceQuotasWithFieldSelector(ctx, enabledQuotasFieldSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	var namespaces []string
+	for i := range quotas.Items {
+		if namespace, _, _ := unstructured.NestedString(quotas.Items[i].Object, "spec", "namespace"); namespace != "" {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	slices.Sort(namespaces)
+	return slices.Compact(namespaces), nil
+}
+
+// ListNamespaceQuotasWithFieldSelector lists the NamespaceQuotas matching
+// fieldSelector, which may use metadata.name, spec.namespace and spec.enabled
+// (true when unset). The CRD declares no selectable fields, so the API server
+// would reject them: the selector is applied to the listed objects instead,
+// which spares callers the disabled quotas but not the transfer.
+func (c *K8sClient) ListNamespaceQuotasWithFieldSelector(ctx context.Context, fieldSelector string) (*unstructured.UnstructuredList, error) {
+	selector, err := fields.ParseSelector(fieldSelector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse field selector %q: %w", fieldSelector, err)
+	}
+
+	list, err := c.GetNamespaceQuotaResource().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list NamespaceQuotas: %w", err)
+	}
+
+	items := list.Items[:0]
+	for i := range list.Items {
+		if selector.Matches(namespaceQuotaFields(&list.Items[i])) {
+			items = append(items, list.Items[i])
+		}
+	}
+	list.Items = items
+	return list, nil
+}
+
+// namespaceQuotaFields returns the fields of quota that
+// ListNamespaceQuotasWithFieldSelector can select on
+func namespaceQuotaFields(quota *unstructured.Unstructured) fields.Set {
+	namespace, _, _ := unstructured.NestedString(quota.Object, "spec", "namespace")
+	enabled, found, err := unstructured.NestedBool(quota.Object, "spec", "enabled")
+	if !found || err != nil {
+		enabled = true
+	}
+	return fields.Set{
+		"metadata.name":  quota.GetName(),
+		"spec.namespace": namespace,
+		"spec.enabled":   strconv.FormatBool(enabled),
+	}
+}
+
+// WatchNamespaceQuota opens a watch on all NamespaceQuotas starting after
+// resourceVersion (empty starts from the current state)
+func (c *K8sClient) WatchNamespaceQuota(ctx context.Context, resourceVersion string) (watch.Interface, error) {
+	w, err := c.quotaClient.BrasaV1alpha1().NamespaceQuotas().Watch(ctx, metav1.ListOptions{
+		ResourceVersion:     resourceVersion,
+		AllowWatchBookmarks: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch NamespaceQuotas: %w", err)
+	}
+	return w, nil
+}
+
+// GetResourceQuotaLimits returns the limits.cpu and limits.memory hard limits
+// of the ResourceQuotas in namespace. With several quotas the lowest value is
+// returned, as Kubernetes enforces all of them. Missing limits are empty.
+func (c *K8sClient) GetResourceQuotaLimits(ctx context.Context, namespace string) (cpu, memory string, err error) {
+	list, err := c.clientset.CoreV1().ResourceQuotas(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to list ResourceQuotas in %s: %w", namespace, err)
+	}
+
+	var cpuLimit, memoryLimit *resource.Quantity
+	for i := range list.Items {
+		hard := list.Items[i].Spec.Hard
+		if q, ok := hard[corev1.ResourceLimitsCPU]; ok && (cpuLimit == nil || q.Cmp(*cpuLimit) < 0) {
+			cpuLimit = &q
+		}
+		if q, ok := hard[corev1.ResourceLimitsMemory]; ok && (memoryLimit == nil || q.Cmp(*memoryLimit) < 0) {
+			memoryLimit = &q
+		}
+	}
+
+	if cpuLimit != nil {
+		cpu = cpuLimit.String()
+	}
+	if memoryLimit != nil {
+		memory = memoryLimit.String()
+	}
+	return cpu, memory, nil
+}
+
+// NamespaceExists reports whether the namespace name exists, including while
+// it is terminating
+func (c *K8sClient) NamespaceExists(ctx context.Context, name string) (bool, error) {
+	_, err := c.clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get namespace %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// GetPriorityClassValue returns the value of the PriorityClass name
+func (c *K8sClient) GetPriorityClassValue(ctx context.Context, name string) (int32, error) {
+	priorityClass, err := c.clientset.SchedulingV1().PriorityClasses().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get PriorityClass %s: %w", name, err)
+	}
+	return priorityClass.Value, nil
+}
+
+// GetNodeAllocatable returns the allocatable CPU, in millicores, and memory
+// of the node nodeName
+func (c *K8sClient) GetNodeAllocatable(ctx context.Context, nodeName string) (cpuMillis int64, memoryBytes int64, err error) {
+	node, err := c.clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get node %s: %w", nodeName, err)
+	}
+	return node.Status.Allocatable.Cpu().MilliValue(), node.Status.Allocatable.Memory().Value(), nil
+}
+
+// ErrConfigMapKeyNotFound is returned by GetConfigMapValue for a ConfigMap
+// without the key
+var ErrConfigMapKeyNotFound = errors.New("key not found in ConfigMap")
+
+// GetConfigMapValue returns the value of key in the ConfigMap name in namespace
+func (c *K8sClient) GetConfigMapValue(ctx context.Context, namespace, name, key string) (string, error) {
+	configMap, err := c.clientset.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get ConfigMap %s/%s: %w", namespace, name, err)
+	}
+	value, ok := configMap.Data[key]
+	if !ok {
+		return "", fmt.Errorf("%w: %s in %s/%s", ErrConfigMapKeyNotFound, key, namespace, name)
+	}
+	return value, nil
+}
+
+// GetSlicePrefixOverrides reads the per-namespace slice prefixes from the
+// ConfigMap name in namespace (key=namespace, value=prefix such as "team-a.slice")
+func (c *K8sClient) GetSlicePrefixOverrides(ctx context.Context, namespace, name string) (map[string]string, error) {
+	configMap, err := c.clientset.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ConfigMap %s/%s: %w", namespace, name, err)
+	}
+
+	overrides := make(map[string]string, len(configMap.Data))
+	for ns, prefix := range configMap.Data {
+		if err := ValidateSlicePrefix(prefix); err != nil {
+			return nil, fmt.Errorf("invalid slice prefix for namespace %s in ConfigMap %s/%s: %w", ns, namespace, name, err)
+		}
+		overrides[ns] = prefix
+	}
+	return overrides, nil
+}
+
+// DeleteNamespaceQuota deletes the NamespaceQuota named after the namespace
+// if it was created from annotations
+func (c *K8sClient) DeleteNamespaceQuota(ctx context.Context, name string) error {
+	quotas := c.quotaClient.BrasaV1alpha1().NamespaceQuotas()
+
+	existing, err := quotas.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get NamespaceQuota %s: %w", name, err)
+	}
+	if existing.Labels[LabelCreatedFromAnnotations] != "true" {
+		return nil
+	}
+
+	err = quotas.Delete(ctx, name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &existing.UID},
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete NamespaceQuota %s: %w", name, err)
+	}
+	return nil
+}
+
+// UpdateStatus writes the status subresource of the quota, setting the given
+// conditions on top of those already recorded. It uses server-side apply as
+// the namespace-isolator field manager, so it never fails on a stale
+// resourceVersion, unless DisableSSA selects a merge patch.
+func (c *K8sClient) UpdateStatus(ctx context.Context, quota *v1alpha1.NamespaceQuota, ready bool, message string, conditions ...metav1.Condition) (err error) {
+	ctx, span := startSpan(ctx, "K8sClient.UpdateStatus",
+		attribute.String("name", quota.Name),
+		attribute.Bool("ready", ready),
+	)
+	defer func() { endSpan(span, err) }()
+
+	now := metav1.NewTime(time.Now().UTC())
+	status := quota.Status.DeepCopy()
+	status.Ready = ready
+	status.Message = message
+	status.LastUpdated = &now
+	for _, condition := range conditions {
+		condition.ObservedGeneration = quota.Generation
+		status.SetCondition(condition)
+	}
+
+	if c.DisableSSA {
+		return c.PatchStatus(ctx, quota.Name, *status)
+	}
+
+	apply, err := json.Marshal(namespaceQuotaStatusApply{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			Kind:       "NamespaceQuota",
+		},
+		ObjectMeta: metav1.ObjectMeta{Name: quota.Name},
+		Status:     *status,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode status apply for %s: %w", quota.Name, err)
+	}
+
+	force := true
+	_, err = c.quotaClient.BrasaV1alpha1().NamespaceQuotas().Patch(ctx, quota.Name, types.ApplyPatchType, apply,
+		metav1.PatchOptions{FieldManager: fieldManager, Force: &force}, "status")
+	if err != nil {
+		return fmt.Errorf("failed to apply status for %s: %w", quota.Name, err)
+	}
+
+	return nil
+}
+
+// PatchStatus replaces the status of the quota with a JSON merge patch, which
+// needs no prior GET. Conflicts are retried up to statusPatchAttempts times.
+func (c *K8sClient) PatchStatus(ctx context.Context, name string, status v1alpha1.NamespaceQuotaStatus) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": status,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode status patch for %s: %w", name, err)
+	}
+
+	err = retry.OnError(statusPatchBackoff, apierrors.IsConflict, func() error {
+		_, err := c.quotaClient.BrasaV1alpha1().NamespaceQuotas().Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("failed to update status for %s: %w", name, err)
 	}
 
 	return nil
 }
+
+// AddFinalizer adds finalizer to the quota if it is not already present
+func (c *K8sClient) AddFinalizer(ctx context.Context, quota *v1alpha1.NamespaceQuota, finalizer string) error {
+	if slices.Contains(quota.Finalizers, finalizer) {
+		return nil
+	}
+
+	finalizers := append(slices.Clone(quota.Finalizers), finalizer)
+	if err := c.patchFinalizers(ctx, quota, finalizers); err != nil {
+		return fmt.Errorf("failed to add finalizer to %s: %w", quota.Name, err)
+	}
+	return nil
+}
+
+// RemoveFinalizer removes finalizer from the quota if it is present
+func (c *K8sClient) RemoveFinalizer(ctx context.Context, quota *v1alpha1.NamespaceQuota, finalizer string) error {
+	if !slices.Contains(quota.Finalizers, finalizer) {
+		return nil
+	}
+
+	finalizers := slices.DeleteFunc(slices.Clone(quota.Finalizers), func(f string) bool {
+		return f == finalizer
+	})
+	if err := c.patchFinalizers(ctx, quota, finalizers); err != nil {
+		return fmt.Errorf("failed to remove finalizer from %s: %w", quota.Name, err)
+	}
+	return nil
+}
+
+// patchFinalizers replaces the finalizer list of the quota. Custom resources
+// do not support strategic merge patch, so a merge patch guarded by the
+// resourceVersion is used to avoid clobbering concurrent finalizer changes.
+func (c *K8sClient) patchFinalizers(ctx context.Context, quota *v1alpha1.NamespaceQuota, finalizers []string) error {
+	if finalizers == nil {
+		finalizers = []string{}
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"finalizers":      finalizers,
+			"resourceVersion": quota.ResourceVersion,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode finalizer patch: %w", err)
+	}
+
+	_, err = c.quotaClient.BrasaV1alpha1().NamespaceQuotas().Patch(ctx, quota.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
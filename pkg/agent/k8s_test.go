@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/api/v1alpha1"
+	"github.com/fulcro-cloud/namespace-isolation/pkg/client/clientset/versioned"
+	brasav1alpha1 "github.com/fulcro-cloud/namespace-isolation/pkg/client/clientset/versioned/typed/brasa/v1alpha1"
+)
+
+// racingQuotaClient holds a single NamespaceQuota and lets another agent
+// win the first create and the first update of it
+type racingQuotaClient struct {
+	versioned.Interface
+	brasav1alpha1.BrasaV1alpha1Interface
+	brasav1alpha1.NamespaceQuotaInterface
+
+	quota                   *v1alpha1.NamespaceQuota
+	createRaced, patchRaced bool
+}
+
+func (c *racingQuotaClient) BrasaV1alpha1() brasav1alpha1.BrasaV1alpha1Interface {
+	return c
+}
+
+func (c *racingQuotaClient) NamespaceQuotas() brasav1alpha1.NamespaceQuotaInterface {
+	return c
+}
+
+func (c *racingQuotaClient) Get(_ context.Context, name string, _ metav1.GetOptions) (*v1alpha1.NamespaceQuota, error) {
+	if c.quota == nil {
+		return nil, apierrors.NewNotFound(v1alpha1.Resource("namespacequotas"), name)
+	}
+	return c.quota.DeepCopy(), nil
+}
+
+func (c *racingQuotaClient) Create(_ context.Context, quota *v1alpha1.NamespaceQuota, _ metav1.CreateOptions) (*v1alpha1.NamespaceQuota, error) {
+	if !c.createRaced {
+		c.createRaced = true
+		c.quota = quota.DeepCopy()
+		c.quota.Spec.CPU, c.quota.Spec.Memory = "1", "1Gi"
+		c.quota.ResourceVersion = "1"
+		return nil, apierrors.NewAlreadyExists(v1alpha1.Resource("namespacequotas"), quota.Name)
+	}
+	return nil, apierrors.NewBadRequest("unexpected create of an existing quota")
+}
+
+func (c *racingQuotaClient) Patch(_ context.Context, name string, _ types.PatchType, data []byte, _ metav1.PatchOptions, _ ...string) (*v1alpha1.NamespaceQuota, error) {
+	if !c.patchRaced {
+		c.patchRaced = true
+		c.quota.ResourceVersion = "2"
+	}
+
+	var patch struct {
+		Metadata metav1.ObjectMeta           `json:"metadata"`
+		Spec     v1alpha1.NamespaceQuotaSpec `json:"spec"`
+	}
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return nil, err
+	}
+	if patch.Metadata.ResourceVersion != c.quota.ResourceVersion {
+		return nil, apierrors.NewConflict(v1alpha1.Resource("namespacequotas"), name, nil)
+	}
+
+	rv, _ := strconv.Atoi(c.quota.ResourceVersion)
+	c.quota.ResourceVersion = strconv.Itoa(rv + 1)
+	c.quota.Spec.CPU, c.quota.Spec.Memory = patch.Spec.CPU, patch.Spec.Memory
+	return c.quota.DeepCopy(), nil
+}
+
+func TestUpsertNamespaceQuotaRetriesRaces(t *testing.T) {
+	quotaClient := &racingQuotaClient{}
+	client := &K8sClient{quotaClient: quotaClient}
+
+	if err := client.UpsertNamespaceQuota(context.Background(), "team-a", "2", "2Gi"); err != nil {
+		t.Fatalf("UpsertNamespaceQuota() error = %v", err)
+	}
+
+	if !quotaClient.createRaced || !quotaClient.patchRaced {
+		t.Fatalf("create raced = %v, patch raced = %v, want both", quotaClient.createRaced, quotaClient.patchRaced)
+	}
+	if spec := quotaClient.quota.Spec; spec.CPU != "2" || spec.Memory != "2Gi" {
+		t.Errorf("quota spec cpu %q memory %q, want 2 and 2Gi", spec.CPU, spec.Memory)
+	}
+}
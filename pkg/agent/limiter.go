@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	DefaultSystemdCallRate  = 10.0
+	DefaultSystemdCallBurst = 5
+
+	// DefaultEventBurst applies when an event rate limit is set without a burst
+	DefaultEventBurst = 10
+)
+
+// SystemdCallLimiter bounds the rate of systemctl calls made by a
+// CgroupManager. Without it, reconciling many namespaces at startup issues
+// one set-property call per limit at once, which can stall systemd on the host.
+type SystemdCallLimiter struct {
+	limiter *rate.Limiter
+}
+
+// NewSystemdCallLimiter allows callsPerSecond calls on average, with bursts of up to burst calls
+func NewSystemdCallLimiter(callsPerSecond float64, burst int) *SystemdCallLimiter {
+	return &SystemdCallLimiter{limiter: rate.NewLimiter(rate.Limit(callsPerSecond), burst)}
+}
+
+// Wait blocks until a call is allowed or ctx is done. Calls that have to wait
+// are counted in namespace_quota_systemd_call_rate_limited_total.
+func (l *SystemdCallLimiter) Wait(ctx context.Context) error {
+	if l.limiter.Allow() {
+		return nil
+	}
+	systemdCallRateLimited.Inc()
+	return l.limiter.Wait(ctx)
+}
+
+// EventLimiter bounds the rate of Kubernetes events emitted by a K8sClient.
+// An event over the limit is held back and emitted once the limiter allows
+// it; only the last one held back is kept, the ones it replaces are dropped.
+type EventLimiter struct {
+	limiter *rate.Limiter
+
+	mu       sync.Mutex
+	pending  func()
+	flushing bool
+}
+
+// NewEventLimiter allows eventsPerSecond events on average, with bursts of up to burst events
+func NewEventLimiter(eventsPerSecond rate.Limit, burst int) *EventLimiter {
+	return &EventLimiter{limiter: rate.NewLimiter(eventsPerSecond, burst)}
+}
+
+// Emit calls record now if the limit allows it, or holds it back otherwise.
+// A nil EventLimiter records every event at once.
+func (l *EventLimiter) Emit(record func()) {
+	if l == nil {
+		record()
+		return
+	}
+
+	l.mu.Lock()
+	if l.pending == nil && l.limiter.Allow() {
+		l.mu.Unlock()
+		record()
+		return
+	}
+
+	eventsRateLimited.Inc()
+	if l.pending != nil {
+		eventsDropped.Inc()
+	}
+	l.pending = record
+	start := !l.flushing
+	l.flushing = true
+	l.mu.Unlock()
+
+	if start {
+		go l.flush()
+	}
+}
+
+// flush emits the event held back once the limiter allows it
+func (l *EventLimiter) flush() {
+	_ = l.limiter.Wait(context.Background())
+
+	l.mu.Lock()
+	record := l.pending
+	l.pending = nil
+	l.flushing = false
+	l.mu.Unlock()
+
+	record()
+}
+
+// retryRateLimiter spreads the retries of failed reconciles with jitter, so
+// keys failing together, e.g. while systemd is unavailable, do not all retry
+// at the same moment
+type retryRateLimiter struct {
+	workqueue.TypedRateLimiter[string]
+}
+
+// NewRetryRateLimiter returns the work queue rate limiter for reconcile
+// retries: exponential backoff from baseDelay up to maxDelay per key, with
+// equal jitter (each delay is drawn from its upper half), combined with the
+// overall limit of client-go's default controller rate limiter. Delays are
+// recorded in namespace_quota_retry_delay_seconds.
+func NewRetryRateLimiter(baseDelay, maxDelay time.Duration) workqueue.TypedRateLimiter[string] {
+	return retryRateLimiter{
+		TypedRateLimiter: workqueue.NewTypedMaxOfRateLimiter(
+			workqueue.NewTypedItemExponentialFailureRateLimiter[string](baseDelay, maxDelay),
+			&workqueue.TypedBucketRateLimiter[string]{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+		),
+	}
+}
+
+func (l retryRateLimiter) When(key string) time.Duration {
+	delay := l.TypedRateLimiter.When(key)
+	if half := delay / 2; half > 0 {
+		delay = half + rand.N(half+1)
+	}
+	retryDelay.Observe(delay.Seconds())
+	return delay
+}
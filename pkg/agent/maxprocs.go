@@ -0,0 +1,196 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// selfCgroupRoot, procSelfCgroupPath and procSelfMountinfoPath locate the
+// process cgroup; variables so they can be pointed at a fake tree
+var (
+	selfCgroupRoot        = "/sys/fs/cgroup"
+	procSelfCgroupPath    = "/proc/self/cgroup"
+	procSelfMountinfoPath = "/proc/self/mountinfo"
+)
+
+// TuneGOMAXPROCS lowers GOMAXPROCS to the CPU quota of the cgroup the process
+// runs in, rounded down to whole CPUs (at least 1). The Go runtime already
+// caps GOMAXPROCS at the quota rounded up; a GOMAXPROCS environment variable
+// disables both. It returns the resulting GOMAXPROCS and the quota in CPUs,
+// 0 if the cgroup has none.
+func TuneGOMAXPROCS() (procs int, quotaCPUs float64, err error) {
+	procs = runtime.GOMAXPROCS(0)
+
+	quotaCPUs, err = readSelfCPUQuota()
+	if err != nil || quotaCPUs == 0 || os.Getenv("GOMAXPROCS") != "" {
+		return procs, quotaCPUs, err
+	}
+
+	if n := max(int(quotaCPUs), 1); n < procs {
+		runtime.GOMAXPROCS(n)
+		procs = n
+	}
+	return procs, quotaCPUs, nil
+}
+
+// readSelfCPUQuota returns the lowest cpu.max quota, in CPUs, of the cgroup
+// v2 of the process and its ancestors, or 0 if none is limited
+func readSelfCPUQuota() (float64, error) {
+	content, err := os.ReadFile(procSelfCgroupPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", procSelfCgroupPath, err)
+	}
+
+	cgroupPath := ""
+	for _, line := range strings.Split(string(content), "\n") {
+		if rest, ok := strings.CutPrefix(line, "0::"); ok {
+			cgroupPath = path.Clean(rest)
+			break
+		}
+	}
+	if cgroupPath == "" {
+		return 0, fmt.Errorf("no cgroup v2 entry in %s", procSelfCgroupPath)
+	}
+
+	mountRoot, err := readCgroupMountRoot()
+	if err != nil {
+		return 0, err
+	}
+	selfDir, err := resolveSelfCgroupDir(mountRoot, cgroupPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var lowest float64
+	for dir := selfDir; ; dir = path.Dir(dir) {
+		cpus, err := readCPUMaxCPUs(filepath.Join(selfCgroupRoot, dir, "cpu.max"))
+		if err != nil {
+			return 0, err
+		}
+		if cpus > 0 && (lowest == 0 || cpus < lowest) {
+			lowest = cpus
+		}
+		if dir == "/" {
+			return lowest, nil
+		}
+	}
+}
+
+// readCgroupMountRoot returns the cgroup mounted at selfCgroupRoot, relative
+// to the cgroup namespace of the process. It starts with ".." when an
+// ancestor of the namespace root is mounted, such as the host cgroup tree
+// mounted into a container.
+func readCgroupMountRoot() (string, error) {
+	content, err := os.ReadFile(procSelfMountinfoPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", procSelfMountinfoPath, err)
+	}
+
+	// Fields: ID, parent ID, major:minor, root, mount point, options,
+	// optional fields, "-", filesystem type. The last mount shadows the
+	// earlier ones at the same mount point.
+	mountRoot := ""
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		sep := slices.Index(fields, "-")
+		if sep < 5 || sep+1 >= len(fields) || fields[sep+1] != "cgroup2" {
+			continue
+		}
+		if filepath.Clean(fields[4]) == filepath.Clean(selfCgroupRoot) {
+			// Not cleaned: path.Clean drops the leading ".." of a rooted path
+			mountRoot = fields[3]
+		}
+	}
+	if mountRoot == "" {
+		return "", fmt.Errorf("no cgroup v2 mount at %s in %s", selfCgroupRoot, procSelfMountinfoPath)
+	}
+	return mountRoot, nil
+}
+
+// resolveSelfCgroupDir returns the cgroup of the process, cgroupPath in its
+// cgroup namespace, relative to selfCgroupRoot where mountRoot is mounted.
+// The path of the namespace root below an ancestor mount is not visible from
+// inside the namespace, so it is found by the process ID in cgroup.procs.
+func resolveSelfCgroupDir(mountRoot, cgroupPath string) (string, error) {
+	if mountRoot == "/" {
+		return cgroupPath, nil
+	}
+
+	if !strings.HasPrefix(mountRoot, "/..") {
+		if rel, ok := strings.CutPrefix(cgroupPath, mountRoot); ok && (rel == "" || rel[0] == '/') {
+			return path.Clean("/" + rel), nil
+		}
+		return "", fmt.Errorf("cgroup %s is outside the cgroup %s mounted at %s", cgroupPath, mountRoot, selfCgroupRoot)
+	}
+
+	levels := strings.Split(strings.TrimPrefix(mountRoot, "/"), "/")
+	if slices.ContainsFunc(levels, func(level string) bool { return level != ".." }) {
+		return "", fmt.Errorf("unsupported cgroup mount root %s at %s", mountRoot, selfCgroupRoot)
+	}
+
+	pid := strconv.Itoa(os.Getpid())
+	candidates := []string{"/"}
+	for range levels {
+		var children []string
+		for _, dir := range candidates {
+			entries, err := os.ReadDir(filepath.Join(selfCgroupRoot, dir))
+			if os.IsNotExist(err) {
+				// Removed since its parent was listed
+				continue
+			}
+			if err != nil {
+				return "", fmt.Errorf("failed to list cgroup %s: %w", dir, err)
+			}
+			for _, entry := range entries {
+				if entry.IsDir() {
+					children = append(children, path.Join(dir, entry.Name()))
+				}
+			}
+		}
+		candidates = children
+	}
+
+	for _, namespaceRoot := range candidates {
+		dir := path.Join(namespaceRoot, cgroupPath)
+		procs, err := os.ReadFile(filepath.Join(selfCgroupRoot, dir, "cgroup.procs"))
+		if err != nil {
+			continue
+		}
+		if slices.Contains(strings.Fields(string(procs)), pid) {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("no cgroup %d levels below %s lists process %s", len(levels), selfCgroupRoot, pid)
+}
+
+// readCPUMaxCPUs converts a cpu.max file to CPUs, returning 0 if it is
+// unlimited or missing (the root cgroup has none)
+func readCPUMaxCPUs(cpuMaxPath string) (float64, error) {
+	content, err := os.ReadFile(cpuMaxPath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", cpuMaxPath, err)
+	}
+
+	fields := strings.Fields(string(content))
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0, nil
+	}
+	quota, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %w", cpuMaxPath, err)
+	}
+	period, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || period <= 0 {
+		return 0, fmt.Errorf("failed to parse %s: invalid period %q", cpuMaxPath, fields[1])
+	}
+	return float64(quota) / float64(period), nil
+}
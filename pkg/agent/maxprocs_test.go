@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// writeCgroupTree writes files, by path relative to root, creating their
+// directories
+func writeCgroupTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		name := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", filepath.Dir(name), err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestReadSelfCPUQuota(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+
+	tests := []struct {
+		name   string
+		cgroup string
+		// mountRoots are the roots of the cgroup v2 mounts at the fake tree
+		mountRoots []string
+		tree       map[string]string
+		want       float64
+		wantError  bool
+	}{
+		{
+			name:       "host cgroup namespace",
+			cgroup:     "0::/kubepods/pod-a/app\n",
+			mountRoots: []string{"/"},
+			tree: map[string]string{
+				"kubepods/pod-a/cpu.max":     "50000 100000",
+				"kubepods/pod-a/app/cpu.max": "max 100000",
+				"kubepods/pod-b/cpu.max":     "10000 100000",
+			},
+			want: 0.5,
+		},
+		{
+			name:       "own cgroup mounted in a cgroup namespace",
+			cgroup:     "0::/\n",
+			mountRoots: []string{"/"},
+			tree:       map[string]string{"cpu.max": "150000 100000"},
+			want:       1.5,
+		},
+		{
+			name:       "host tree mounted over the own cgroup in a cgroup namespace",
+			cgroup:     "0::/\n",
+			mountRoots: []string{"/", "/../../../.."},
+			tree: map[string]string{
+				"kubepods/burstable/pod-a/cpu.max":          "50000 100000",
+				"kubepods/burstable/pod-a/app/cgroup.procs": pid + "\n",
+				"kubepods/burstable/pod-a/app/cpu.max":      "max 100000",
+				"kubepods/burstable/pod-b/cpu.max":          "10000 100000",
+				"kubepods/burstable/pod-b/app/cgroup.procs": "1\n2\n",
+				"kubepods/cpu.max":                          "max 100000",
+			},
+			want: 0.5,
+		},
+		{
+			name:       "host tree without the process",
+			cgroup:     "0::/\n",
+			mountRoots: []string{"/../.."},
+			tree: map[string]string{
+				"kubepods/pod-b/cgroup.procs": "1\n",
+			},
+			wantError: true,
+		},
+		{
+			name:      "no cgroup v2 mount",
+			cgroup:    "0::/\n",
+			tree:      map[string]string{"cpu.max": "150000 100000"},
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proc := t.TempDir()
+			root := t.TempDir()
+			writeCgroupTree(t, root, tt.tree)
+
+			mountinfo := "25 1 8:1 / / rw,relatime - ext4 /dev/sda1 rw\n"
+			for i, mountRoot := range tt.mountRoots {
+				mountinfo += fmt.Sprintf("%d 25 0:26 %s %s rw,nosuid,nodev,noexec,relatime shared:4 - cgroup2 cgroup2 rw,nsdelegate\n", 30+i, mountRoot, root)
+			}
+			writeCgroupTree(t, proc, map[string]string{"cgroup": tt.cgroup, "mountinfo": mountinfo})
+
+			oldRoot, oldCgroup, oldMountinfo := selfCgroupRoot, procSelfCgroupPath, procSelfMountinfoPath
+			selfCgroupRoot = root
+			procSelfCgroupPath = filepath.Join(proc, "cgroup")
+			procSelfMountinfoPath = filepath.Join(proc, "mountinfo")
+			t.Cleanup(func() {
+				selfCgroupRoot, procSelfCgroupPath, procSelfMountinfoPath = oldRoot, oldCgroup, oldMountinfo
+			})
+
+			got, err := readSelfCPUQuota()
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("readSelfCPUQuota() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readSelfCPUQuota() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("readSelfCPUQuota() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
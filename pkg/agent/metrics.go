@@ -1,98 +1,835 @@
 package agent
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// DefaultMetricsNamespace and metricsSubsystem give the metric names
+	// their namespace_quota_ prefix; --metrics-namespace replaces the first part.
+	DefaultMetricsNamespace = "namespace"
+	metricsSubsystem        = "quota"
 )
 
 var (
+	cpuUsage               *prometheus.GaugeVec
+	cpuLimit               *prometheus.GaugeVec
+	cpuThrottledPeriods    *prometheus.GaugeVec
+	cpuThrottledPct        *prometheus.GaugeVec
+	memoryUsage            *prometheus.GaugeVec
+	memoryLimit            *prometheus.GaugeVec
+	memoryMin              *prometheus.GaugeVec
+	memoryLow              *prometheus.GaugeVec
+	memoryHigh             *prometheus.GaugeVec
+	oomKills               *prometheus.GaugeVec
+	oomGroupEnabled        *prometheus.GaugeVec
+	cpuIdleMode            *prometheus.GaugeVec
+	priorityClassValue     *prometheus.GaugeVec
+	cpuWeight              *prometheus.GaugeVec
+	cpuSetCPUs             *prometheus.GaugeVec
+	cpuPressureSome        *prometheus.GaugeVec
+	memoryPressureSome     *prometheus.GaugeVec
+	memoryPressureFull     *prometheus.GaugeVec
+	memoryPressureLevel    *prometheus.GaugeVec
+	ioPressureSome         *prometheus.GaugeVec
+	hugepagesUsage         *prometheus.GaugeVec
+	pidsCurrent            *prometheus.GaugeVec
+	pidsMax                *prometheus.GaugeVec
+	leaderElectionStatus   prometheus.Gauge
+	reconcileQueueDepth    prometheus.Gauge
+	driftDetected          *prometheus.CounterVec
+	reconcileDuration      *prometheus.HistogramVec
+	retryDelay             prometheus.Histogram
+	reconcileTotal         *prometheus.CounterVec
+	orphanSlicesCleaned    prometheus.Counter
+	systemdCallRateLimited prometheus.Counter
+	eventsRateLimited      prometheus.Counter
+	eventsDropped          prometheus.Counter
+	systemdTimeouts        prometheus.Counter
+	systemdReachable       prometheus.Gauge
+	reportGenerated        prometheus.Counter
+	slicesWithoutLimits    prometheus.Gauge
+	staleQuotas            prometheus.Gauge
+	maxRetriesExceeded     prometheus.Counter
+	filteredOut            prometheus.Counter
+	specUnchangedSkipped   prometheus.Counter
+	exceedsAllocatable     prometheus.Counter
+	metricsResponseBytes   *prometheus.CounterVec
+	cgroupVersion          *prometheus.GaugeVec
+	agentGOMAXPROCS        prometheus.GaugeFunc
+
+	// Work queue metrics keep the standard client-go names (workqueue_*),
+	// labelled by queue name, rather than the agent prefix
+	workqueueDepth          *prometheus.GaugeVec
+	workqueueAdds           *prometheus.CounterVec
+	workqueueLatency        *prometheus.HistogramVec
+	workqueueWorkDuration   *prometheus.HistogramVec
+	workqueueUnfinishedWork *prometheus.GaugeVec
+	workqueueLongestRunning *prometheus.GaugeVec
+	workqueueRetries        *prometheus.CounterVec
+)
+
+func init() {
+	// Build the collectors so they can be used before NewMetricsServer, e.g.
+	// by a CgroupManager that has no metrics server. Nothing is registered.
+	newMetrics(DefaultMetricsNamespace)
+
+	// Queues take their metrics from the provider when they are created,
+	// which happens after NewMetricsServer has built the collectors it serves.
+	workqueue.SetProvider(workqueueMetricsProvider{})
+}
+
+// newMetrics creates the agent collectors with names prefixed by
+// <metricsNamespace>_quota_
+func newMetrics(metricsNamespace string) {
 	cpuUsage = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "namespace_quota_cpu_usage_usec",
-			Help: "Current CPU usage in microseconds for the namespace",
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "cpu_usage_usec",
+			Help:      "Current CPU usage in microseconds for the namespace",
 		},
 		[]string{"namespace"},
 	)
 
 	cpuLimit = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "namespace_quota_cpu_limit_usec",
-			Help: "CPU limit in microseconds for the namespace",
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "cpu_limit_usec",
+			Help:      "CPU limit in microseconds for the namespace",
 		},
 		[]string{"namespace"},
 	)
 
 	cpuThrottledPeriods = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "namespace_quota_cpu_throttled_periods",
-			Help: "Number of CPU throttled periods for the namespace",
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "cpu_throttled_periods",
+			Help:      "Number of CPU throttled periods for the namespace",
+		},
+		[]string{"namespace"},
+	)
+
+	cpuThrottledPct = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "cpu_throttled_pct",
+			Help:      "Percentage of CPU periods in which the namespace was throttled (0-100)",
 		},
 		[]string{"namespace"},
 	)
 
 	memoryUsage = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "namespace_quota_memory_usage_bytes",
-			Help: "Current memory usage in bytes for the namespace",
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "memory_usage_bytes",
+			Help:      "Current memory usage in bytes for the namespace",
 		},
 		[]string{"namespace"},
 	)
 
 	memoryLimit = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "namespace_quota_memory_limit_bytes",
-			Help: "Memory limit in bytes for the namespace",
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "memory_limit_bytes",
+			Help:      "Memory limit in bytes for the namespace",
+		},
+		[]string{"namespace"},
+	)
+
+	memoryMin = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "memory_min_bytes",
+			Help:      "Protected memory (memory.min) in bytes for the namespace",
+		},
+		[]string{"namespace"},
+	)
+
+	memoryLow = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "memory_low_bytes",
+			Help:      "Best-effort protected memory (memory.low) in bytes for the namespace",
+		},
+		[]string{"namespace"},
+	)
+
+	memoryHigh = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "memory_high_bytes",
+			Help:      "Memory throttle limit (memory.high) in bytes for the namespace, 0 if unlimited",
 		},
 		[]string{"namespace"},
 	)
 
 	oomKills = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "namespace_quota_oom_kills_total",
-			Help: "Total number of OOM kills for the namespace",
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "oom_kills_total",
+			Help:      "Total number of OOM kills for the namespace",
 		},
 		[]string{"namespace"},
 	)
-)
 
-func init() {
-	prometheus.MustRegister(cpuUsage)
-	prometheus.MustRegister(cpuLimit)
-	prometheus.MustRegister(cpuThrottledPeriods)
-	prometheus.MustRegister(memoryUsage)
-	prometheus.MustRegister(memoryLimit)
-	prometheus.MustRegister(oomKills)
+	oomGroupEnabled = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "oom_group_enabled",
+			Help:      "Whether an OOM kill terminates every process of the namespace (memory.oom.group, 1=enabled)",
+		},
+		[]string{"namespace"},
+	)
+
+	cpuIdleMode = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "cpu_idle_mode",
+			Help:      "Whether the namespace slice runs as background CPU work (cpu.idle, 1=idle)",
+		},
+		[]string{"namespace"},
+	)
+
+	priorityClassValue = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "priority_class_value",
+			Help:      "Value of the PriorityClass setting the CPU weight of the namespace",
+		},
+		[]string{"namespace"},
+	)
+
+	cpuWeight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "cpu_weight",
+			Help:      "CPU weight (cpu.weight) applied to the namespace slice",
+		},
+		[]string{"namespace"},
+	)
+
+	cpuSetCPUs = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "cpuset_cpus",
+			Help:      "Effective cpuset of the namespace slice, exposed in the cpus label (always 1)",
+		},
+		[]string{"namespace", "cpus"},
+	)
+
+	cpuPressureSome = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "cpu_pressure_some_psi_ratio",
+			Help:      "Share of time at least one task in the namespace stalled on CPU",
+		},
+		[]string{"namespace", "window"},
+	)
+
+	memoryPressureSome = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "memory_pressure_some_psi_ratio",
+			Help:      "Share of time at least one task in the namespace stalled on memory",
+		},
+		[]string{"namespace", "window"},
+	)
+
+	memoryPressureFull = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "memory_pressure_full_psi_ratio",
+			Help:      "Share of time all tasks in the namespace stalled on memory",
+		},
+		[]string{"namespace", "window"},
+	)
+
+	memoryPressureLevel = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "memory_pressure_level",
+			Help:      "Memory pressure level of the namespace slice (1 for the current level, 0 for the others)",
+		},
+		[]string{"namespace", "level"},
+	)
+
+	ioPressureSome = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "io_pressure_some_psi_ratio",
+			Help:      "Share of time at least one task in the namespace stalled on IO",
+		},
+		[]string{"namespace", "window"},
+	)
+
+	hugepagesUsage = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "hugepages_usage_bytes",
+			Help:      "Hugepages used by the namespace (hugetlb.<size>.current) in bytes, by hugepage size",
+		},
+		[]string{"namespace", "size"},
+	)
+
+	pidsCurrent = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "pids_current",
+			Help:      "Number of processes and threads in the namespace slice (pids.current)",
+		},
+		[]string{"namespace"},
+	)
+
+	pidsMax = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "pids_max",
+			Help:      "Process limit of the namespace slice (pids.max, 0=unlimited)",
+		},
+		[]string{"namespace"},
+	)
+
+	leaderElectionStatus = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "leader_election_status",
+			Help:      "Whether this agent holds the leader lease (1=leader, 0=follower)",
+		},
+	)
+
+	reconcileQueueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "reconcile_queue_depth",
+			Help:      "Number of NamespaceQuota keys waiting to be reconciled",
+		},
+	)
+
+	driftDetected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "drift_detected_total",
+			Help:      "Number of reconciliations where the applied cgroup limits differed from the NamespaceQuota spec",
+		},
+		[]string{"namespace"},
+	)
+
+	reconcileDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "reconcile_duration_seconds",
+			Help:      "Duration of NamespaceQuota reconciliations",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"namespace", "result"},
+	)
+
+	reconcileTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "reconcile_total",
+			Help:      "Number of NamespaceQuota reconciliations by result",
+		},
+		[]string{"result"},
+	)
+
+	retryDelay = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "retry_delay_seconds",
+			Help:      "Backoff delay before retrying a failed NamespaceQuota reconcile",
+			Buckets:   prometheus.ExponentialBuckets(0.25, 2, 12),
+		},
+	)
+
+	orphanSlicesCleaned = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "orphan_slices_cleaned_total",
+			Help:      "Number of slices without a NamespaceQuota removed at startup",
+		},
+	)
+
+	systemdCallRateLimited = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "systemd_call_rate_limited_total",
+			Help:      "Number of systemctl calls delayed by the systemd call rate limiter",
+		},
+	)
+
+	eventsRateLimited = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "events_rate_limited_total",
+			Help:      "Number of Kubernetes events delayed by the event rate limiter",
+		},
+	)
+
+	eventsDropped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "events_dropped_total",
+			Help:      "Number of Kubernetes events dropped by the event rate limiter in favor of a later one",
+		},
+	)
+
+	systemdReachable = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "systemd_reachable",
+			Help:      "Whether systemd answered the last probe (systemctl status), 1 or 0",
+		},
+	)
+
+	systemdTimeouts = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "systemd_timeout_total",
+			Help:      "Number of systemctl calls killed after exceeding the systemd timeout",
+		},
+	)
+
+	reportGenerated = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "report_generated_total",
+			Help:      "Number of namespace reports generated",
+		},
+	)
+
+	maxRetriesExceeded = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "max_retries_exceeded_total",
+			Help:      "Number of NamespaceQuota keys dropped after exceeding the maximum reconcile retries",
+		},
+	)
+
+	filteredOut = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "filtered_out_total",
+			Help:      "Number of NamespaceQuota reconciles skipped because the namespace does not match the namespace filter",
+		},
+	)
+
+	specUnchangedSkipped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "spec_unchanged_reconciles_skipped_total",
+			Help:      "Number of NamespaceQuota reconciles skipped because the generation was already applied",
+		},
+	)
+
+	exceedsAllocatable = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "exceeds_allocatable_total",
+			Help:      "Number of NamespaceQuotas applied with a CPU or memory limit above the node allocatable resources",
+		},
+	)
+
+	metricsResponseBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "metrics_response_bytes_total",
+			Help:      "Bytes of /metrics responses, before compression (uncompressed) and as sent gzipped (compressed)",
+		},
+		[]string{"encoding"},
+	)
+
+	staleQuotas = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "stale_quotas",
+			Help:      "Number of enabled NamespaceQuotas targeting a namespace that did not exist at startup",
+		},
+	)
+
+	slicesWithoutLimits = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "slices_without_limits_total",
+			Help:      "Number of namespace slices created without CPU or memory limits",
+		},
+	)
+
+	agentGOMAXPROCS = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "agent_gomaxprocs",
+			Help:      "Current GOMAXPROCS of the agent, tuned to the CPU quota of its cgroup",
+		},
+		func() float64 { return float64(runtime.GOMAXPROCS(0)) },
+	)
+
+	cgroupVersion = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "cgroup_version",
+			Help:      "Cgroup version detected on the node, in the version label (always 1; \"0\" if unknown)",
+		},
+		[]string{"version"},
+	)
+
+	workqueueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: "workqueue",
+			Name:      "depth",
+			Help:      "Current depth of the work queue",
+		},
+		[]string{"name"},
+	)
+
+	workqueueAdds = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: "workqueue",
+			Name:      "adds_total",
+			Help:      "Number of adds handled by the work queue",
+		},
+		[]string{"name"},
+	)
+
+	workqueueLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: "workqueue",
+			Name:      "queue_duration_seconds",
+			Help:      "Time an item stays in the work queue before being processed",
+			Buckets:   prometheus.ExponentialBuckets(10e-9, 10, 10),
+		},
+		[]string{"name"},
+	)
+
+	workqueueWorkDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: "workqueue",
+			Name:      "processing_duration_seconds",
+			Help:      "Time taken to process an item from the work queue",
+			Buckets:   prometheus.ExponentialBuckets(10e-9, 10, 10),
+		},
+		[]string{"name"},
+	)
+
+	workqueueUnfinishedWork = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: "workqueue",
+			Name:      "unfinished_work_seconds",
+			Help:      "Seconds of work in progress that has not been observed by processing_duration_seconds; large values indicate stuck workers",
+		},
+		[]string{"name"},
+	)
+
+	workqueueLongestRunning = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: "workqueue",
+			Name:      "longest_running_processor_seconds",
+			Help:      "Seconds the longest running worker has been processing its item",
+		},
+		[]string{"name"},
+	)
+
+	workqueueRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: "workqueue",
+			Name:      "retries_total",
+			Help:      "Number of retries handled by the work queue",
+		},
+		[]string{"name"},
+	)
+}
+
+func agentCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		cpuUsage,
+		cpuLimit,
+		cpuThrottledPeriods,
+		cpuThrottledPct,
+		memoryUsage,
+		memoryLimit,
+		memoryMin,
+		memoryLow,
+		memoryHigh,
+		oomKills,
+		oomGroupEnabled,
+		cpuIdleMode,
+		priorityClassValue,
+		cpuWeight,
+		cpuSetCPUs,
+		cpuPressureSome,
+		memoryPressureSome,
+		memoryPressureFull,
+		memoryPressureLevel,
+		ioPressureSome,
+		hugepagesUsage,
+		pidsCurrent,
+		pidsMax,
+		leaderElectionStatus,
+		reconcileQueueDepth,
+		driftDetected,
+		reconcileDuration,
+		retryDelay,
+		reconcileTotal,
+		orphanSlicesCleaned,
+		systemdCallRateLimited,
+		eventsRateLimited,
+		eventsDropped,
+		systemdTimeouts,
+		systemdReachable,
+		reportGenerated,
+		slicesWithoutLimits,
+		staleQuotas,
+		maxRetriesExceeded,
+		filteredOut,
+		specUnchangedSkipped,
+		exceedsAllocatable,
+		metricsResponseBytes,
+		cgroupVersion,
+		agentGOMAXPROCS,
+		workqueueDepth,
+		workqueueAdds,
+		workqueueLatency,
+		workqueueWorkDuration,
+		workqueueUnfinishedWork,
+		workqueueLongestRunning,
+		workqueueRetries,
+	}
+}
+
+// workqueueMetricsProvider exposes the client-go work queue metrics through
+// the agent's collectors
+type workqueueMetricsProvider struct{}
+
+func (workqueueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return workqueueDepth.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return workqueueAdds.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return workqueueLatency.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return workqueueWorkDuration.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueUnfinishedWork.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueLongestRunning.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return workqueueRetries.WithLabelValues(name)
+}
+
+// psiWindow is the averaging window of the PSI values exported as metrics.
+const psiWindow = "10s"
+
+// newMetricsRegistry builds the agent collectors and registers them on a new
+// registry. The returned registerer adds the node label, if any, to them and
+// must be used to unregister them.
+func newMetricsRegistry(metricsNamespace, nodeName string) (*prometheus.Registry, prometheus.Registerer) {
+	newMetrics(metricsNamespace)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	var registerer prometheus.Registerer = registry
+	if nodeName != "" {
+		registerer = prometheus.WrapRegistererWith(prometheus.Labels{"node": nodeName}, registry)
+	}
+	for _, collector := range agentCollectors() {
+		registerer.MustRegister(collector)
+	}
+	return registry, registerer
+}
+
+// HealthChecker reports controller state for the /healthz and /readyz endpoints
+type HealthChecker interface {
+	// CacheSynced reports whether the informer cache has synced
+	CacheSynced() bool
+	// InitialReconcileDone reports whether every quota known at startup has been reconciled once
+	InitialReconcileDone() bool
+}
+
+// SliceEnsurer creates the slice of a namespace on demand
+type SliceEnsurer interface {
+	EnsureNamespaceSlice(ctx context.Context, namespace string) error
+}
+
+type healthResponse struct {
+	Status     string            `json:"status"`
+	Components map[string]string `json:"components"`
+}
+
+// NamespaceStatus is the per-namespace summary served by /status
+type NamespaceStatus struct {
+	Namespace      string  `json:"namespace"`
+	CPUUsagePct    float64 `json:"cpuUsagePct"`
+	MemoryUsagePct float64 `json:"memoryUsagePct"`
+	OOMKills       int64   `json:"oomKills"`
+	Ready          bool    `json:"ready"`
+}
+
+// namespaceSample keeps the raw CPU counter of the last update so the next
+// one can turn the cumulative usage into a utilisation percentage.
+type namespaceSample struct {
+	status       NamespaceStatus
+	cpuUsageUsec int64
+	sampledAt    time.Time
 }
 
 type MetricsServer struct {
-	cgroupManager *CgroupManager
-	log           *logrus.Logger
-	port          string
+	cgroupManager    *CgroupManager
+	log              *logrus.Logger
+	port             string
+	metricsNamespace string
+	registry         *prometheus.Registry
+	// registerer registers the agent collectors on registry with the node label
+	registerer prometheus.Registerer
+
+	healthMu      sync.RWMutex
+	healthChecker HealthChecker
+
+	ensurerMu    sync.RWMutex
+	sliceEnsurer SliceEnsurer
+
+	// statusCache maps namespace to its latest namespaceSample
+	statusCache sync.Map
+
+	// withoutLimits holds the namespaces whose slice has no CPU or memory limit
+	withoutLimitsMu sync.Mutex
+	withoutLimits   map[string]struct{}
+
+	// authUser and authPasswordHash enable basic auth when set (see SetBasicAuth)
+	authUser         string
+	authPasswordHash string
 }
 
-func NewMetricsServer(cgroupManager *CgroupManager, port string, log *logrus.Logger) *MetricsServer {
+// NewMetricsServer registers the agent metrics, named
+// <metricsNamespace>_quota_* and labelled with nodeName unless it is empty, on
+// a registry of its own and returns a server exposing them. The collectors
+// are package-wide, so with several servers only the latest one receives
+// updates.
+func NewMetricsServer(cgroupManager *CgroupManager, port, metricsNamespace, nodeName string, log *logrus.Logger) *MetricsServer {
+	if metricsNamespace == "" {
+		metricsNamespace = DefaultMetricsNamespace
+	}
+
+	registry, registerer := newMetricsRegistry(metricsNamespace, nodeName)
 	return &MetricsServer{
-		cgroupManager: cgroupManager,
-		log:           log,
-		port:          port,
+		cgroupManager:    cgroupManager,
+		log:              log,
+		port:             port,
+		metricsNamespace: metricsNamespace,
+		registry:         registry,
+		registerer:       registerer,
+		withoutLimits:    map[string]struct{}{},
+	}
+}
+
+// Registry returns the registry the server exposes on /metrics
+func (m *MetricsServer) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// UnregisterMetrics removes the agent metrics from the server's registry, so
+// nothing stale is served while the process shuts down.
+func (m *MetricsServer) UnregisterMetrics() {
+	for _, collector := range agentCollectors() {
+		m.registerer.Unregister(collector)
 	}
 }
 
+// SetBasicAuth requires basic auth with user and a password matching the
+// bcrypt passwordHash on every endpoint but /healthz and /readyz. It must be
+// called before Start or StartTLS.
+func (m *MetricsServer) SetBasicAuth(user, passwordHash string) {
+	m.authUser = user
+	m.authPasswordHash = passwordHash
+}
+
+// Start serves the metrics endpoints over plain HTTP
 func (m *MetricsServer) Start() error {
-	mux := http.NewServeMux()
-	mux.Handle("/metrics", promhttp.Handler())
+	handler := m.handler()
 
 	m.log.WithField("port", m.port).Info("Starting metrics server")
 
 	go func() {
-		if err := http.ListenAndServe(":"+m.port, mux); err != nil {
+		if err := http.ListenAndServe(":"+m.port, handler); err != nil {
 			m.log.WithError(err).Error("Metrics server error")
 		}
 	}()
@@ -100,21 +837,407 @@ func (m *MetricsServer) Start() error {
 	return nil
 }
 
+// StartTLS serves the metrics endpoints over HTTPS with the given certificate
+// and key
+func (m *MetricsServer) StartTLS(certFile, keyFile string) error {
+	if certFile == "" || keyFile == "" {
+		return fmt.Errorf("metrics server requires both a TLS certificate and key")
+	}
+	handler := m.handler()
+
+	m.log.WithField("port", m.port).Info("Starting metrics server with TLS")
+
+	go func() {
+		if err := http.ListenAndServeTLS(":"+m.port, certFile, keyFile, handler); err != nil {
+			m.log.WithError(err).Error("Metrics server error")
+		}
+	}()
+
+	return nil
+}
+
+func (m *MetricsServer) handler() http.Handler {
+	cgroupVersion.Reset()
+	cgroupVersion.WithLabelValues(strconv.Itoa(m.cgroupManager.GetCgroupVersion())).Set(1)
+
+	mux := http.NewServeMux()
+	// Compression is done by gzipMiddleware, which also counts the bytes served
+	mux.Handle("/metrics", gzipMiddleware(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{DisableCompression: true})))
+	mux.HandleFunc("/healthz", m.handleHealthz)
+	mux.HandleFunc("/readyz", m.handleReadyz)
+	mux.HandleFunc("/status", m.handleStatus)
+	mux.HandleFunc("/slices", m.handleSlices)
+	mux.HandleFunc("POST /slices/{namespace}", m.handleEnsureSlice)
+	mux.HandleFunc("/diagnose", m.handleDiagnose)
+	mux.HandleFunc("/hierarchy", m.handleHierarchy)
+
+	if m.authUser != "" {
+		return basicAuthMiddleware(m.authUser, m.authPasswordHash, mux)
+	}
+	return mux
+}
+
+// SetHealthChecker registers the component inspected by the health endpoints.
+// Until it is set, both endpoints report the controller as not started.
+func (m *MetricsServer) SetHealthChecker(checker HealthChecker) {
+	m.healthMu.Lock()
+	defer m.healthMu.Unlock()
+	m.healthChecker = checker
+}
+
+func (m *MetricsServer) getHealthChecker() HealthChecker {
+	m.healthMu.RLock()
+	defer m.healthMu.RUnlock()
+	return m.healthChecker
+}
+
+func (m *MetricsServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	components := map[string]string{"informer": "not started"}
+	healthy := false
+
+	if checker := m.getHealthChecker(); checker != nil {
+		healthy = checker.CacheSynced()
+		components["informer"] = statusString(healthy, "synced", "syncing")
+	}
+
+	m.writeHealth(w, healthy, components)
+}
+
+func (m *MetricsServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	components := map[string]string{
+		"informer":  "not started",
+		"reconcile": "not started",
+	}
+	ready := false
+
+	if checker := m.getHealthChecker(); checker != nil {
+		synced := checker.CacheSynced()
+		reconciled := checker.InitialReconcileDone()
+		ready = synced && reconciled
+		components["informer"] = statusString(synced, "synced", "syncing")
+		components["reconcile"] = statusString(reconciled, "complete", "pending")
+	}
+
+	m.writeHealth(w, ready, components)
+}
+
+func (m *MetricsServer) writeHealth(w http.ResponseWriter, ok bool, components map[string]string) {
+	resp := healthResponse{Status: "ok", Components: components}
+	code := http.StatusOK
+	if !ok {
+		resp.Status = "unavailable"
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		m.log.WithError(err).Debug("Failed to write health response")
+	}
+}
+
+func statusString(ok bool, okStatus, pendingStatus string) string {
+	if ok {
+		return okStatus
+	}
+	return pendingStatus
+}
+
 func (m *MetricsServer) UpdateMetrics(namespace string, stats *CgroupStats, cpuLimitUsec, memoryLimitBytes int64) {
 	cpuUsage.WithLabelValues(namespace).Set(float64(stats.CPUUsageUsec))
 	cpuLimit.WithLabelValues(namespace).Set(float64(cpuLimitUsec))
 	cpuThrottledPeriods.WithLabelValues(namespace).Set(float64(stats.CPUThrottled))
+	cpuThrottledPct.WithLabelValues(namespace).Set(stats.ThrottledPct)
 	memoryUsage.WithLabelValues(namespace).Set(float64(stats.MemoryUsageBytes))
 	memoryLimit.WithLabelValues(namespace).Set(float64(memoryLimitBytes))
+	memoryMin.WithLabelValues(namespace).Set(float64(stats.MemoryMinBytes))
+	memoryLow.WithLabelValues(namespace).Set(float64(stats.MemoryLowBytes))
+	memoryHigh.WithLabelValues(namespace).Set(float64(stats.MemoryHighBytes))
 	oomKills.WithLabelValues(namespace).Set(float64(stats.OOMKills))
+	if stats.OOMGroup {
+		oomGroupEnabled.WithLabelValues(namespace).Set(1)
+	} else {
+		oomGroupEnabled.WithLabelValues(namespace).Set(0)
+	}
+	if stats.CPUIdle {
+		cpuIdleMode.WithLabelValues(namespace).Set(1)
+	} else {
+		cpuIdleMode.WithLabelValues(namespace).Set(0)
+	}
+	cpuWeight.WithLabelValues(namespace).Set(float64(stats.CPUWeight))
+	cpuSetCPUs.DeletePartialMatch(prometheus.Labels{"namespace": namespace})
+	if stats.CPUSetEffective != "" {
+		cpuSetCPUs.WithLabelValues(namespace, stats.CPUSetEffective).Set(1)
+	}
+	cpuPressureSome.WithLabelValues(namespace, psiWindow).Set(stats.CPUPressureSomeAvg10 / 100)
+	memoryPressureSome.WithLabelValues(namespace, psiWindow).Set(stats.MemoryPressureSomeAvg10 / 100)
+	memoryPressureFull.WithLabelValues(namespace, psiWindow).Set(stats.MemoryPressureFullAvg10 / 100)
+	ioPressureSome.WithLabelValues(namespace, psiWindow).Set(stats.IOPressureSomeAvg10 / 100)
+	hugepagesUsage.DeletePartialMatch(prometheus.Labels{"namespace": namespace})
+	for size, bytes := range stats.HugepagesUsageBytes {
+		hugepagesUsage.WithLabelValues(namespace, size).Set(float64(bytes))
+	}
+	pidsCurrent.WithLabelValues(namespace).Set(float64(stats.PidsCurrent))
+	pidsMax.WithLabelValues(namespace).Set(float64(stats.PidsMax))
+}
+
+// RecordNamespaceStatus updates the /status entry of a namespace from fresh
+// cgroup stats and the limits currently applied to its slice.
+func (m *MetricsServer) RecordNamespaceStatus(namespace string, stats *CgroupStats, cpuQuotaUsec, memoryMaxBytes int64, ready bool) {
+	now := time.Now()
+	status := NamespaceStatus{
+		Namespace: namespace,
+		OOMKills:  stats.OOMKills,
+		Ready:     ready,
+	}
+
+	if memoryMaxBytes > 0 {
+		status.MemoryUsagePct = float64(stats.MemoryUsageBytes) / float64(memoryMaxBytes) * 100
+	}
+
+	if prev, ok := m.statusCache.Load(namespace); ok && cpuQuotaUsec > 0 {
+		prevSample := prev.(namespaceSample)
+		elapsedUsec := now.Sub(prevSample.sampledAt).Microseconds()
+		usedUsec := stats.CPUUsageUsec - prevSample.cpuUsageUsec
+		if elapsedUsec > 0 && usedUsec >= 0 {
+			cores := float64(cpuQuotaUsec) / float64(m.cgroupManager.CPUPeriod())
+			status.CPUUsagePct = float64(usedUsec) / (float64(elapsedUsec) * cores) * 100
+		}
+	}
+
+	m.statusCache.Store(namespace, namespaceSample{
+		status:       status,
+		cpuUsageUsec: stats.CPUUsageUsec,
+		sampledAt:    now,
+	})
+}
+
+// SetNamespaceReady updates only the readiness of a namespace's /status entry
+func (m *MetricsServer) SetNamespaceReady(namespace string, ready bool) {
+	sample := namespaceSample{status: NamespaceStatus{Namespace: namespace}}
+	if prev, ok := m.statusCache.Load(namespace); ok {
+		sample = prev.(namespaceSample)
+	}
+	sample.status.Ready = ready
+	m.statusCache.Store(namespace, sample)
+}
+
+// SetMemoryPressureLevel sets the memory_pressure_level series of namespace,
+// one per level of MemoryPressureLevels
+func (m *MetricsServer) SetMemoryPressureLevel(namespace, level string) {
+	for _, l := range MemoryPressureLevels {
+		value := 0.0
+		if l == level {
+			value = 1
+		}
+		memoryPressureLevel.WithLabelValues(namespace, l).Set(value)
+	}
+}
+
+// ForgetNamespace drops a namespace from /status once its quota is gone
+func (m *MetricsServer) ForgetNamespace(namespace string) {
+	m.statusCache.Delete(namespace)
+	m.SetSliceWithoutLimits(namespace, false)
+}
+
+// SetPriorityClassValue records the value of the PriorityClass of namespace
+func (m *MetricsServer) SetPriorityClassValue(namespace string, value int32) {
+	priorityClassValue.WithLabelValues(namespace).Set(float64(value))
+}
+
+// SetSliceWithoutLimits records whether the slice of namespace was created
+// without CPU and memory limits, only to group its containers
+func (m *MetricsServer) SetSliceWithoutLimits(namespace string, withoutLimits bool) {
+	m.withoutLimitsMu.Lock()
+	defer m.withoutLimitsMu.Unlock()
+
+	if withoutLimits {
+		m.withoutLimits[namespace] = struct{}{}
+	} else {
+		delete(m.withoutLimits, namespace)
+	}
+	slicesWithoutLimits.Set(float64(len(m.withoutLimits)))
+}
+
+func (m *MetricsServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	// The data changes on every reconciliation, so clients must not reuse it
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+
+	var body interface{}
+	if namespace := r.URL.Query().Get("namespace"); namespace != "" {
+		sample, ok := m.statusCache.Load(namespace)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			body = map[string]string{"error": "namespace " + namespace + " is not managed"}
+		} else {
+			body = sample.(namespaceSample).status
+		}
+	} else {
+		statuses := []NamespaceStatus{}
+		m.statusCache.Range(func(_, value interface{}) bool {
+			statuses = append(statuses, value.(namespaceSample).status)
+			return true
+		})
+		sort.Slice(statuses, func(i, j int) bool {
+			return statuses[i].Namespace < statuses[j].Namespace
+		})
+		body = statuses
+	}
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		m.log.WithError(err).Debug("Failed to write status response")
+	}
+}
+
+// SetSliceEnsurer registers the component creating slices on demand through
+// POST /slices/{namespace}
+func (m *MetricsServer) SetSliceEnsurer(ensurer SliceEnsurer) {
+	m.ensurerMu.Lock()
+	defer m.ensurerMu.Unlock()
+	m.sliceEnsurer = ensurer
+}
+
+// handleEnsureSlice creates the slice of a namespace with a NamespaceQuota.
+// The NRI plugin calls it when a pod sandbox starts.
+func (m *MetricsServer) handleEnsureSlice(w http.ResponseWriter, r *http.Request) {
+	m.ensurerMu.RLock()
+	ensurer := m.sliceEnsurer
+	m.ensurerMu.RUnlock()
+
+	if ensurer == nil {
+		http.Error(w, "controller not started", http.StatusServiceUnavailable)
+		return
+	}
+
+	namespace := r.PathValue("namespace")
+	err := ensurer.EnsureNamespaceSlice(r.Context(), namespace)
+	switch {
+	case errors.Is(err, ErrNoNamespaceQuota):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		m.log.WithError(err).WithField("namespace", namespace).Warn("Failed to ensure slice on request")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleSlices lists the namespaces that currently have a cgroup slice on this node
+func (m *MetricsServer) handleSlices(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+
+	namespaces, err := m.cgroupManager.ListSlices()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		if err := json.NewEncoder(w).Encode(map[string]string{"error": err.Error()}); err != nil {
+			m.log.WithError(err).Debug("Failed to write slices response")
+		}
+		return
+	}
+	if namespaces == nil {
+		namespaces = []string{}
+	}
+
+	if err := json.NewEncoder(w).Encode(namespaces); err != nil {
+		m.log.WithError(err).Debug("Failed to write slices response")
+	}
 }
 
-func (m *MetricsServer) ReadCgroupStats(namespace string) (*CgroupStats, error) {
+// handleDiagnose reports the checks of DiagnoseSlice for the namespace
+// query parameter
+func (m *MetricsServer) handleDiagnose(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+
+	namespace := r.URL.Query().Get("namespace")
+	if namespace == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(map[string]string{"error": "missing namespace query parameter"}); err != nil {
+			m.log.WithError(err).Debug("Failed to write diagnose response")
+		}
+		return
+	}
+
+	diagnostic, err := m.cgroupManager.DiagnoseSlice(namespace)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		if err := json.NewEncoder(w).Encode(map[string]string{"error": err.Error()}); err != nil {
+			m.log.WithError(err).Debug("Failed to write diagnose response")
+		}
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(diagnostic); err != nil {
+		m.log.WithError(err).Debug("Failed to write diagnose response")
+	}
+}
+
+// handleHierarchy returns the cgroup tree of GetCgroupHierarchy
+func (m *MetricsServer) handleHierarchy(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+
+	hierarchy, err := m.cgroupManager.GetCgroupHierarchy()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		if err := json.NewEncoder(w).Encode(map[string]string{"error": err.Error()}); err != nil {
+			m.log.WithError(err).Debug("Failed to write hierarchy response")
+		}
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(hierarchy); err != nil {
+		m.log.WithError(err).Debug("Failed to write hierarchy response")
+	}
+}
+
+func (m *MetricsServer) SetLeaderElectionStatus(leader bool) {
+	if leader {
+		leaderElectionStatus.Set(1)
+	} else {
+		leaderElectionStatus.Set(0)
+	}
+}
+
+func (m *MetricsServer) SetReconcileQueueDepth(depth int) {
+	reconcileQueueDepth.Set(float64(depth))
+}
+
+func (m *MetricsServer) IncDriftDetected(namespace string) {
+	driftDetected.WithLabelValues(namespace).Inc()
+}
+
+func (m *MetricsServer) IncOrphanSlicesCleaned() {
+	orphanSlicesCleaned.Inc()
+}
+
+// SetStaleQuotas records the enabled quotas whose namespace does not exist
+func (m *MetricsServer) SetStaleQuotas(count int) {
+	staleQuotas.Set(float64(count))
+}
+
+func (m *MetricsServer) IncMaxRetriesExceeded() {
+	maxRetriesExceeded.Inc()
+}
+
+// ObserveReconcile records the duration and result ("success" or "error") of a reconcile
+func (m *MetricsServer) ObserveReconcile(namespace, result string, duration time.Duration) {
+	reconcileDuration.WithLabelValues(namespace, result).Observe(duration.Seconds())
+	reconcileTotal.WithLabelValues(result).Inc()
+}
+
+func (m *MetricsServer) ReadCgroupStats(ctx context.Context, namespace string) (*CgroupStats, error) {
+	_, span := startSpan(ctx, "MetricsServer.ReadCgroupStats", attribute.String("namespace", namespace))
+	defer span.End()
+
 	slicePath := m.cgroupManager.GetSlicePath(namespace)
 	stats := &CgroupStats{}
 
 	cpuStatPath := filepath.Join(slicePath, "cpu.stat")
 	if content, err := os.ReadFile(cpuStatPath); err == nil {
+		var nrPeriods, nrThrottled int64
 		for _, line := range strings.Split(string(content), "\n") {
 			parts := strings.Fields(line)
 			if len(parts) != 2 {
@@ -124,10 +1247,13 @@ func (m *MetricsServer) ReadCgroupStats(namespace string) (*CgroupStats, error)
 			switch parts[0] {
 			case "usage_usec":
 				stats.CPUUsageUsec = value
+			case "nr_periods":
+				nrPeriods = value
 			case "nr_throttled":
-				stats.CPUThrottled = value
+				nrThrottled = value
 			}
 		}
+		stats.setThrottling(nrPeriods, nrThrottled)
 	}
 
 	memoryCurrentPath := filepath.Join(slicePath, "memory.current")
@@ -146,5 +1272,17 @@ func (m *MetricsServer) ReadCgroupStats(namespace string) (*CgroupStats, error)
 		}
 	}
 
+	stats.CPUWeight, _ = readCPUWeight(slicePath)
+	stats.CPUSetEffective, _ = readCPUSetEffective(slicePath)
+	stats.MemoryMinBytes, stats.MemoryLowBytes = readMemoryProtection(slicePath)
+	stats.MemoryHighBytes = readMemoryHigh(slicePath)
+	stats.OOMGroup = readOOMGroup(slicePath)
+	stats.HugepagesUsageBytes = readHugepagesUsage(slicePath)
+	stats.CPUIdle = readCPUIdle(slicePath)
+	stats.PidsCurrent, _ = readPidsCurrent(slicePath)
+	stats.PidsMax = readPidsMax(slicePath)
+
+	m.cgroupManager.readPressureStats(slicePath, stats)
+
 	return stats, nil
 }
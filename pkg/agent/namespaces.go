@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// namespaceFilter restricts the namespaces whose quotas the agent manages
+// (--namespace-filter-label, --namespace-prefix)
+type namespaceFilter struct {
+	// selector matches the namespace labels; nil matches every namespace
+	selector labels.Selector
+	prefix   string
+	lister   corelisters.NamespaceLister
+}
+
+// matches reports whether the agent manages the quotas of namespace
+func (f namespaceFilter) matches(namespace string) bool {
+	if !strings.HasPrefix(namespace, f.prefix) {
+		return false
+	}
+	if f.selector == nil {
+		return true
+	}
+	ns, err := f.lister.Get(namespace)
+	return err == nil && f.selector.Matches(labels.Set(ns.Labels))
+}
+
+// newNamespaceInformer watches the namespaces matching labelSelector (all if
+// empty) so the quotas targeting a namespace are reconciled when it is
+// created or deleted, or starts or stops matching. It is only started by the
+// replica running the controller.
+func (c *Controller) newNamespaceInformer(labelSelector string) (cache.SharedIndexInformer, corelisters.NamespaceLister) {
+	factory := informers.NewSharedInformerFactoryWithOptions(c.k8sClient.GetClientset(), c.resyncPeriod,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = labelSelector
+		}))
+	namespaces := factory.Core().V1().Namespaces()
+	informer := namespaces.Informer()
+
+	informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			// Existing namespaces are covered by the initial reconcile
+			if !isInInitialList {
+				c.enqueueNamespaceQuotas(obj)
+			}
+		},
+		DeleteFunc: c.enqueueNamespaceQuotas,
+	})
+
+	return informer, namespaces.Lister()
+}
+
+// enqueueNamespaceQuotas enqueues every quota targeting the namespace obj
+func (c *Controller) enqueueNamespaceQuotas(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	ns, ok := obj.(*corev1.Namespace)
+	if !ok {
+		return
+	}
+
+	quotas, err := c.lister.List(labels.Everything())
+	if err != nil {
+		c.log.WithError(err).Warn("Failed to list NamespaceQuotas")
+		return
+	}
+	for _, quota := range quotas {
+		if quota.Spec.Namespace != ns.Name {
+			continue
+		}
+		key, err := cache.MetaNamespaceKeyFunc(quota)
+		if err != nil {
+			c.log.WithError(err).Error("Failed to get key for namespace event")
+			continue
+		}
+		c.log.WithFields(logrus.Fields{
+			"key":       key,
+			"namespace": ns.Name,
+		}).Debug("Namespace event received")
+		c.reconciler.forgetGeneration(key)
+		c.workqueue.Add(key)
+	}
+}
@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// oomWatchSyncInterval is how often new slices are picked up by runOOMWatch
+	oomWatchSyncInterval = 30 * time.Second
+
+	// DefaultOOMEventInterval is the default minimum interval between the
+	// OOMKilled events of a namespace
+	DefaultOOMEventInterval = time.Minute
+)
+
+// runOOMWatch watches the oom_kill counter of every slice on the node and
+// emits a Warning event on the namespace as soon as it increases, instead of
+// waiting for the next metrics scrape.
+func (c *Controller) runOOMWatch(ctx context.Context) {
+	var mu sync.Mutex
+	watching := make(map[string]bool)
+
+	ticker := time.NewTicker(oomWatchSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		namespaces, err := c.cgroupManager.ListSlices()
+		if err != nil {
+			c.log.WithError(err).Warn("Failed to list slices for OOM kill watch")
+		}
+		for _, namespace := range namespaces {
+			mu.Lock()
+			watched := watching[namespace]
+			mu.Unlock()
+			if watched {
+				continue
+			}
+
+			values, err := c.cgroupManager.WatchCgroupEvents(ctx, namespace, "oom_kill")
+			if err != nil {
+				c.log.WithError(err).WithField("namespace", namespace).Debug("Failed to watch OOM kills")
+				continue
+			}
+			mu.Lock()
+			watching[namespace] = true
+			mu.Unlock()
+
+			go func() {
+				c.emitOOMKills(namespace, values)
+				mu.Lock()
+				delete(watching, namespace)
+				mu.Unlock()
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// emitOOMKills emits an event for increases of the oom_kill counter read
+// from values, until the channel is closed. Within oomEventInterval of the
+// previous event, kills are only logged and counted in the next event.
+func (c *Controller) emitOOMKills(namespace string, values <-chan int64) {
+	last, ok := <-values
+	if !ok {
+		return
+	}
+	emitted := last
+	var emittedAt time.Time
+
+	for value := range values {
+		if value > last {
+			c.log.WithFields(logrus.Fields{
+				"namespace": namespace,
+				"oom_kills": value - last,
+			}).Warn("Processes OOM killed in namespace slice")
+		}
+		last = value
+		if value <= emitted || time.Since(emittedAt) < c.oomEventInterval {
+			continue
+		}
+		c.k8sClient.EmitEvent(namespace, corev1.EventTypeWarning, reasonOOMKilled,
+			fmt.Sprintf("%d process(es) OOM killed in the namespace cgroup slice, %d since it was created", value-emitted, value))
+		emitted = value
+		emittedAt = time.Now()
+	}
+}
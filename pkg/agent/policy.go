@@ -0,0 +1,259 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/api/v1alpha1"
+	"github.com/fulcro-cloud/namespace-isolation/pkg/client/informers/externalversions"
+	listers "github.com/fulcro-cloud/namespace-isolation/pkg/client/listers/brasa/v1alpha1"
+)
+
+const (
+	policyWorkqueueName = "namespaceisolationpolicy"
+	policySyncTimeout   = 30 * time.Second
+)
+
+// PolicyController keeps a NamespaceQuota for every namespace selected by a
+// NamespaceIsolationPolicy. Its queue is keyed by namespace name: policy
+// changes enqueue every namespace, namespace and quota changes only theirs.
+//
+// A NamespaceQuota created for the namespace by other means (by hand or from
+// annotations) overrides the policy, and the policy quota is removed.
+type PolicyController struct {
+	k8sClient         *K8sClient
+	quotaLister       listers.NamespaceQuotaLister
+	policyInformer    cache.SharedIndexInformer
+	policyLister      listers.NamespaceIsolationPolicyLister
+	namespaceInformer cache.SharedIndexInformer
+	namespaceLister   corelisters.NamespaceLister
+	workqueue         workqueue.TypedRateLimitingInterface[string]
+	maxRetries        int
+	log               *logrus.Logger
+}
+
+// NewPolicyController builds a PolicyController. quotaInformer is the
+// controller's NamespaceQuota informer, shared to see override quotas.
+func NewPolicyController(k8sClient *K8sClient, quotaInformer cache.SharedIndexInformer, quotaLister listers.NamespaceQuotaLister, resyncPeriod time.Duration, maxRetries int, log *logrus.Logger) *PolicyController {
+	policyInformer := externalversions.NewSharedInformerFactory(k8sClient.GetQuotaClientset(), resyncPeriod).
+		Brasa().V1alpha1().NamespaceIsolationPolicies()
+	namespaceInformer := informers.NewSharedInformerFactory(k8sClient.GetClientset(), resyncPeriod).
+		Core().V1().Namespaces()
+
+	p := &PolicyController{
+		k8sClient:         k8sClient,
+		quotaLister:       quotaLister,
+		policyInformer:    policyInformer.Informer(),
+		policyLister:      policyInformer.Lister(),
+		namespaceInformer: namespaceInformer.Informer(),
+		namespaceLister:   namespaceInformer.Lister(),
+		workqueue: workqueue.NewTypedRateLimitingQueueWithConfig(workqueue.DefaultTypedControllerRateLimiter[string](),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: policyWorkqueueName}),
+		maxRetries: maxRetries,
+		log:        log,
+	}
+
+	p.policyInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { p.enqueueAllNamespaces() },
+		UpdateFunc: func(interface{}, interface{}) { p.enqueueAllNamespaces() },
+		DeleteFunc: func(interface{}) { p.enqueueAllNamespaces() },
+	})
+	p.namespaceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    p.enqueueNamespace,
+		UpdateFunc: func(_, newObj interface{}) { p.enqueueNamespace(newObj) },
+		DeleteFunc: p.enqueueNamespace,
+	})
+	quotaInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    p.enqueueQuotaNamespace,
+		UpdateFunc: func(_, newObj interface{}) { p.enqueueQuotaNamespace(newObj) },
+		DeleteFunc: p.enqueueQuotaNamespace,
+	})
+
+	return p
+}
+
+// Run syncs the policy quotas until ctx is cancelled. It expects the
+// NamespaceQuota informer to be running and synced.
+func (p *PolicyController) Run(ctx context.Context) {
+	defer p.workqueue.ShutDown()
+
+	go p.policyInformer.Run(ctx.Done())
+	go p.namespaceInformer.Run(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), p.policyInformer.HasSynced, p.namespaceInformer.HasSynced) {
+		p.log.Error("Failed to sync NamespaceIsolationPolicy informer cache")
+		return
+	}
+	p.log.Info("Creating NamespaceQuotas from NamespaceIsolationPolicies")
+
+	go func() {
+		for p.processNextItem(ctx) {
+		}
+	}()
+
+	<-ctx.Done()
+}
+
+func (p *PolicyController) processNextItem(ctx context.Context) bool {
+	namespace, shutdown := p.workqueue.Get()
+	if shutdown {
+		return false
+	}
+	defer p.workqueue.Done(namespace)
+
+	err := p.syncNamespace(ctx, namespace)
+	if err == nil {
+		p.workqueue.Forget(namespace)
+		return true
+	}
+
+	if p.workqueue.NumRequeues(namespace) < p.maxRetries {
+		p.log.WithFields(logrus.Fields{
+			"namespace": namespace,
+			"error":     err,
+			"retries":   p.workqueue.NumRequeues(namespace),
+		}).Warn("Failed to sync policy NamespaceQuota, retrying")
+		p.workqueue.AddRateLimited(namespace)
+		return true
+	}
+
+	p.log.WithFields(logrus.Fields{
+		"namespace": namespace,
+		"error":     err,
+	}).Error("Max retries exceeded, dropping policy NamespaceQuota sync")
+	p.workqueue.Forget(namespace)
+	return true
+}
+
+// syncNamespace creates, updates or deletes the policy quota of namespace
+func (p *PolicyController) syncNamespace(ctx context.Context, namespace string) error {
+	ctx, cancel := context.WithTimeout(ctx, policySyncTimeout)
+	defer cancel()
+
+	// The cache avoids API calls for the status updates of the quota itself
+	current, _ := p.quotaLister.Get(PolicyQuotaName(namespace))
+
+	ns, err := p.namespaceLister.Get(namespace)
+	if apierrors.IsNotFound(err) {
+		return p.deletePolicyQuota(ctx, current)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get namespace %s: %w", namespace, err)
+	}
+
+	overridden, err := p.hasOverrideQuota(namespace)
+	if err != nil {
+		return err
+	}
+	policy := p.matchingPolicy(ns)
+	if overridden || policy == nil {
+		return p.deletePolicyQuota(ctx, current)
+	}
+
+	if current != nil && current.Labels[LabelPolicy] == policy.Name &&
+		current.Spec.CPU == policy.Spec.CPU && current.Spec.Memory == policy.Spec.Memory {
+		return nil
+	}
+
+	if err := p.k8sClient.UpsertPolicyQuota(ctx, policy.Name, namespace, policy.Spec.CPU, policy.Spec.Memory); err != nil {
+		return err
+	}
+	p.log.WithFields(logrus.Fields{
+		"namespace": namespace,
+		"policy":    policy.Name,
+		"cpu":       policy.Spec.CPU,
+		"memory":    policy.Spec.Memory,
+	}).Debug("NamespaceQuota synced from policy")
+	return nil
+}
+
+func (p *PolicyController) deletePolicyQuota(ctx context.Context, quota *v1alpha1.NamespaceQuota) error {
+	if quota == nil || quota.Labels[LabelPolicy] == "" {
+		return nil
+	}
+	return p.k8sClient.DeletePolicyQuota(ctx, quota.Spec.Namespace)
+}
+
+// matchingPolicy returns the policy selecting ns. When several policies
+// select it, the first one by name wins.
+func (p *PolicyController) matchingPolicy(ns *corev1.Namespace) *v1alpha1.NamespaceIsolationPolicy {
+	policies, err := p.policyLister.List(labels.Everything())
+	if err != nil {
+		p.log.WithError(err).Warn("Failed to list NamespaceIsolationPolicies")
+		return nil
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].Name < policies[j].Name
+	})
+
+	for _, policy := range policies {
+		selector := labels.Everything()
+		if policy.Spec.NamespaceSelector != nil {
+			selector, err = metav1.LabelSelectorAsSelector(policy.Spec.NamespaceSelector)
+			if err != nil {
+				p.log.WithError(err).WithField("policy", policy.Name).Warn("Skipping policy with invalid namespace selector")
+				continue
+			}
+		}
+		if selector.Matches(labels.Set(ns.Labels)) {
+			return policy
+		}
+	}
+	return nil
+}
+
+// hasOverrideQuota reports whether a NamespaceQuota not created from a policy
+// targets namespace
+func (p *PolicyController) hasOverrideQuota(namespace string) (bool, error) {
+	quotas, err := p.quotaLister.List(labels.Everything())
+	if err != nil {
+		return false, fmt.Errorf("failed to list NamespaceQuotas: %w", err)
+	}
+	for _, quota := range quotas {
+		if quota.Spec.Namespace == namespace && quota.Labels[LabelPolicy] == "" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (p *PolicyController) enqueueAllNamespaces() {
+	namespaces, err := p.namespaceLister.List(labels.Everything())
+	if err != nil {
+		p.log.WithError(err).Warn("Failed to list namespaces")
+		return
+	}
+	for _, ns := range namespaces {
+		p.workqueue.Add(ns.Name)
+	}
+}
+
+func (p *PolicyController) enqueueNamespace(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if ns, ok := obj.(*corev1.Namespace); ok {
+		p.workqueue.Add(ns.Name)
+	}
+}
+
+func (p *PolicyController) enqueueQuotaNamespace(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if quota, ok := obj.(*v1alpha1.NamespaceQuota); ok {
+		p.workqueue.Add(quota.Spec.Namespace)
+	}
+}
@@ -0,0 +1,948 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/api/v1alpha1"
+	listers "github.com/fulcro-cloud/namespace-isolation/pkg/client/listers/brasa/v1alpha1"
+)
+
+// ReconcileRequest names the NamespaceQuota to reconcile. Quotas are
+// cluster-scoped, so the key is the quota name.
+type ReconcileRequest struct {
+	Key string
+}
+
+// ReconcileResult tells the caller whether to process a request again after
+// a successful reconcile; RequeueAfter takes precedence over Requeue. Failed
+// reconciles are always retried with backoff.
+type ReconcileResult struct {
+	Requeue      bool
+	RequeueAfter time.Duration
+}
+
+// Reconciler applies one NamespaceQuota to the node. It does not deal with
+// informers or work queues, which the Controller provides.
+type Reconciler interface {
+	Reconcile(ctx context.Context, req ReconcileRequest) (ReconcileResult, error)
+}
+
+// NamespaceQuotaReconciler configures the cgroup slice of a NamespaceQuota
+// and reports the outcome in its status, events and metrics.
+type NamespaceQuotaReconciler struct {
+	k8sClient     *K8sClient
+	cgroupManager *CgroupManager
+	metricsServer *MetricsServer
+	lister        listers.NamespaceQuotaLister
+	log           *logrus.Logger
+
+	// nodeName is the node the agent runs on (--node-name, by default
+	// NODE_NAME set through the downward API), used to evaluate
+	// NamespaceQuota node selectors.
+	nodeName string
+
+	resourceQuotaFallback bool
+
+	// priorityClassWeightDivisor scales PriorityClass values to CPUWeight
+	// (see priorityClassWeight)
+	priorityClassWeightDivisor int32
+
+	// namespaceFilter skips the quotas of namespaces the agent does not manage
+	namespaceFilter namespaceFilter
+
+	// pendingRenames maps the keys of quotas whose spec.namespace changed to
+	// the namespace their slice still has
+	renamesMu      sync.Mutex
+	pendingRenames map[string]string
+
+	// processed maps the keys of quotas whose limits were last applied or
+	// found in sync to the generation and effective spec of that reconcile,
+	// so events that do not change the spec skip the work (see
+	// forgetGeneration)
+	processedMu sync.Mutex
+	processed   map[string]processedQuota
+
+	// quotaNamespaces maps the keys of the quotas seen by Reconcile to their
+	// target namespace, so the slice of a quota gone from the cache is still
+	// found. The cleanup finalizer is shared by the agents of all nodes, so
+	// the quota usually disappears before most of them saw it terminating.
+	namespacesMu    sync.Mutex
+	quotaNamespaces map[string]string
+
+	// lastEventState maps each namespace to the reason and message of the
+	// last event emitted for its quota, so stable quotas do not emit the
+	// same event on every reconcile
+	eventsMu       sync.Mutex
+	lastEventState map[string]string
+}
+
+var _ Reconciler = (*NamespaceQuotaReconciler)(nil)
+
+// processedQuota is the generation of a quota whose limits are in place, with
+// its spec after ConfigMap references, fallback and PriorityClass applied
+type processedQuota struct {
+	generation int64
+	spec       *v1alpha1.NamespaceQuotaSpec
+}
+
+func (r *NamespaceQuotaReconciler) observeReconcile(namespace string, start time.Time, err error) {
+	if r.metricsServer == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	r.metricsServer.ObserveReconcile(namespace, result, time.Since(start))
+}
+
+// Reconcile applies the NamespaceQuota named req.Key to its cgroup slice, or
+// removes the slice if the quota is gone.
+func (r *NamespaceQuotaReconciler) Reconcile(ctx context.Context, req ReconcileRequest) (_ ReconcileResult, err error) {
+	key := req.Key
+	ctx, span := startSpan(ctx, "NamespaceQuotaReconciler.Reconcile", attribute.String("key", key))
+	defer func() { endSpan(span, err) }()
+
+	// Deleted quotas are labelled by key
+	namespace := key
+	start := time.Now()
+	filtered := false
+	defer func() {
+		if !filtered {
+			r.observeReconcile(namespace, start, err)
+		}
+	}()
+
+	log := r.log.WithField("key", key)
+	log.Debug("Reconciling NamespaceQuota")
+
+	quota, err := r.lister.Get(key)
+	if apierrors.IsNotFound(err) {
+		log.Info("NamespaceQuota deleted, removing cgroup")
+		return ReconcileResult{}, r.handleDelete(key)
+	}
+	if err != nil {
+		return ReconcileResult{}, fmt.Errorf("failed to get object from cache: %w", err)
+	}
+
+	if quota.Spec.Namespace != "" {
+		namespace = quota.Spec.Namespace
+		r.recordNamespace(key, namespace)
+	}
+
+	if !r.namespaceFilter.matches(namespace) {
+		log.WithField("namespace", namespace).Debug("Namespace not managed by this agent, skipping")
+		filteredOut.Inc()
+		filtered = true
+		return ReconcileResult{}, nil
+	}
+
+	if quota.DeletionTimestamp != nil {
+		return ReconcileResult{}, r.handleFinalize(ctx, quota)
+	}
+
+	if err := ValidateNamespaceQuotaSpec(&quota.Spec); err != nil {
+		log.WithError(err).Error("Invalid NamespaceQuota spec")
+		r.setNamespaceReady(quota.Spec.Namespace, false)
+		message := fmt.Sprintf("Parse error: %v", err)
+		r.updateStatus(ctx, quota, false, message,
+			newCondition(v1alpha1.ConditionSpecValid, false, v1alpha1.ReasonParseError, err.Error()),
+			newCondition(v1alpha1.ConditionCgroupReady, false, v1alpha1.ReasonParseError, message))
+		r.emitEvent(quota, corev1.EventTypeWarning, reasonCgroupFailed,
+			fmt.Sprintf("Failed to parse NamespaceQuota: %v", err))
+		return ReconcileResult{}, err
+	}
+
+	if oldNamespace, ok := r.takePendingRename(key); ok && oldNamespace != quota.Spec.Namespace {
+		log.WithFields(logrus.Fields{
+			"old_namespace": oldNamespace,
+			"new_namespace": quota.Spec.Namespace,
+		}).Info("Target namespace changed, moving cgroup slice")
+		if err := r.cgroupManager.RenameCgroupSlice(oldNamespace, quota.Spec.Namespace); err != nil {
+			r.addPendingRename(key, oldNamespace)
+			return ReconcileResult{}, err
+		}
+		r.forgetNamespace(oldNamespace)
+		r.resetEventState(oldNamespace)
+	}
+
+	if processed, ok := r.processedGeneration(key); ok && processed.generation == quota.Generation {
+		log.Debug("Spec unchanged since last reconcile, skipping")
+		specUnchangedSkipped.Inc()
+		r.updateMetrics(ctx, processed.spec)
+		return ReconcileResult{}, nil
+	}
+
+	return ReconcileResult{}, r.handleQuota(ctx, quota)
+}
+
+func (r *NamespaceQuotaReconciler) processedGeneration(key string) (processedQuota, bool) {
+	r.processedMu.Lock()
+	defer r.processedMu.Unlock()
+	processed, ok := r.processed[key]
+	return processed, ok
+}
+
+func (r *NamespaceQuotaReconciler) recordProcessed(quota *v1alpha1.NamespaceQuota, spec *v1alpha1.NamespaceQuotaSpec) {
+	r.processedMu.Lock()
+	defer r.processedMu.Unlock()
+	r.processed[quota.Name] = processedQuota{generation: quota.Generation, spec: spec}
+}
+
+// forgetGeneration makes the next reconcile of key check the slice even if
+// the spec did not change, e.g. because the namespace, a referenced ConfigMap
+// or the slice itself may have changed
+func (r *NamespaceQuotaReconciler) forgetGeneration(key string) {
+	r.processedMu.Lock()
+	defer r.processedMu.Unlock()
+	delete(r.processed, key)
+}
+
+func (r *NamespaceQuotaReconciler) recordNamespace(key, namespace string) {
+	r.namespacesMu.Lock()
+	defer r.namespacesMu.Unlock()
+	r.quotaNamespaces[key] = namespace
+}
+
+// takeNamespace returns the target namespace last seen for the quota with
+// key, defaulting to the key itself
+func (r *NamespaceQuotaReconciler) takeNamespace(key string) string {
+	r.namespacesMu.Lock()
+	defer r.namespacesMu.Unlock()
+	namespace, ok := r.quotaNamespaces[key]
+	delete(r.quotaNamespaces, key)
+	if !ok {
+		return key
+	}
+	return namespace
+}
+
+// addPendingRename records that the slice of the quota with key still belongs
+// to oldNamespace. Of several changes before a reconcile, the first one wins,
+// as that is where the slice is.
+func (r *NamespaceQuotaReconciler) addPendingRename(key, oldNamespace string) {
+	r.renamesMu.Lock()
+	defer r.renamesMu.Unlock()
+	if _, ok := r.pendingRenames[key]; !ok {
+		r.pendingRenames[key] = oldNamespace
+	}
+}
+
+// emitEvent emits an event on quota unless it repeats the last one emitted
+// for the quota's namespace
+func (r *NamespaceQuotaReconciler) emitEvent(quota *v1alpha1.NamespaceQuota, eventType, reason, message string) {
+	state := reason + ": " + message
+
+	r.eventsMu.Lock()
+	duplicate := r.lastEventState[quota.Spec.Namespace] == state
+	r.lastEventState[quota.Spec.Namespace] = state
+	r.eventsMu.Unlock()
+
+	if duplicate {
+		return
+	}
+	r.k8sClient.EmitEventForObject(quota, eventType, reason, message)
+}
+
+// resetEventState lets the next event of namespace through, e.g. after its
+// quota changed
+func (r *NamespaceQuotaReconciler) resetEventState(namespace string) {
+	r.eventsMu.Lock()
+	defer r.eventsMu.Unlock()
+	delete(r.lastEventState, namespace)
+}
+
+func (r *NamespaceQuotaReconciler) takePendingRename(key string) (string, bool) {
+	r.renamesMu.Lock()
+	defer r.renamesMu.Unlock()
+	oldNamespace, ok := r.pendingRenames[key]
+	delete(r.pendingRenames, key)
+	return oldNamespace, ok
+}
+
+func (r *NamespaceQuotaReconciler) handleQuota(ctx context.Context, quota *v1alpha1.NamespaceQuota) error {
+	name := quota.Name
+	spec := &quota.Spec
+	log := r.log.WithFields(logrus.Fields{
+		"name":      name,
+		"namespace": spec.Namespace,
+		"cpu":       r.cgroupManager.displayCPU(spec.CPU),
+		"memory":    displayMemory(spec.Memory),
+		"cpuWeight": spec.CPUWeight,
+		"cpuSet":    spec.CPUSet,
+		"enabled":   quota.IsEnabled(),
+	})
+
+	if !quota.IsEnabled() {
+		log.Info("Quota disabled, removing cgroup if exists")
+		if err := r.cgroupManager.RemoveSlice(spec.Namespace); err != nil {
+			log.WithError(err).Warn("Failed to remove cgroup slice")
+		}
+		r.forgetNamespace(spec.Namespace)
+		r.updateStatus(ctx, quota, true, "Quota disabled",
+			newCondition(v1alpha1.ConditionSpecValid, true, v1alpha1.ReasonSpecValid, "Spec is valid"),
+			newCondition(v1alpha1.ConditionCgroupReady, false, v1alpha1.ReasonQuotaDisabled, "Quota disabled, cgroup removed"))
+		r.emitEvent(quota, corev1.EventTypeNormal, reasonQuotaDisabled,
+			"Quota disabled, cgroup removed")
+		return nil
+	}
+
+	exists, err := r.k8sClient.NamespaceExists(ctx, spec.Namespace)
+	if err != nil {
+		log.WithError(err).Error("Failed to look up target namespace")
+		r.updateStatus(ctx, quota, false, fmt.Sprintf("Namespace error: %v", err))
+		return err
+	}
+	if !exists {
+		// Not retried: the namespace watch enqueues the quota once the
+		// namespace is created
+		log.Warn("Target namespace does not exist, removing cgroup if exists")
+		if r.cgroupManager.SliceExists(spec.Namespace) {
+			if err := r.cgroupManager.RemoveSlice(spec.Namespace); err != nil {
+				log.WithError(err).Warn("Failed to remove cgroup slice")
+			}
+		}
+		r.forgetNamespace(spec.Namespace)
+		r.updateStatus(ctx, quota, false, "Target namespace does not exist",
+			newCondition(v1alpha1.ConditionSpecValid, true, v1alpha1.ReasonSpecValid, "Spec is valid"),
+			newCondition(v1alpha1.ConditionCgroupReady, false, v1alpha1.ReasonNamespaceNotFound,
+				fmt.Sprintf("Namespace %s does not exist", spec.Namespace)))
+		r.emitEvent(quota, corev1.EventTypeWarning, reasonNamespaceNotFound,
+			fmt.Sprintf("Target namespace %s does not exist", spec.Namespace))
+		return nil
+	}
+
+	selected, err := r.nodeSelected(ctx, spec.NodeSelector)
+	if err != nil {
+		log.WithError(err).Error("Failed to evaluate node selector")
+		r.updateStatus(ctx, quota, false, fmt.Sprintf("Node selector error: %v", err))
+		return err
+	}
+	if !selected {
+		log.WithField("node", r.nodeName).Debug("Node not selected, removing cgroup if exists")
+		if r.cgroupManager.SliceExists(spec.Namespace) {
+			if err := r.cgroupManager.RemoveSlice(spec.Namespace); err != nil {
+				log.WithError(err).Warn("Failed to remove cgroup slice")
+			}
+		}
+		r.forgetNamespace(spec.Namespace)
+		r.updateStatus(ctx, quota, true, "Node not selected",
+			newCondition(v1alpha1.ConditionSpecValid, true, v1alpha1.ReasonSpecValid, "Spec is valid"),
+			newCondition(v1alpha1.ConditionCgroupReady, false, v1alpha1.ReasonNodeNotSelected,
+				fmt.Sprintf("Node %s does not match the node selector", r.nodeName)))
+		return nil
+	}
+
+	resolved, err := r.applyConfigMapRefs(ctx, spec)
+	if err != nil {
+		log.WithError(err).Error("Failed to read limits from ConfigMap")
+		r.updateStatus(ctx, quota, false, fmt.Sprintf("ConfigMap error: %v", err))
+		return err
+	}
+	if resolved != nil {
+		spec = resolved
+		log.WithFields(logrus.Fields{
+			"cpu":    r.cgroupManager.displayCPU(spec.CPU),
+			"memory": displayMemory(spec.Memory),
+		}).Debug("Read limits from ConfigMap")
+	}
+
+	fallback, err := r.applyResourceQuotaFallback(ctx, spec)
+	if err != nil {
+		log.WithError(err).Error("Failed to read ResourceQuota limits")
+		r.updateStatus(ctx, quota, false, fmt.Sprintf("ResourceQuota error: %v", err))
+		return err
+	}
+	if fallback != nil {
+		spec = fallback
+		log.WithFields(logrus.Fields{
+			"cpu":    r.cgroupManager.displayCPU(spec.CPU),
+			"memory": displayMemory(spec.Memory),
+		}).Warn("Using ResourceQuota limits as fallback")
+	}
+
+	if spec.PriorityClass != "" {
+		weighted, err := r.applyPriorityClass(ctx, spec)
+		if err != nil {
+			log.WithError(err).Error("Failed to read PriorityClass")
+			r.updateStatus(ctx, quota, false, fmt.Sprintf("PriorityClass error: %v", err))
+			return err
+		}
+		spec = weighted
+	}
+
+	drifted, err := r.detectDrift(spec)
+	if err != nil {
+		log.WithError(err).Warn("Failed to compare cgroup limits, reapplying")
+		drifted = true
+	}
+	if !drifted {
+		log.Debug("Cgroup limits in sync")
+		if err := r.k8sClient.AddFinalizer(ctx, quota, cgroupCleanupFinalizer); err != nil {
+			log.WithError(err).Error("Failed to add cleanup finalizer")
+			return err
+		}
+		if !meta.IsStatusConditionTrue(quota.Status.Conditions, v1alpha1.ConditionCgroupReady) {
+			r.updateStatus(ctx, quota, true, r.configuredMessage(spec, fallback != nil), readyConditions()...)
+		}
+		r.updateMetrics(ctx, spec)
+		r.recordProcessed(quota, spec)
+		return nil
+	}
+
+	// Not retried: the systemd probe enqueues every quota once systemd
+	// answers again
+	if !r.cgroupManager.DryRun && !r.cgroupManager.SystemdHealthy() {
+		log.Warn("systemd unreachable, not applying limits")
+		message := "systemd unreachable, limits not applied"
+		r.setNamespaceReady(spec.Namespace, false)
+		r.updateStatus(ctx, quota, false, message,
+			newCondition(v1alpha1.ConditionSpecValid, true, v1alpha1.ReasonSpecValid, "Spec is valid"),
+			newCondition(v1alpha1.ConditionSystemdReachable, false, v1alpha1.ReasonSystemdUnreachable, "systemd did not answer the last health probe"),
+			newCondition(v1alpha1.ConditionCgroupReady, false, v1alpha1.ReasonSystemdUnreachable, message))
+		return nil
+	}
+
+	r.checkAllocatable(ctx, quota, spec)
+
+	log.Info("Ensuring cgroup slice")
+	if err := r.cgroupManager.EnsureSlice(ctx, spec.Namespace, sliceLimits(spec)); err != nil {
+		log.WithError(err).Error("Failed to ensure cgroup slice")
+		r.setNamespaceReady(spec.Namespace, false)
+		r.updateStatus(ctx, quota, false, fmt.Sprintf("Cgroup error: %v", err), failureConditions(err)...)
+		r.emitEvent(quota, corev1.EventTypeWarning, reasonCgroupFailed,
+			fmt.Sprintf("Failed to configure cgroup: %v", err))
+		return err
+	}
+
+	if r.cgroupManager.DryRun {
+		// Nothing was applied, so leave the object without a finalizer that
+		// would otherwise block deletion once the agent is removed.
+		r.updateStatus(ctx, quota, false, dryRunStatusMessage)
+		r.updateMetrics(ctx, spec)
+		return nil
+	}
+
+	if err := r.k8sClient.AddFinalizer(ctx, quota, cgroupCleanupFinalizer); err != nil {
+		log.WithError(err).Error("Failed to add cleanup finalizer")
+		return err
+	}
+
+	message := r.configuredMessage(spec, fallback != nil)
+	r.updateStatus(ctx, quota, true, message, readyConditions()...)
+	r.emitEvent(quota, corev1.EventTypeNormal, reasonCgroupConfigured, message)
+
+	r.updateMetrics(ctx, spec)
+	r.recordProcessed(quota, spec)
+
+	return nil
+}
+
+// detectDrift reports whether the limits applied to the namespace slice differ
+// from the spec. A missing slice always counts as drift; a slice that exists
+// but is out of sync is also recorded in the drift metric.
+func (r *NamespaceQuotaReconciler) detectDrift(spec *v1alpha1.NamespaceQuotaSpec) (bool, error) {
+	if !r.cgroupManager.SliceExists(spec.Namespace) {
+		return true, nil
+	}
+
+	period := r.cgroupManager.CPUPeriod()
+
+	var desiredCPU, desiredMemory int64
+	if spec.CPU != "" {
+		quota, err := ParseCPU(spec.CPU, period)
+		if err != nil {
+			return false, err
+		}
+		// systemd applies CPUQuota as a whole percentage of the period
+		desiredCPU = (quota * 100 / period) * period / 100
+	}
+	if spec.Memory != "" {
+		bytes, err := ParseMemory(spec.Memory)
+		if err != nil {
+			return false, err
+		}
+		desiredMemory = bytes
+	}
+
+	currentCPU, currentMemory, currentHigh, currentWeight, err := r.cgroupManager.GetCurrentLimits(spec.Namespace)
+	if err != nil {
+		return false, err
+	}
+
+	// The kernel rounds memory.max down to a page and systemd may round the
+	// quota, so allow a small tolerance before declaring drift.
+	cpuDrift := absDiff(currentCPU, desiredCPU) > period/100
+	memoryDrift := absDiff(currentMemory, desiredMemory) >= int64(os.Getpagesize())
+	weightDrift := spec.CPUWeight != 0 && currentWeight != spec.CPUWeight
+
+	memoryHighDrift := false
+	if spec.MemoryHigh != "" {
+		desiredHigh, _ := parseOptionalMemory(spec.MemoryHigh)
+		memoryHighDrift = absDiff(currentHigh, desiredHigh) >= int64(os.Getpagesize())
+	}
+
+	oomGroupDrift := spec.OOMGroup != nil && r.cgroupManager.GetCurrentOOMGroup(spec.Namespace) != *spec.OOMGroup
+	cpuIdleDrift := spec.CPUIdle != nil && r.cgroupManager.GetCurrentCPUIdle(spec.Namespace) != *spec.CPUIdle
+
+	rawAttributesDrift := false
+	for attribute, value := range spec.RawAttributes {
+		current, err := r.cgroupManager.GetCgroupAttribute(spec.Namespace, attribute)
+		if err != nil || current != strings.TrimSpace(value) {
+			rawAttributesDrift = true
+			break
+		}
+	}
+
+	// The kernel rounds hugetlb limits down to whole pages
+	hugepagesDrift := false
+	for size, limit := range spec.HugepagesLimits {
+		sizeBytes, _ := ParseHugepageSize(size)
+		desired, _ := ParseMemory(limit)
+		current, err := r.cgroupManager.GetHugepagesLimit(spec.Namespace, size)
+		if err != nil || sizeBytes <= 0 || current != desired/sizeBytes*sizeBytes {
+			hugepagesDrift = true
+			break
+		}
+	}
+
+	// Protection is only compared when requested, like cpuWeight
+	memoryProtectionDrift := false
+	if spec.MemoryMin != "" || spec.MemoryLow != "" {
+		desiredMin, _ := parseOptionalMemory(spec.MemoryMin)
+		desiredLow, _ := parseOptionalMemory(spec.MemoryLow)
+		currentMin, currentLow := r.cgroupManager.GetCurrentMemoryProtection(spec.Namespace)
+		memoryProtectionDrift = (spec.MemoryMin != "" && absDiff(currentMin, desiredMin) >= int64(os.Getpagesize())) ||
+			(spec.MemoryLow != "" && absDiff(currentLow, desiredLow) >= int64(os.Getpagesize()))
+	}
+
+	var currentCPUSet string
+	cpuSetDrift := false
+	if spec.CPUSet != "" {
+		currentCPUSet, _ = r.cgroupManager.GetCurrentCPUSet(spec.Namespace)
+		cpuSetDrift = currentCPUSet == "" || !slices.Equal(expandCPUSet(currentCPUSet), expandCPUSet(spec.CPUSet))
+	}
+
+	if !cpuDrift && !memoryDrift && !weightDrift && !cpuSetDrift && !memoryProtectionDrift && !memoryHighDrift && !oomGroupDrift && !cpuIdleDrift && !hugepagesDrift && !rawAttributesDrift {
+		return false, nil
+	}
+
+	r.log.WithFields(logrus.Fields{
+		"namespace":            spec.Namespace,
+		"current_cpu":          currentCPU,
+		"desired_cpu":          desiredCPU,
+		"current_memory":       currentMemory,
+		"desired_memory":       desiredMemory,
+		"current_weight":       currentWeight,
+		"desired_weight":       spec.CPUWeight,
+		"current_cpuset":       currentCPUSet,
+		"desired_cpuset":       spec.CPUSet,
+		"memory_min":           spec.MemoryMin,
+		"memory_low":           spec.MemoryLow,
+		"current_high":         currentHigh,
+		"memory_high":          spec.MemoryHigh,
+		"oom_group_drift":      oomGroupDrift,
+		"cpu_idle_drift":       cpuIdleDrift,
+		"hugepages_drift":      hugepagesDrift,
+		"raw_attributes_drift": rawAttributesDrift,
+	}).Info("Cgroup limits drifted from spec")
+
+	if r.metricsServer != nil {
+		r.metricsServer.IncDriftDetected(spec.Namespace)
+	}
+	return true, nil
+}
+
+// checkAllocatable warns when the CPU or memory limit of spec exceeds the
+// allocatable resources of the agent's node. The limits are still applied:
+// they are only ineffective, not invalid.
+func (r *NamespaceQuotaReconciler) checkAllocatable(ctx context.Context, quota *v1alpha1.NamespaceQuota, spec *v1alpha1.NamespaceQuotaSpec) {
+	if r.nodeName == "" || withoutLimits(spec) {
+		return
+	}
+
+	allocatableCPU, allocatableMemory, err := r.k8sClient.GetNodeAllocatable(ctx, r.nodeName)
+	if err != nil {
+		r.log.WithError(err).Debug("Failed to read node allocatable resources")
+		return
+	}
+
+	var excesses []string
+	if spec.CPU != "" {
+		if cpu, err := resource.ParseQuantity(strings.TrimSpace(spec.CPU)); err == nil && cpu.MilliValue() > allocatableCPU {
+			excesses = append(excesses, fmt.Sprintf("CPU limit %s exceeds the allocatable %s by %s",
+				cpu.String(), resource.NewMilliQuantity(allocatableCPU, resource.DecimalSI),
+				resource.NewMilliQuantity(cpu.MilliValue()-allocatableCPU, resource.DecimalSI)))
+		}
+	}
+	if spec.Memory != "" {
+		if memory, err := ParseMemory(spec.Memory); err == nil && memory > allocatableMemory {
+			excesses = append(excesses, fmt.Sprintf("memory limit %s exceeds the allocatable %s by %s",
+				FormatMemoryForDisplay(memory), FormatMemoryForDisplay(allocatableMemory),
+				FormatMemoryForDisplay(memory-allocatableMemory)))
+		}
+	}
+	if len(excesses) == 0 {
+		return
+	}
+
+	excess := strings.Join(excesses, " and ")
+	r.log.WithFields(logrus.Fields{
+		"name":      quota.Name,
+		"namespace": spec.Namespace,
+		"node":      r.nodeName,
+		"excess":    excess,
+	}).Warn("Quota limits exceed the node allocatable resources")
+	exceedsAllocatable.Inc()
+	r.emitEvent(quota, corev1.EventTypeWarning, reasonExceedsAllocatable,
+		fmt.Sprintf("On node %s, %s", r.nodeName, excess))
+}
+
+// nodeSelected reports whether the labels of the agent's node match selector
+func (r *NamespaceQuotaReconciler) nodeSelected(ctx context.Context, selector map[string]string) (bool, error) {
+	if len(selector) == 0 {
+		return true, nil
+	}
+	if r.nodeName == "" {
+		return false, fmt.Errorf("node name is not set, cannot evaluate nodeSelector")
+	}
+
+	node, err := r.k8sClient.GetClientset().CoreV1().Nodes().Get(ctx, r.nodeName, metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to get node %s: %w", r.nodeName, err)
+	}
+	return labels.SelectorFromSet(selector).Matches(labels.Set(node.Labels)), nil
+}
+
+// applyConfigMapRefs returns a copy of spec with the CPU and memory limits
+// read from the ConfigMaps it references, or nil if it references none
+func (r *NamespaceQuotaReconciler) applyConfigMapRefs(ctx context.Context, spec *v1alpha1.NamespaceQuotaSpec) (*v1alpha1.NamespaceQuotaSpec, error) {
+	if spec.CPUFromConfigMapKeyRef == nil && spec.MemoryFromConfigMapKeyRef == nil {
+		return nil, nil
+	}
+
+	// Copied, as spec belongs to the informer cache
+	resolved := *spec
+	var err error
+	if spec.CPUFromConfigMapKeyRef != nil {
+		if resolved.CPU, err = r.configMapValue(ctx, spec.Namespace, spec.CPUFromConfigMapKeyRef); err != nil {
+			return nil, err
+		}
+		resolved.CPUFromConfigMapKeyRef = nil
+	}
+	if spec.MemoryFromConfigMapKeyRef != nil {
+		if resolved.Memory, err = r.configMapValue(ctx, spec.Namespace, spec.MemoryFromConfigMapKeyRef); err != nil {
+			return nil, err
+		}
+		resolved.MemoryFromConfigMapKeyRef = nil
+	}
+
+	if err := ValidateNamespaceQuotaSpec(&resolved); err != nil {
+		return nil, fmt.Errorf("invalid limit in ConfigMap: %w", err)
+	}
+	return &resolved, nil
+}
+
+// configMapValue reads the value ref selects in namespace. A missing ConfigMap
+// or key of an optional ref yields an empty value, leaving the limit unset.
+func (r *NamespaceQuotaReconciler) configMapValue(ctx context.Context, namespace string, ref *corev1.ConfigMapKeySelector) (string, error) {
+	value, err := r.k8sClient.GetConfigMapValue(ctx, namespace, ref.Name, ref.Key)
+	if err != nil {
+		if ref.Optional != nil && *ref.Optional && (apierrors.IsNotFound(err) || errors.Is(err, ErrConfigMapKeyNotFound)) {
+			return "", nil
+		}
+		return "", err
+	}
+	// Values loaded from files usually end with a newline
+	return strings.TrimSpace(value), nil
+}
+
+// applyResourceQuotaFallback returns a copy of spec with the empty CPU and
+// memory limits taken from the namespace's ResourceQuota, or nil when the
+// fallback is disabled or provides nothing.
+func (r *NamespaceQuotaReconciler) applyResourceQuotaFallback(ctx context.Context, spec *v1alpha1.NamespaceQuotaSpec) (*v1alpha1.NamespaceQuotaSpec, error) {
+	if !r.resourceQuotaFallback || (spec.CPU != "" && spec.Memory != "") {
+		return nil, nil
+	}
+
+	cpu, memory, err := r.k8sClient.GetResourceQuotaLimits(ctx, spec.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	// Copied, as spec belongs to the informer cache
+	fallback := *spec
+	if fallback.CPU == "" {
+		fallback.CPU = cpu
+	}
+	if fallback.Memory == "" {
+		fallback.Memory = memory
+	}
+	if fallback.CPU == spec.CPU && fallback.Memory == spec.Memory {
+		return nil, nil
+	}
+	return &fallback, nil
+}
+
+// applyPriorityClass returns a copy of spec with the CPUWeight derived from
+// the value of its PriorityClass
+func (r *NamespaceQuotaReconciler) applyPriorityClass(ctx context.Context, spec *v1alpha1.NamespaceQuotaSpec) (*v1alpha1.NamespaceQuotaSpec, error) {
+	value, err := r.k8sClient.GetPriorityClassValue(ctx, spec.PriorityClass)
+	if err != nil {
+		return nil, err
+	}
+	if r.metricsServer != nil {
+		r.metricsServer.SetPriorityClassValue(spec.Namespace, value)
+	}
+
+	// Copied, as spec belongs to the informer cache
+	weighted := *spec
+	weighted.CPUWeight = priorityClassWeight(value, r.priorityClassWeightDivisor)
+	return &weighted, nil
+}
+
+// priorityClassWeight maps a PriorityClass value to a CPUWeight:
+//
+//	weight = 100 + value / divisor, clamped to [MinCPUWeight, MaxCPUWeight]
+//
+// A value of 0, the priority of pods without a class, gets systemd's default
+// weight of 100. A zero divisor uses DefaultPriorityClassWeightDivisor.
+func priorityClassWeight(value, divisor int32) int64 {
+	if divisor <= 0 {
+		divisor = DefaultPriorityClassWeightDivisor
+	}
+	weight := defaultCPUWeight + int64(value)/int64(divisor)
+	return min(max(weight, MinCPUWeight), MaxCPUWeight)
+}
+
+// configuredMessage describes the applied limits for status and events,
+// e.g. "Cgroup configured with CPU=4.00 cores, Memory=8.00 GiB"
+func (r *NamespaceQuotaReconciler) configuredMessage(spec *v1alpha1.NamespaceQuotaSpec, fromResourceQuota bool) string {
+	if withoutLimits(spec) {
+		return "Slice created (no limits)"
+	}
+	message := fmt.Sprintf("Cgroup configured with CPU=%s, Memory=%s",
+		r.cgroupManager.displayCPU(spec.CPU), displayMemory(spec.Memory))
+	if fromResourceQuota {
+		message += " (limits missing from the NamespaceQuota taken from its ResourceQuota)"
+	}
+	return message
+}
+
+// displayMemory formats a memory quantity with FormatMemoryForDisplay,
+// falling back to the raw value if it does not parse
+func displayMemory(memory string) string {
+	bytes, err := parseOptionalMemory(memory)
+	if err != nil {
+		return memory
+	}
+	return FormatMemoryForDisplay(bytes)
+}
+
+// withoutLimits reports whether spec only groups the namespace's containers
+// in a slice: other settings such as cpuWeight still apply, but neither a CPU
+// quota nor a memory limit is set
+func withoutLimits(spec *v1alpha1.NamespaceQuotaSpec) bool {
+	return spec.CPU == "" && spec.Memory == ""
+}
+
+// sliceLimits converts a spec into the limits applied by EnsureSlice
+func sliceLimits(spec *v1alpha1.NamespaceQuotaSpec) SliceLimits {
+	return SliceLimits{
+		CPU:        spec.CPU,
+		CPUWeight:  spec.CPUWeight,
+		CPUSet:     spec.CPUSet,
+		Memory:     spec.Memory,
+		MemoryMin:  spec.MemoryMin,
+		MemoryLow:  spec.MemoryLow,
+		MemoryHigh: spec.MemoryHigh,
+		OOMGroup:   spec.OOMGroup,
+		CPUIdle:    spec.CPUIdle,
+
+		HugepagesLimits: spec.HugepagesLimits,
+		RawAttributes:   spec.RawAttributes,
+	}
+}
+
+func absDiff(a, b int64) int64 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func (r *NamespaceQuotaReconciler) updateMetrics(ctx context.Context, spec *v1alpha1.NamespaceQuotaSpec) {
+	if r.metricsServer == nil {
+		return
+	}
+
+	r.metricsServer.SetSliceWithoutLimits(spec.Namespace, withoutLimits(spec))
+
+	stats, err := r.metricsServer.ReadCgroupStats(ctx, spec.Namespace)
+	if err != nil {
+		r.log.WithError(err).Debug("Failed to read cgroup stats for metrics")
+		return
+	}
+
+	var cpuLimitUsec, memoryLimitBytes int64
+	if spec.CPU != "" {
+		cpuLimitUsec, _ = ParseCPU(spec.CPU, r.cgroupManager.CPUPeriod())
+	}
+	if spec.Memory != "" {
+		memoryLimitBytes, _ = ParseMemory(spec.Memory)
+	}
+
+	r.metricsServer.UpdateMetrics(spec.Namespace, stats, cpuLimitUsec, memoryLimitBytes)
+
+	if level, err := r.cgroupManager.GetMemoryPressureLevel(spec.Namespace); err != nil {
+		r.log.WithError(err).Debug("Failed to read memory pressure level for metrics")
+	} else {
+		r.metricsServer.SetMemoryPressureLevel(spec.Namespace, level)
+	}
+
+	currentCPU, currentMemory, _, _, err := r.cgroupManager.GetCurrentLimits(spec.Namespace)
+	if err != nil {
+		r.log.WithError(err).Debug("Failed to read current limits for status")
+		return
+	}
+	r.metricsServer.RecordNamespaceStatus(spec.Namespace, stats, currentCPU, currentMemory, !r.cgroupManager.DryRun)
+}
+
+func (r *NamespaceQuotaReconciler) setNamespaceReady(namespace string, ready bool) {
+	if r.metricsServer != nil && namespace != "" {
+		r.metricsServer.SetNamespaceReady(namespace, ready)
+	}
+}
+
+func (r *NamespaceQuotaReconciler) forgetNamespace(namespace string) {
+	if r.metricsServer != nil {
+		r.metricsServer.ForgetNamespace(namespace)
+	}
+}
+
+// handleFinalize removes the cgroup slice of a quota being deleted and then
+// releases the cleanup finalizer. If the agent stops in between, the finalizer
+// is still present on restart and the removal is retried. Once the agent of
+// another node released the finalizer, only the local slice is removed.
+func (r *NamespaceQuotaReconciler) handleFinalize(ctx context.Context, quota *v1alpha1.NamespaceQuota) error {
+	released := !slices.Contains(quota.Finalizers, cgroupCleanupFinalizer)
+	if released && !r.cgroupManager.SliceExists(quota.Spec.Namespace) {
+		return nil
+	}
+
+	log := r.log.WithFields(logrus.Fields{
+		"name":      quota.Name,
+		"namespace": quota.Spec.Namespace,
+	})
+	log.Info("NamespaceQuota terminating, removing cgroup")
+
+	if err := r.cgroupManager.RemoveSlice(quota.Spec.Namespace); err != nil {
+		log.WithError(err).Error("Failed to remove cgroup slice")
+		return err
+	}
+
+	r.forgetNamespace(quota.Spec.Namespace)
+	if released {
+		return nil
+	}
+
+	if err := r.k8sClient.RemoveFinalizer(ctx, quota, cgroupCleanupFinalizer); err != nil {
+		log.WithError(err).Error("Failed to remove cleanup finalizer")
+		return err
+	}
+
+	r.emitEvent(quota, corev1.EventTypeNormal, reasonCgroupRemoved,
+		fmt.Sprintf("Cgroup removed for namespace %s", quota.Spec.Namespace))
+	r.resetEventState(quota.Spec.Namespace)
+
+	return nil
+}
+
+func (r *NamespaceQuotaReconciler) handleDelete(name string) error {
+	namespace := r.takeNamespace(name)
+	log := r.log.WithFields(logrus.Fields{
+		"name":      name,
+		"namespace": namespace,
+	})
+	log.Info("Attempting to remove cgroup for deleted quota")
+	r.forgetGeneration(name)
+
+	if err := r.cgroupManager.RemoveSlice(namespace); err != nil {
+		log.WithError(err).Warn("Failed to remove cgroup slice on delete")
+	} else {
+		r.k8sClient.EmitEvent(namespace, corev1.EventTypeNormal, reasonCgroupRemoved,
+			fmt.Sprintf("Cgroup removed for deleted NamespaceQuota %s", name))
+	}
+	r.resetEventState(namespace)
+
+	return nil
+}
+
+func (r *NamespaceQuotaReconciler) updateStatus(ctx context.Context, quota *v1alpha1.NamespaceQuota, ready bool, message string, conditions ...metav1.Condition) {
+	log := r.log.WithFields(logrus.Fields{
+		"name":    quota.Name,
+		"ready":   ready,
+		"message": message,
+	})
+
+	if err := r.k8sClient.UpdateStatus(ctx, quota, ready, message, conditions...); err != nil {
+		log.WithError(err).Warn("Failed to update status")
+	} else {
+		log.Debug("Status updated")
+	}
+}
+
+func newCondition(conditionType string, ok bool, reason, message string) metav1.Condition {
+	status := metav1.ConditionFalse
+	if ok {
+		status = metav1.ConditionTrue
+	}
+	return metav1.Condition{
+		Type:    conditionType,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	}
+}
+
+func readyConditions() []metav1.Condition {
+	return []metav1.Condition{
+		newCondition(v1alpha1.ConditionSpecValid, true, v1alpha1.ReasonSpecValid, "Spec is valid"),
+		newCondition(v1alpha1.ConditionSystemdReachable, true, v1alpha1.ReasonCgroupConfigured, "Limits applied through systemd"),
+		newCondition(v1alpha1.ConditionCgroupReady, true, v1alpha1.ReasonCgroupConfigured, "Cgroup configured successfully"),
+	}
+}
+
+// failureConditions maps an EnsureSlice error to conditions, distinguishing
+// systemd failures from other cgroup errors.
+func failureConditions(err error) []metav1.Condition {
+	conditions := []metav1.Condition{
+		newCondition(v1alpha1.ConditionSpecValid, true, v1alpha1.ReasonSpecValid, "Spec is valid"),
+	}
+
+	var systemdErr *SystemdError
+	if errors.As(err, &systemdErr) {
+		return append(conditions,
+			newCondition(v1alpha1.ConditionSystemdReachable, false, v1alpha1.ReasonSystemdError, err.Error()),
+			newCondition(v1alpha1.ConditionCgroupReady, false, v1alpha1.ReasonSystemdError, err.Error()))
+	}
+
+	return append(conditions,
+		newCondition(v1alpha1.ConditionCgroupReady, false, v1alpha1.ReasonCgroupError, err.Error()))
+}
@@ -0,0 +1,475 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/agent/testutil"
+	"github.com/fulcro-cloud/namespace-isolation/pkg/api/v1alpha1"
+	"github.com/fulcro-cloud/namespace-isolation/pkg/client/clientset/versioned"
+	brasav1alpha1 "github.com/fulcro-cloud/namespace-isolation/pkg/client/clientset/versioned/typed/brasa/v1alpha1"
+	listers "github.com/fulcro-cloud/namespace-isolation/pkg/client/listers/brasa/v1alpha1"
+)
+
+// fakeQuotaClient serves the NamespaceQuota patches of K8sClient from the
+// store the reconciler's lister reads, like the API server and informer
+// would. Methods the reconciler does not call panic through the nil
+// embedded interfaces.
+type fakeQuotaClient struct {
+	versioned.Interface
+	brasav1alpha1.BrasaV1alpha1Interface
+	brasav1alpha1.NamespaceQuotaInterface
+
+	store cache.Store
+
+	mu sync.Mutex
+	// statuses are the status patches received, by quota name
+	statuses map[string][]v1alpha1.NamespaceQuotaStatus
+	// finalizerErr, if set, fails every finalizer patch
+	finalizerErr error
+}
+
+func (c *fakeQuotaClient) BrasaV1alpha1() brasav1alpha1.BrasaV1alpha1Interface {
+	return c
+}
+
+func (c *fakeQuotaClient) NamespaceQuotas() brasav1alpha1.NamespaceQuotaInterface {
+	return c
+}
+
+func (c *fakeQuotaClient) Patch(_ context.Context, name string, pt types.PatchType, data []byte, _ metav1.PatchOptions, subresources ...string) (*v1alpha1.NamespaceQuota, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	obj, exists, err := c.store.GetByKey(name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, apierrors.NewNotFound(v1alpha1.Resource("namespacequotas"), name)
+	}
+	quota := obj.(*v1alpha1.NamespaceQuota).DeepCopy()
+
+	if slices.Equal(subresources, []string{"status"}) {
+		var patch struct {
+			Status v1alpha1.NamespaceQuotaStatus `json:"status"`
+		}
+		if err := json.Unmarshal(data, &patch); err != nil {
+			return nil, err
+		}
+		c.statuses[name] = append(c.statuses[name], patch.Status)
+		quota.Status = patch.Status
+		return quota, c.store.Update(quota)
+	}
+
+	if c.finalizerErr != nil {
+		return nil, c.finalizerErr
+	}
+	var patch struct {
+		Metadata struct {
+			Finalizers []string `json:"finalizers"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return nil, err
+	}
+	quota.Finalizers = patch.Metadata.Finalizers
+	if quota.DeletionTimestamp != nil && len(quota.Finalizers) == 0 {
+		return quota, c.store.Delete(quota)
+	}
+	return quota, c.store.Update(quota)
+}
+
+// lastStatus returns the last status patched on the quota name
+func (c *fakeQuotaClient) lastStatus(t *testing.T, name string) v1alpha1.NamespaceQuotaStatus {
+	t.Helper()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	statuses := c.statuses[name]
+	if len(statuses) == 0 {
+		t.Fatalf("no status patched on %s", name)
+	}
+	return statuses[len(statuses)-1]
+}
+
+// reconcilerTest is a NamespaceQuotaReconciler on a fake store, API server,
+// cgroup tree and executor
+type reconcilerTest struct {
+	reconciler  *NamespaceQuotaReconciler
+	store       cache.Indexer
+	quotaClient *fakeQuotaClient
+	executor    *testutil.FakeExecutor
+	recorder    *record.FakeRecorder
+	fs          *testutil.FakeCgroupFS
+}
+
+// newReconcilerTest creates a reconciler whose cluster has the given
+// namespaces and quotas
+func newReconcilerTest(t *testing.T, namespaces []string, quotas ...*v1alpha1.NamespaceQuota) *reconcilerTest {
+	t.Helper()
+
+	store := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, quota := range quotas {
+		if err := store.Add(quota); err != nil {
+			t.Fatalf("failed to add %s to the store: %v", quota.Name, err)
+		}
+	}
+
+	var objects []runtime.Object
+	for _, namespace := range namespaces {
+		objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})
+	}
+
+	executor := &testutil.FakeExecutor{}
+	cgroupManager, fs := newTestCgroupManager(t, executor, DefaultCPUPeriod)
+	quotaClient := &fakeQuotaClient{store: store, statuses: map[string][]v1alpha1.NamespaceQuotaStatus{}}
+	recorder := record.NewFakeRecorder(100)
+
+	test := &reconcilerTest{
+		store:       store,
+		quotaClient: quotaClient,
+		executor:    executor,
+		recorder:    recorder,
+		fs:          fs,
+	}
+	test.reconciler = test.newReconciler(cgroupManager, kubefake.NewClientset(objects...))
+	return test
+}
+
+// newReconciler returns a reconciler sharing the store and API server of the
+// test, e.g. to stand for a restarted agent
+func (rt *reconcilerTest) newReconciler(cgroupManager *CgroupManager, clientset *kubefake.Clientset) *NamespaceQuotaReconciler {
+	return &NamespaceQuotaReconciler{
+		k8sClient: &K8sClient{
+			clientset:   clientset,
+			quotaClient: rt.quotaClient,
+			recorder:    rt.recorder,
+		},
+		cgroupManager:   cgroupManager,
+		lister:          listers.NewNamespaceQuotaLister(rt.store),
+		log:             cgroupManager.log,
+		pendingRenames:  map[string]string{},
+		processed:       map[string]processedQuota{},
+		quotaNamespaces: map[string]string{},
+		lastEventState:  map[string]string{},
+	}
+}
+
+func (rt *reconcilerTest) reconcile(t *testing.T, key string) error {
+	t.Helper()
+	_, err := rt.reconciler.Reconcile(context.Background(), ReconcileRequest{Key: key})
+	return err
+}
+
+// quota returns the quota name from the store, or nil once it is gone
+func (rt *reconcilerTest) quota(t *testing.T, name string) *v1alpha1.NamespaceQuota {
+	t.Helper()
+
+	obj, exists, err := rt.store.GetByKey(name)
+	if err != nil {
+		t.Fatalf("failed to get %s from the store: %v", name, err)
+	}
+	if !exists {
+		return nil
+	}
+	return obj.(*v1alpha1.NamespaceQuota)
+}
+
+// events drains the events recorded so far, as "Type Reason Message"
+func (rt *reconcilerTest) events() []string {
+	var events []string
+	for {
+		select {
+		case event := <-rt.recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func newTestQuota(name, namespace, cpu, memory string) *v1alpha1.NamespaceQuota {
+	return &v1alpha1.NamespaceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Generation: 1, ResourceVersion: "1"},
+		Spec: v1alpha1.NamespaceQuotaSpec{
+			Namespace: namespace,
+			CPU:       cpu,
+			Memory:    memory,
+		},
+	}
+}
+
+func setPropertyCall(namespace string, properties ...string) string {
+	args := append([]string{"nsenter", "-t", "1", "-m", "-u", "-n", "--", "systemctl", "set-property", fmt.Sprintf("brasa-%s.slice", namespace)}, properties...)
+	return strings.Join(append(args, "--runtime"), " ")
+}
+
+func callStrings(calls []testutil.Call) []string {
+	var commands []string
+	for _, call := range calls {
+		commands = append(commands, call.String())
+	}
+	return commands
+}
+
+func TestReconcileAppliesQuota(t *testing.T) {
+	rt := newReconcilerTest(t, []string{"team-a"}, newTestQuota("team-a", "team-a", "500m", "1Gi"))
+	addTestSlice(rt.fs, "team-a")
+
+	if err := rt.reconcile(t, "team-a"); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	want := []string{setPropertyCall("team-a", "CPUQuota=50%", "MemoryMax=1G")}
+	if got := callStrings(rt.executor.Calls()); !slices.Equal(got, want) {
+		t.Errorf("Reconcile() ran %q, want %q", got, want)
+	}
+	if quota := rt.quota(t, "team-a"); !slices.Contains(quota.Finalizers, cgroupCleanupFinalizer) {
+		t.Errorf("finalizers = %v, want %s", quota.Finalizers, cgroupCleanupFinalizer)
+	}
+	if status := rt.quotaClient.lastStatus(t, "team-a"); !status.Ready {
+		t.Errorf("status = %+v, want ready", status)
+	}
+	if events := rt.events(); len(events) != 1 || !strings.HasPrefix(events[0], "Normal "+reasonCgroupConfigured) {
+		t.Errorf("events = %q, want one %s", events, reasonCgroupConfigured)
+	}
+}
+
+func TestReconcileSkipsUnchangedGeneration(t *testing.T) {
+	rt := newReconcilerTest(t, []string{"team-a"}, newTestQuota("team-a", "team-a", "500m", ""))
+	addTestSlice(rt.fs, "team-a")
+
+	for range 3 {
+		if err := rt.reconcile(t, "team-a"); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+	}
+	if calls := rt.executor.Calls(); len(calls) != 1 {
+		t.Errorf("three reconciles of the same generation ran %v, want one command", calls)
+	}
+
+	quota := rt.quota(t, "team-a").DeepCopy()
+	quota.Spec.CPU = "1"
+	quota.Generation++
+	if err := rt.store.Update(quota); err != nil {
+		t.Fatalf("failed to update quota: %v", err)
+	}
+	if err := rt.reconcile(t, "team-a"); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	calls := callStrings(rt.executor.Calls())
+	if want := setPropertyCall("team-a", "CPUQuota=100%"); len(calls) != 2 || calls[1] != want {
+		t.Errorf("Reconcile() of a new generation ran %q, want %q last", calls, want)
+	}
+}
+
+func TestReconcileInvalidSpec(t *testing.T) {
+	rt := newReconcilerTest(t, []string{"team-a"}, newTestQuota("team-a", "team-a", "-1", ""))
+
+	if err := rt.reconcile(t, "team-a"); err == nil {
+		t.Fatal("Reconcile() of an invalid spec succeeded, want an error")
+	}
+	if calls := rt.executor.Calls(); len(calls) != 0 {
+		t.Errorf("Reconcile() ran %v, want no command", calls)
+	}
+	if status := rt.quotaClient.lastStatus(t, "team-a"); status.Ready || !strings.HasPrefix(status.Message, "Parse error") {
+		t.Errorf("status = %+v, want a parse error", status)
+	}
+}
+
+func TestReconcileMissingNamespace(t *testing.T) {
+	rt := newReconcilerTest(t, nil, newTestQuota("team-a", "team-a", "500m", ""))
+	addRemovableTestSlice(t, rt.fs, "team-a")
+
+	if err := rt.reconcile(t, "team-a"); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if calls := rt.executor.Calls(); len(calls) != 0 {
+		t.Errorf("Reconcile() ran %v, want no command", calls)
+	}
+	if rt.reconciler.cgroupManager.SliceExists("team-a") {
+		t.Error("slice of a missing namespace was kept")
+	}
+}
+
+func TestReconcileDisabledQuota(t *testing.T) {
+	quota := newTestQuota("team-a", "team-a", "500m", "")
+	disabled := false
+	quota.Spec.Enabled = &disabled
+	rt := newReconcilerTest(t, []string{"team-a"}, quota)
+	addRemovableTestSlice(t, rt.fs, "team-a")
+
+	if err := rt.reconcile(t, "team-a"); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if rt.reconciler.cgroupManager.SliceExists("team-a") {
+		t.Error("slice of a disabled quota was kept")
+	}
+	if calls := rt.executor.Calls(); len(calls) != 0 {
+		t.Errorf("Reconcile() ran %v, want no command", calls)
+	}
+}
+
+func TestReconcileDeletedQuota(t *testing.T) {
+	rt := newReconcilerTest(t, []string{"team-a"})
+	addRemovableTestSlice(t, rt.fs, "team-a")
+
+	if err := rt.reconcile(t, "team-a"); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if rt.reconciler.cgroupManager.SliceExists("team-a") {
+		t.Error("slice of a deleted quota was kept")
+	}
+}
+
+// terminate marks the quota name as being deleted, as the API server does
+// for an object with finalizers
+func (rt *reconcilerTest) terminate(t *testing.T, name string) {
+	t.Helper()
+
+	quota := rt.quota(t, name).DeepCopy()
+	now := metav1.Now()
+	quota.DeletionTimestamp = &now
+	if err := rt.store.Update(quota); err != nil {
+		t.Fatalf("failed to mark %s as deleted: %v", name, err)
+	}
+}
+
+// emptyTestSlice removes the interface files of a slice, which the kernel
+// removes along with the cgroup, so RemoveSlice can remove its directory
+func emptyTestSlice(t *testing.T, fs *testutil.FakeCgroupFS, namespace string) {
+	t.Helper()
+
+	entries, err := os.ReadDir(fs.SlicePath(namespace))
+	if err != nil {
+		t.Fatalf("failed to read slice of %s: %v", namespace, err)
+	}
+	for _, entry := range entries {
+		if err := os.Remove(filepath.Join(fs.SlicePath(namespace), entry.Name())); err != nil {
+			t.Fatalf("failed to empty slice of %s: %v", namespace, err)
+		}
+	}
+}
+
+func TestReconcileFinalizerSurvivesCrash(t *testing.T) {
+	quota := newTestQuota("quota-a", "team-a", "500m", "")
+	quota.Finalizers = []string{cgroupCleanupFinalizer}
+	rt := newReconcilerTest(t, []string{"team-a"}, quota)
+	addRemovableTestSlice(t, rt.fs, "team-a")
+	rt.terminate(t, "quota-a")
+
+	// The agent stops after removing the slice but before the finalizer
+	// patch goes through
+	rt.quotaClient.finalizerErr = errors.New("connection refused")
+	if err := rt.reconcile(t, "quota-a"); err == nil {
+		t.Fatal("Reconcile() with a failing finalizer patch succeeded, want an error")
+	}
+	if rt.reconciler.cgroupManager.SliceExists("team-a") {
+		t.Error("slice was kept")
+	}
+	if rt.quota(t, "quota-a") == nil {
+		t.Fatal("quota was deleted before its finalizer was released")
+	}
+
+	// On restart, the finalizer is still there and the cleanup completes
+	rt.quotaClient.finalizerErr = nil
+	rt.reconciler = rt.newReconciler(rt.reconciler.cgroupManager, kubefake.NewClientset())
+	if err := rt.reconcile(t, "quota-a"); err != nil {
+		t.Fatalf("Reconcile() after restart error = %v", err)
+	}
+	if rt.quota(t, "quota-a") != nil {
+		t.Error("quota is still present after its finalizer was released")
+	}
+	if err := rt.reconcile(t, "quota-a"); err != nil {
+		t.Fatalf("Reconcile() of the deleted quota error = %v", err)
+	}
+}
+
+func TestReconcileDeletionOnEveryNode(t *testing.T) {
+	rt := newReconcilerTest(t, []string{"team-a"}, newTestQuota("quota-a", "team-a", "500m", ""))
+	nodeA := rt.reconciler
+	cgroupManagerB, fsB := newTestCgroupManager(t, &testutil.FakeExecutor{}, DefaultCPUPeriod)
+	nodeB := rt.newReconciler(cgroupManagerB, kubefake.NewClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}))
+	addTestSlice(rt.fs, "team-a")
+	addTestSlice(fsB, "team-a")
+
+	for _, reconciler := range []*NamespaceQuotaReconciler{nodeA, nodeB} {
+		if _, err := reconciler.Reconcile(context.Background(), ReconcileRequest{Key: "quota-a"}); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+	}
+	emptyTestSlice(t, rt.fs, "team-a")
+	rt.terminate(t, "quota-a")
+
+	// The first agent releases the shared finalizer and the quota is gone
+	// before the second one sees it terminating
+	if _, err := nodeA.Reconcile(context.Background(), ReconcileRequest{Key: "quota-a"}); err != nil {
+		t.Fatalf("Reconcile() on node A error = %v", err)
+	}
+	if rt.quota(t, "quota-a") != nil {
+		t.Fatal("quota is still present after its finalizer was released")
+	}
+	if nodeA.cgroupManager.SliceExists("team-a") {
+		t.Error("slice on node A was kept")
+	}
+
+	emptyTestSlice(t, fsB, "team-a")
+	if _, err := nodeB.Reconcile(context.Background(), ReconcileRequest{Key: "quota-a"}); err != nil {
+		t.Fatalf("Reconcile() on node B error = %v", err)
+	}
+	if nodeB.cgroupManager.SliceExists("team-a") {
+		t.Error("slice on node B leaked")
+	}
+}
+
+func TestReconcileEventsAfterRecreate(t *testing.T) {
+	rt := newReconcilerTest(t, []string{"team-a"}, newTestQuota("quota-a", "team-a", "500m", ""))
+	addTestSlice(rt.fs, "team-a")
+
+	if err := rt.reconcile(t, "quota-a"); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if events := rt.events(); len(events) != 1 {
+		t.Fatalf("events = %q, want one", events)
+	}
+
+	// Deleted without the finalizer, e.g. after it was removed by hand
+	if err := rt.store.Delete(rt.quota(t, "quota-a")); err != nil {
+		t.Fatalf("failed to delete quota: %v", err)
+	}
+	emptyTestSlice(t, rt.fs, "team-a")
+	if err := rt.reconcile(t, "quota-a"); err != nil {
+		t.Fatalf("Reconcile() of the deleted quota error = %v", err)
+	}
+	rt.events()
+
+	if err := rt.store.Add(newTestQuota("quota-a", "team-a", "500m", "")); err != nil {
+		t.Fatalf("failed to recreate quota: %v", err)
+	}
+	addTestSlice(rt.fs, "team-a")
+	if err := rt.reconcile(t, "quota-a"); err != nil {
+		t.Fatalf("Reconcile() of the recreated quota error = %v", err)
+	}
+	if events := rt.events(); len(events) != 1 || !strings.HasPrefix(events[0], "Normal "+reasonCgroupConfigured) {
+		t.Errorf("events of the recreated quota = %q, want one %s", events, reasonCgroupConfigured)
+	}
+}
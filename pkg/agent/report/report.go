@@ -0,0 +1,224 @@
+// Package report summarizes the managed namespaces of a node: their
+// configured limits, the limits applied to the cgroup slices, and usage.
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+
+	listers "github.com/fulcro-cloud/namespace-isolation/pkg/client/listers/brasa/v1alpha1"
+)
+
+// Stats is the usage of a namespace slice
+type Stats struct {
+	CPUUsageUsec     int64
+	CPUThrottled     int64
+	MemoryUsageBytes int64
+	OOMKills         int64
+}
+
+// Limits are the limits applied to a namespace slice; unlimited values are 0
+type Limits struct {
+	CPUQuotaUs      int64
+	MemoryBytes     int64
+	MemoryHighBytes int64
+	CPUWeight       int64
+}
+
+// CgroupReader reads the state of namespace slices. It is implemented on top
+// of the agent's CgroupManager.
+type CgroupReader interface {
+	GetCgroupStats(namespace string) (Stats, error)
+	GetCurrentLimits(namespace string) (Limits, error)
+}
+
+// NamespaceReport is the state of one managed namespace
+type NamespaceReport struct {
+	Namespace string `json:"namespace"`
+	Quota     string `json:"quota"`
+	Enabled   bool   `json:"enabled"`
+
+	// CPU and Memory are the limits configured in the NamespaceQuota
+	CPU    string `json:"cpu,omitempty"`
+	Memory string `json:"memory,omitempty"`
+
+	// Applied limits read from the slice
+	CPUQuotaUs       int64 `json:"cpuQuotaUs"`
+	MemoryLimitBytes int64 `json:"memoryLimitBytes"`
+	MemoryHighBytes  int64 `json:"memoryHighBytes"`
+	CPUWeight        int64 `json:"cpuWeight"`
+
+	CPUUsageUsec     int64 `json:"cpuUsageUsec"`
+	MemoryUsageBytes int64 `json:"memoryUsageBytes"`
+	OOMKills         int64 `json:"oomKills"`
+	// ThrottledPeriods counts the CPU periods throttled since the previous
+	// report, or since the slice was created for the first report.
+	ThrottledPeriods int64 `json:"throttledPeriods"`
+
+	// Error is set when the slice could not be read, e.g. because the quota
+	// is disabled or not yet applied
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the state of every managed namespace at GeneratedAt
+type Report struct {
+	GeneratedAt time.Time `json:"generatedAt"`
+	// Since is when the previous report was generated, zero for the first one
+	Since      time.Time         `json:"since,omitzero"`
+	Namespaces []NamespaceReport `json:"namespaces"`
+}
+
+// JSON returns the report encoded as JSON
+func (r *Report) JSON() ([]byte, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode report: %w", err)
+	}
+	return data, nil
+}
+
+// WriteTable writes the report as a human-readable table
+func (r *Report) WriteTable(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tENABLED\tCPU\tMEMORY\tMEMORY USED\tTHROTTLED\tOOM KILLS\tERROR")
+	for _, ns := range r.Namespaces {
+		fmt.Fprintf(w, "%s\t%t\t%s\t%s\t%s\t%d\t%d\t%s\n",
+			ns.Namespace,
+			ns.Enabled,
+			valueOrNone(ns.CPU),
+			valueOrNone(ns.Memory),
+			formatBytes(ns.MemoryUsageBytes),
+			ns.ThrottledPeriods,
+			ns.OOMKills,
+			valueOrNone(ns.Error),
+		)
+	}
+	return w.Flush()
+}
+
+// Table returns the report as a human-readable table
+func (r *Report) Table() string {
+	var b strings.Builder
+	_ = r.WriteTable(&b)
+	return b.String()
+}
+
+// ThrottledPeriods returns the periods throttled across all namespaces
+func (r *Report) ThrottledPeriods() int64 {
+	var total int64
+	for _, ns := range r.Namespaces {
+		total += ns.ThrottledPeriods
+	}
+	return total
+}
+
+// ReportGenerator builds reports from the NamespaceQuota cache and the
+// cgroup slices. It remembers the throttling counters of the previous report
+// so that each report shows the events since then.
+type ReportGenerator struct {
+	lister  listers.NamespaceQuotaLister
+	cgroups CgroupReader
+
+	mu            sync.Mutex
+	lastGenerated time.Time
+	lastThrottled map[string]int64
+}
+
+func NewReportGenerator(lister listers.NamespaceQuotaLister, cgroups CgroupReader) *ReportGenerator {
+	return &ReportGenerator{
+		lister:        lister,
+		cgroups:       cgroups,
+		lastThrottled: map[string]int64{},
+	}
+}
+
+// Generate reports on every NamespaceQuota, sorted by namespace. A slice that
+// cannot be read is reported with an error instead of failing the report.
+func (g *ReportGenerator) Generate(ctx context.Context) (*Report, error) {
+	quotas, err := g.lister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list NamespaceQuotas: %w", err)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	report := &Report{
+		GeneratedAt: time.Now(),
+		Since:       g.lastGenerated,
+		Namespaces:  make([]NamespaceReport, 0, len(quotas)),
+	}
+	throttled := make(map[string]int64, len(quotas))
+
+	for _, quota := range quotas {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		ns := NamespaceReport{
+			Namespace: quota.Spec.Namespace,
+			Quota:     quota.Name,
+			Enabled:   quota.IsEnabled(),
+			CPU:       quota.Spec.CPU,
+			Memory:    quota.Spec.Memory,
+		}
+
+		stats, err := g.cgroups.GetCgroupStats(ns.Namespace)
+		if err != nil {
+			ns.Error = err.Error()
+			report.Namespaces = append(report.Namespaces, ns)
+			continue
+		}
+		ns.CPUUsageUsec = stats.CPUUsageUsec
+		ns.MemoryUsageBytes = stats.MemoryUsageBytes
+		ns.OOMKills = stats.OOMKills
+
+		// A counter lower than last time means the slice was recreated
+		ns.ThrottledPeriods = stats.CPUThrottled
+		if last, ok := g.lastThrottled[ns.Namespace]; ok && stats.CPUThrottled >= last {
+			ns.ThrottledPeriods = stats.CPUThrottled - last
+		}
+		throttled[ns.Namespace] = stats.CPUThrottled
+
+		limits, err := g.cgroups.GetCurrentLimits(ns.Namespace)
+		if err != nil {
+			ns.Error = err.Error()
+		} else {
+			ns.CPUQuotaUs = limits.CPUQuotaUs
+			ns.MemoryLimitBytes = limits.MemoryBytes
+			ns.MemoryHighBytes = limits.MemoryHighBytes
+			ns.CPUWeight = limits.CPUWeight
+		}
+
+		report.Namespaces = append(report.Namespaces, ns)
+	}
+
+	sort.Slice(report.Namespaces, func(i, j int) bool {
+		return report.Namespaces[i].Namespace < report.Namespaces[j].Namespace
+	})
+
+	g.lastGenerated = report.GeneratedAt
+	g.lastThrottled = throttled
+	return report, nil
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
+
+func formatBytes(bytes int64) string {
+	return resource.NewQuantity(bytes, resource.BinarySI).String()
+}
@@ -0,0 +1,96 @@
+package simulation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// podMetricsPath serves PodMetrics from the metrics.k8s.io API (metrics-server)
+const podMetricsPath = "/apis/metrics.k8s.io/v1beta1/namespaces"
+
+// podMetricsList is the subset of metrics.k8s.io/v1beta1 PodMetricsList read
+// here, decoded locally to avoid depending on k8s.io/metrics.
+type podMetricsList struct {
+	Items []struct {
+		Metadata   metav1.ObjectMeta `json:"metadata"`
+		Containers []struct {
+			Usage corev1.ResourceList `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+// CollectNodeInfo returns the capacity of every node in the cluster
+func CollectNodeInfo(ctx context.Context, client kubernetes.Interface) ([]NodeInfo, error) {
+	nodeList, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	nodes := make([]NodeInfo, 0, len(nodeList.Items))
+	for i := range nodeList.Items {
+		nodes = append(nodes, NodeInfoFromNode(&nodeList.Items[i]))
+	}
+	return nodes, nil
+}
+
+// AddNamespaceUsage fills in the usage of the pods of namespace on each node
+// from metrics.k8s.io. On error, e.g. when metrics-server is not installed,
+// nodes are left with UsageKnown false.
+func AddNamespaceUsage(ctx context.Context, client kubernetes.Interface, namespace string, nodes []NodeInfo) error {
+	cpuUsage, memoryUsage, err := namespaceUsageByNode(ctx, client, namespace)
+	if err != nil {
+		return err
+	}
+
+	for i := range nodes {
+		nodes[i].UsageKnown = true
+		nodes[i].NamespaceCPUMillis = cpuUsage[nodes[i].Name]
+		nodes[i].NamespaceMemoryBytes = memoryUsage[nodes[i].Name]
+	}
+	return nil
+}
+
+// namespaceUsageByNode sums the CPU (millicores) and memory (bytes) used by
+// the pods of namespace, keyed by the node they run on
+func namespaceUsageByNode(ctx context.Context, client kubernetes.Interface, namespace string) (cpuMillis, memoryBytes map[string]int64, err error) {
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list pods in %s: %w", namespace, err)
+	}
+	podNodes := make(map[string]string, len(pods.Items))
+	for _, pod := range pods.Items {
+		podNodes[pod.Name] = pod.Spec.NodeName
+	}
+
+	raw, err := client.CoreV1().RESTClient().Get().AbsPath(podMetricsPath, namespace, "pods").DoRaw(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get pod metrics for %s (is metrics-server installed?): %w", namespace, err)
+	}
+	var metrics podMetricsList
+	if err := json.Unmarshal(raw, &metrics); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode pod metrics for %s: %w", namespace, err)
+	}
+
+	cpuMillis = map[string]int64{}
+	memoryBytes = map[string]int64{}
+	for _, pod := range metrics.Items {
+		node, ok := podNodes[pod.Metadata.Name]
+		if !ok || node == "" {
+			continue
+		}
+		for _, container := range pod.Containers {
+			if cpu, ok := container.Usage[corev1.ResourceCPU]; ok {
+				cpuMillis[node] += cpu.MilliValue()
+			}
+			if memory, ok := container.Usage[corev1.ResourceMemory]; ok {
+				memoryBytes[node] += memory.Value()
+			}
+		}
+	}
+	return cpuMillis, memoryBytes, nil
+}
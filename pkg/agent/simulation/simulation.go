@@ -0,0 +1,129 @@
+// Package simulation checks a NamespaceQuota spec against the nodes it would
+// be applied to, so operators can spot unachievable limits before creating it.
+package simulation
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/agent"
+	"github.com/fulcro-cloud/namespace-isolation/pkg/api/v1alpha1"
+)
+
+// NodeInfo describes a node a quota would be applied on. Every agent limits
+// the namespace's pods on its own node, so usage is per node as well.
+type NodeInfo struct {
+	Name   string
+	Labels map[string]string
+
+	// CPUMillis and MemoryBytes are the node capacity
+	CPUMillis   int64
+	MemoryBytes int64
+
+	// UsageKnown is false when pod metrics were unavailable; the usage
+	// fields are then zero and not checked.
+	UsageKnown bool
+	// NamespaceCPUMillis and NamespaceMemoryBytes are the current usage of
+	// the namespace's pods running on the node
+	NamespaceCPUMillis   int64
+	NamespaceMemoryBytes int64
+}
+
+// NodeInfoFromNode reads the capacity of node from its status
+func NodeInfoFromNode(node *corev1.Node) NodeInfo {
+	info := NodeInfo{Name: node.Name, Labels: node.Labels}
+	if cpu, ok := node.Status.Capacity[corev1.ResourceCPU]; ok {
+		info.CPUMillis = cpu.MilliValue()
+	}
+	if memory, ok := node.Status.Capacity[corev1.ResourceMemory]; ok {
+		info.MemoryBytes = memory.Value()
+	}
+	return info
+}
+
+// Selected reports whether the node matches the quota's node selector
+func (n NodeInfo) Selected(spec v1alpha1.NamespaceQuotaSpec) bool {
+	return labels.SelectorFromSet(spec.NodeSelector).Matches(labels.Set(n.Labels))
+}
+
+// SimulationResult lists the problems found for one node. A quota with
+// warnings can still be created, but will not behave as intended there.
+type SimulationResult struct {
+	Node     string
+	Warnings []string
+}
+
+// OK reports whether the simulation found no problem
+func (r SimulationResult) OK() bool {
+	return len(r.Warnings) == 0
+}
+
+func (r *SimulationResult) warn(format string, args ...any) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Simulate checks spec against the capacity and current usage of a node.
+// The spec is assumed to have passed agent.ValidateNamespaceQuotaSpec.
+func Simulate(spec v1alpha1.NamespaceQuotaSpec, nodeInfo NodeInfo) SimulationResult {
+	result := SimulationResult{Node: nodeInfo.Name}
+
+	if spec.CPU != "" {
+		if cpu, err := resource.ParseQuantity(strings.TrimSpace(spec.CPU)); err == nil {
+			cpuMillis := cpu.MilliValue()
+			if nodeInfo.CPUMillis > 0 && cpuMillis > nodeInfo.CPUMillis {
+				result.warn("CPU quota exceeds node capacity (%dm > %dm)", cpuMillis, nodeInfo.CPUMillis)
+			}
+			if nodeInfo.UsageKnown && cpuMillis < nodeInfo.NamespaceCPUMillis {
+				result.warn("CPU quota is less than current pod usage (%dm < %dm), pods will be throttled",
+					cpuMillis, nodeInfo.NamespaceCPUMillis)
+			}
+		}
+	}
+
+	if spec.Memory != "" {
+		if memory, err := agent.ParseMemory(spec.Memory); err == nil {
+			if nodeInfo.MemoryBytes > 0 && memory > nodeInfo.MemoryBytes {
+				result.warn("Memory limit exceeds node capacity (%s > %s)",
+					agent.FormatMemoryForDisplay(memory), agent.FormatMemoryForDisplay(nodeInfo.MemoryBytes))
+			}
+			if nodeInfo.UsageKnown && memory < nodeInfo.NamespaceMemoryBytes {
+				result.warn("Memory limit is less than current pod usage (%s < %s), pods may be OOM killed",
+					agent.FormatMemoryForDisplay(memory), agent.FormatMemoryForDisplay(nodeInfo.NamespaceMemoryBytes))
+			}
+		}
+	}
+
+	if spec.MemoryMin != "" {
+		if memoryMin, err := agent.ParseMemory(spec.MemoryMin); err == nil && nodeInfo.MemoryBytes > 0 && memoryMin > nodeInfo.MemoryBytes {
+			result.warn("Memory min exceeds node capacity (%s > %s)",
+				agent.FormatMemoryForDisplay(memoryMin), agent.FormatMemoryForDisplay(nodeInfo.MemoryBytes))
+		}
+	}
+
+	if spec.CPUSet != "" && nodeInfo.CPUMillis > 0 {
+		nodeCPUs := (nodeInfo.CPUMillis + 999) / 1000
+		if highest := highestCPU(spec.CPUSet); int64(highest) >= nodeCPUs {
+			result.warn("cpuset references CPU %d but the node has %d CPUs", highest, nodeCPUs)
+		}
+	}
+
+	return result
+}
+
+// highestCPU returns the largest CPU number in a cpuset list such as "0-3,8"
+func highestCPU(cpuSet string) int {
+	highest := -1
+	for _, cpuRange := range strings.Split(cpuSet, ",") {
+		for _, bound := range strings.SplitN(cpuRange, "-", 2) {
+			if cpu, err := strconv.Atoi(bound); err == nil && cpu > highest {
+				highest = cpu
+			}
+		}
+	}
+	return highest
+}
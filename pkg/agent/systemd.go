@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Values of --systemd-executor
+const (
+	SystemdExecutorNsenter = "nsenter"
+	SystemdExecutorDirect  = "direct"
+	SystemdExecutorNoop    = "noop"
+)
+
+// SystemdInterface sets runtime properties (systemctl set-property --runtime)
+// of a slice unit, and checks that systemd answers (systemctl status).
+// Failures are reported as *SystemdError.
+type SystemdInterface interface {
+	SetProperties(ctx context.Context, slice string, properties ...string) error
+	Ping(ctx context.Context) error
+}
+
+// SystemdNsenterExecutor runs systemctl in the mount, UTS and network
+// namespaces of the host's PID 1. It is used when the agent runs in a
+// container of a Linux DaemonSet, with hostPID.
+type SystemdNsenterExecutor struct {
+	Executor Executor
+}
+
+func (s SystemdNsenterExecutor) SetProperties(ctx context.Context, slice string, properties ...string) error {
+	return s.run(ctx, setPropertyArgs(slice, properties)...)
+}
+
+func (s SystemdNsenterExecutor) Ping(ctx context.Context) error {
+	return s.run(ctx, statusArgs...)
+}
+
+func (s SystemdNsenterExecutor) run(ctx context.Context, systemctlArgs ...string) error {
+	args := append([]string{"-t", "1", "-m", "-u", "-n", "--", "systemctl"}, systemctlArgs...)
+	if output, err := s.Executor.Run(ctx, "nsenter", args...); err != nil {
+		return &SystemdError{Err: err, Output: string(output)}
+	}
+	return nil
+}
+
+// SystemdDirectExecutor runs systemctl directly, for an agent running on the
+// host itself
+type SystemdDirectExecutor struct {
+	Executor Executor
+}
+
+func (s SystemdDirectExecutor) SetProperties(ctx context.Context, slice string, properties ...string) error {
+	return s.run(ctx, setPropertyArgs(slice, properties)...)
+}
+
+func (s SystemdDirectExecutor) Ping(ctx context.Context) error {
+	return s.run(ctx, statusArgs...)
+}
+
+func (s SystemdDirectExecutor) run(ctx context.Context, args ...string) error {
+	if output, err := s.Executor.Run(ctx, "systemctl", args...); err != nil {
+		return &SystemdError{Err: err, Output: string(output)}
+	}
+	return nil
+}
+
+// SystemdNoopExecutor only logs the properties, for development machines and
+// CI environments without systemd. Limits are then not enforced.
+type SystemdNoopExecutor struct {
+	Log *logrus.Logger
+}
+
+func (s SystemdNoopExecutor) SetProperties(_ context.Context, slice string, properties ...string) error {
+	s.Log.WithFields(logrus.Fields{
+		"slice":      slice,
+		"properties": properties,
+	}).Debug("Skipping systemd call")
+	return nil
+}
+
+func (s SystemdNoopExecutor) Ping(context.Context) error {
+	return nil
+}
+
+// statusArgs are the systemctl arguments of Ping
+var statusArgs = []string{"status", "--no-pager"}
+
+func setPropertyArgs(slice string, properties []string) []string {
+	args := append([]string{"set-property", slice}, properties...)
+	return append(args, "--runtime")
+}
+
+// NewSystemd returns the SystemdInterface for an executor name. An empty name
+// picks nsenter on Linux and noop elsewhere.
+func NewSystemd(name string, log *logrus.Logger) (SystemdInterface, error) {
+	if name == "" {
+		name = SystemdExecutorNoop
+		if runtime.GOOS == "linux" {
+			name = SystemdExecutorNsenter
+		}
+	}
+
+	switch name {
+	case SystemdExecutorNsenter:
+		return SystemdNsenterExecutor{Executor: RealExecutor{}}, nil
+	case SystemdExecutorDirect:
+		return SystemdDirectExecutor{Executor: RealExecutor{}}, nil
+	case SystemdExecutorNoop:
+		log.Warn("Using the noop systemd executor, limits will not be enforced")
+		return SystemdNoopExecutor{Log: log}, nil
+	default:
+		return nil, fmt.Errorf("unknown systemd executor %q (expected %s, %s or %s)",
+			name, SystemdExecutorNsenter, SystemdExecutorDirect, SystemdExecutorNoop)
+	}
+}
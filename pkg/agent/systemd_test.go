@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/agent/testutil"
+)
+
+func TestSystemdExecutorArgs(t *testing.T) {
+	ping := func(s SystemdInterface) error {
+		return s.Ping(context.Background())
+	}
+	setProperties := func(s SystemdInterface) error {
+		return s.SetProperties(context.Background(), "brasa-team-a.slice", "CPUQuota=50%")
+	}
+
+	tests := []struct {
+		name    string
+		systemd func(Executor) SystemdInterface
+		run     func(SystemdInterface) error
+		want    string
+	}{
+		{
+			name:    "nsenter ping",
+			systemd: func(e Executor) SystemdInterface { return SystemdNsenterExecutor{Executor: e} },
+			run:     ping,
+			want:    "nsenter -t 1 -m -u -n -- systemctl status --no-pager",
+		},
+		{
+			name:    "nsenter set properties",
+			systemd: func(e Executor) SystemdInterface { return SystemdNsenterExecutor{Executor: e} },
+			run:     setProperties,
+			want:    "nsenter -t 1 -m -u -n -- systemctl set-property brasa-team-a.slice CPUQuota=50% --runtime",
+		},
+		{
+			name:    "direct ping",
+			systemd: func(e Executor) SystemdInterface { return SystemdDirectExecutor{Executor: e} },
+			run:     ping,
+			want:    "systemctl status --no-pager",
+		},
+		{
+			name:    "direct set properties",
+			systemd: func(e Executor) SystemdInterface { return SystemdDirectExecutor{Executor: e} },
+			run:     setProperties,
+			want:    "systemctl set-property brasa-team-a.slice CPUQuota=50% --runtime",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := &testutil.FakeExecutor{}
+			if err := tt.run(tt.systemd(executor)); err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if calls := executor.Calls(); len(calls) != 1 || calls[0].String() != tt.want {
+				t.Errorf("ran %v, want %q", calls, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Package testutil provides helpers for exercising the agent without a real
+// cgroup v2 mount.
+package testutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// DefaultSlicePrefix matches the agent's default --slice-prefix
+const DefaultSlicePrefix = "brasa.slice"
+
+// SliceValues are the interface file contents written for a fake slice
+type SliceValues struct {
+	CPUUsageUsec  int64
+	CPUThrottled  int64
+	MemoryCurrent int64
+	OOMKills      int64
+
+	// CPUMax and MemoryMax use the kernel format, e.g. "200000 100000" and
+	// "max". Empty values default to unlimited.
+	CPUMax    string
+	MemoryMax string
+}
+
+// FakeCgroupFS is a temporary directory laid out like /sys/fs/cgroup. Pass
+// Root() as the cgroup root of a CgroupManager.
+type FakeCgroupFS struct {
+	t           testing.TB
+	root        string
+	slicePrefix string
+}
+
+// NewFakeCgroupFS creates an empty cgroup v2 tree that is removed when the test ends
+func NewFakeCgroupFS(t testing.TB) *FakeCgroupFS {
+	t.Helper()
+
+	f := &FakeCgroupFS{
+		t:           t,
+		root:        t.TempDir(),
+		slicePrefix: DefaultSlicePrefix,
+	}
+	f.WriteFile("cgroup.controllers", "cpuset cpu io memory pids")
+	f.WriteFile("cgroup.subtree_control", "")
+	return f
+}
+
+// Root returns the directory that stands in for /sys/fs/cgroup
+func (f *FakeCgroupFS) Root() string {
+	return f.root
+}
+
+// SlicePrefix returns the parent slice the fake namespace slices live under
+func (f *FakeCgroupFS) SlicePrefix() string {
+	return f.slicePrefix
+}
+
+// SetSlicePrefix changes the parent slice used by subsequent AddSlice calls
+func (f *FakeCgroupFS) SetSlicePrefix(slicePrefix string) {
+	f.slicePrefix = slicePrefix
+}
+
+// SlicePath returns the path of a namespace slice, mirroring
+// CgroupManager.GetSlicePath
+func (f *FakeCgroupFS) SlicePath(namespace string) string {
+	prefix := strings.TrimSuffix(f.slicePrefix, ".slice")
+	return filepath.Join(f.root, f.slicePrefix, fmt.Sprintf("%s-%s.slice", prefix, namespace))
+}
+
+// AddSlice creates the slice for namespace and populates its interface files
+func (f *FakeCgroupFS) AddSlice(namespace string, values SliceValues) string {
+	f.t.Helper()
+
+	cpuMax := values.CPUMax
+	if cpuMax == "" {
+		cpuMax = "max 100000"
+	}
+	memoryMax := values.MemoryMax
+	if memoryMax == "" {
+		memoryMax = "max"
+	}
+
+	slicePath := f.SlicePath(namespace)
+	rel, err := filepath.Rel(f.root, slicePath)
+	if err != nil {
+		f.t.Fatalf("failed to resolve slice path for %s: %v", namespace, err)
+	}
+
+	f.WriteFile(filepath.Join(f.slicePrefix, "cgroup.subtree_control"), "")
+	f.WriteFile(filepath.Join(rel, "cpu.stat"), fmt.Sprintf(
+		"usage_usec %d\nuser_usec 0\nsystem_usec 0\nnr_periods 0\nnr_throttled %d\nthrottled_usec 0\n",
+		values.CPUUsageUsec, values.CPUThrottled))
+	f.WriteFile(filepath.Join(rel, "cpu.max"), cpuMax+"\n")
+	f.WriteFile(filepath.Join(rel, "memory.current"), fmt.Sprintf("%d\n", values.MemoryCurrent))
+	f.WriteFile(filepath.Join(rel, "memory.max"), memoryMax+"\n")
+	f.WriteFile(filepath.Join(rel, "memory.events"), fmt.Sprintf(
+		"low 0\nhigh 0\nmax 0\noom 0\noom_kill %d\n", values.OOMKills))
+	return slicePath
+}
+
+// WriteFile writes content to a path relative to Root, creating parent directories
+func (f *FakeCgroupFS) WriteFile(rel, content string) {
+	f.t.Helper()
+
+	path := filepath.Join(f.root, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		f.t.Fatalf("failed to create %s: %v", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		f.t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+// ReadFile returns the content of a path relative to Root
+func (f *FakeCgroupFS) ReadFile(rel string) string {
+	f.t.Helper()
+
+	content, err := os.ReadFile(filepath.Join(f.root, rel))
+	if err != nil {
+		f.t.Fatalf("failed to read %s: %v", rel, err)
+	}
+	return string(content)
+}
@@ -0,0 +1,52 @@
+package testutil
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Call is a single command recorded by FakeExecutor
+type Call struct {
+	Name string
+	Args []string
+}
+
+// String renders the call as a shell-like command line
+func (c Call) String() string {
+	return strings.Join(append([]string{c.Name}, c.Args...), " ")
+}
+
+// FakeExecutor records every command instead of running it and replies with
+// Output and Err. It satisfies agent.Executor.
+type FakeExecutor struct {
+	mu    sync.Mutex
+	calls []Call
+
+	Output []byte
+	Err    error
+}
+
+func (e *FakeExecutor) Run(_ context.Context, name string, args ...string) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.calls = append(e.calls, Call{Name: name, Args: append([]string(nil), args...)})
+	return e.Output, e.Err
+}
+
+// Calls returns a copy of the commands run so far
+func (e *FakeExecutor) Calls() []Call {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]Call(nil), e.calls...)
+}
+
+// Reset forgets all recorded calls
+func (e *FakeExecutor) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.calls = nil
+}
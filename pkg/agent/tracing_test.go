@@ -0,0 +1,82 @@
+package agent
+
+import (
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestReconcileSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	rt := newReconcilerTest(t, []string{"team-a"}, newTestQuota("quota-a", "team-a", "500m", "1Gi"))
+	rt.reconciler.metricsServer = NewMetricsServer(rt.reconciler.cgroupManager, "0", "", "", rt.reconciler.log)
+	addTestSlice(rt.fs, "team-a")
+
+	if err := rt.reconcile(t, "quota-a"); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	tests := []struct {
+		name  string
+		attrs []attribute.KeyValue
+	}{
+		{
+			name:  "NamespaceQuotaReconciler.Reconcile",
+			attrs: []attribute.KeyValue{attribute.String("key", "quota-a")},
+		},
+		{
+			name: "CgroupManager.EnsureSlice",
+			attrs: []attribute.KeyValue{
+				attribute.String("namespace", "team-a"),
+				attribute.String("cpu", "500m"),
+				attribute.String("memory", "1Gi"),
+			},
+		},
+		{
+			name: "K8sClient.UpdateStatus",
+			attrs: []attribute.KeyValue{
+				attribute.String("name", "quota-a"),
+				attribute.Bool("ready", true),
+			},
+		},
+		{
+			name:  "MetricsServer.ReadCgroupStats",
+			attrs: []attribute.KeyValue{attribute.String("namespace", "team-a")},
+		},
+	}
+
+	reconcile := spans["NamespaceQuotaReconciler.Reconcile"]
+	if reconcile == nil {
+		t.Fatalf("no reconcile span among %d spans", len(spans))
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span := spans[tt.name]
+			if span == nil {
+				t.Fatalf("span %s not recorded", tt.name)
+			}
+			for _, want := range tt.attrs {
+				if !slices.Contains(span.Attributes(), want) {
+					t.Errorf("span %s attributes = %v, want %s=%s", tt.name, span.Attributes(), want.Key, want.Value.Emit())
+				}
+			}
+			if span != reconcile && span.Parent().SpanID() != reconcile.SpanContext().SpanID() {
+				t.Errorf("span %s is not a child of the reconcile span", tt.name)
+			}
+		})
+	}
+}
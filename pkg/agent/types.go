@@ -2,47 +2,193 @@ package agent
 
 import (
 	"fmt"
+	"regexp"
 
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/api/v1alpha1"
+	"github.com/fulcro-cloud/namespace-isolation/pkg/client/clientset/versioned/scheme"
+)
+
+// Namespace annotations read when --auto-create-from-annotations is enabled
+const (
+	AnnotationCPULimit    = "brasa.cloud/cpu-limit"
+	AnnotationMemoryLimit = "brasa.cloud/memory-limit"
+
+	// LabelCreatedFromAnnotations marks NamespaceQuotas the agent created from
+	// namespace annotations; only those are updated or deleted automatically.
+	LabelCreatedFromAnnotations = "brasa.cloud/created-from-annotations"
+
+	// LabelPolicy names the NamespaceIsolationPolicy a NamespaceQuota was
+	// created from; only those are updated or deleted by the policy controller.
+	LabelPolicy = "brasa.cloud/policy"
 )
 
+// cgroupAttributePattern matches cgroup interface file names such as
+// memory.zswap.max, which have no path separator
+var cgroupAttributePattern = regexp.MustCompile(`^[a-z]+(\.[a-z0-9_]+)+$`)
+
 var NamespaceQuotaGVR = schema.GroupVersionResource{
-	Group:    "brasa.cloud",
-	Version:  "v1alpha1",
+	Group:    v1alpha1.Group,
+	Version:  v1alpha1.Version,
 	Resource: "namespacequotas",
 }
 
-type NamespaceQuotaSpec struct {
-	Namespace string
-	CPU       string
-	Memory    string
-	Enabled   bool
+// DecodeNamespaceQuota decodes a serialized (JSON or YAML) NamespaceQuota and validates its spec
+func DecodeNamespaceQuota(data []byte) (*v1alpha1.NamespaceQuota, error) {
+	obj, gvk, err := scheme.Codecs.UniversalDeserializer().Decode(data, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode NamespaceQuota: %w", err)
+	}
+
+	quota, ok := obj.(*v1alpha1.NamespaceQuota)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object kind %s, expected NamespaceQuota", gvk.Kind)
+	}
+
+	if err := ValidateNamespaceQuotaSpec(&quota.Spec); err != nil {
+		return nil, err
+	}
+
+	return quota, nil
 }
 
-func ParseNamespaceQuota(obj *unstructured.Unstructured) (*NamespaceQuotaSpec, error) {
-	spec, found, err := unstructured.NestedMap(obj.Object, "spec")
-	if err != nil || !found {
-		return nil, fmt.Errorf("spec not found in NamespaceQuota")
+// ValidateNamespaceQuotaSpec checks the spec fields, reporting each invalid
+// field by its path (e.g. "spec.cpu: Invalid value: ...").
+func ValidateNamespaceQuotaSpec(spec *v1alpha1.NamespaceQuotaSpec) error {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	if spec.Namespace == "" {
+		errs = append(errs, field.Required(specPath.Child("namespace"), "target namespace is required"))
+	} else {
+		for _, msg := range validation.IsDNS1123Label(spec.Namespace) {
+			errs = append(errs, field.Invalid(specPath.Child("namespace"), spec.Namespace, msg))
+		}
 	}
 
-	namespace, _, _ := unstructured.NestedString(spec, "namespace")
-	if namespace == "" {
-		return nil, fmt.Errorf("namespace field is required")
+	if spec.CPU != "" {
+		if _, err := ParseCPU(spec.CPU, DefaultCPUPeriod); err != nil {
+			errs = append(errs, field.Invalid(specPath.Child("cpu"), spec.CPU, err.Error()))
+		}
 	}
 
-	cpu, _, _ := unstructured.NestedString(spec, "cpu")
-	memory, _, _ := unstructured.NestedString(spec, "memory")
+	errs = append(errs, validateConfigMapKeyRef(specPath.Child("cpuFromConfigMapKeyRef"), spec.CPUFromConfigMapKeyRef)...)
+	if spec.CPUFromConfigMapKeyRef != nil && spec.CPU != "" {
+		errs = append(errs, field.Forbidden(specPath.Child("cpuFromConfigMapKeyRef"), "cannot be combined with cpu"))
+	}
+	errs = append(errs, validateConfigMapKeyRef(specPath.Child("memoryFromConfigMapKeyRef"), spec.MemoryFromConfigMapKeyRef)...)
+	if spec.MemoryFromConfigMapKeyRef != nil && spec.Memory != "" {
+		errs = append(errs, field.Forbidden(specPath.Child("memoryFromConfigMapKeyRef"), "cannot be combined with memory"))
+	}
+
+	if spec.CPUWeight != 0 && (spec.CPUWeight < MinCPUWeight || spec.CPUWeight > MaxCPUWeight) {
+		errs = append(errs, field.Invalid(specPath.Child("cpuWeight"), spec.CPUWeight,
+			fmt.Sprintf("must be between %d and %d", MinCPUWeight, MaxCPUWeight)))
+	}
+
+	// systemd implements cpu.idle as CPUWeight=idle and rejects a CPU quota
+	// on an idle slice
+	if spec.CPUIdle != nil && *spec.CPUIdle {
+		if spec.CPU != "" || spec.CPUFromConfigMapKeyRef != nil {
+			errs = append(errs, field.Forbidden(specPath.Child("cpuIdle"), "cannot be combined with cpu"))
+		}
+		if spec.CPUWeight != 0 {
+			errs = append(errs, field.Forbidden(specPath.Child("cpuIdle"), "cannot be combined with cpuWeight"))
+		}
+	}
 
-	enabled := true
-	if enabledVal, found, _ := unstructured.NestedBool(spec, "enabled"); found {
-		enabled = enabledVal
+	// The PriorityClass value sets the CPUWeight
+	if spec.PriorityClass != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(spec.PriorityClass) {
+			errs = append(errs, field.Invalid(specPath.Child("priorityClass"), spec.PriorityClass, msg))
+		}
+		if spec.CPUWeight != 0 {
+			errs = append(errs, field.Forbidden(specPath.Child("priorityClass"), "cannot be combined with cpuWeight"))
+		}
+		if spec.CPUIdle != nil && *spec.CPUIdle {
+			errs = append(errs, field.Forbidden(specPath.Child("priorityClass"), "cannot be combined with cpuIdle"))
+		}
 	}
 
-	return &NamespaceQuotaSpec{
-		Namespace: namespace,
-		CPU:       cpu,
-		Memory:    memory,
-		Enabled:   enabled,
-	}, nil
+	if spec.CPUSet != "" {
+		if err := ParseCPUSet(spec.CPUSet); err != nil {
+			errs = append(errs, field.Invalid(specPath.Child("cpuSet"), spec.CPUSet, err.Error()))
+		}
+	}
+
+	memoryMax, err := parseOptionalMemory(spec.Memory)
+	if err != nil {
+		errs = append(errs, field.Invalid(specPath.Child("memory"), spec.Memory, err.Error()))
+	}
+	memoryMin, err := parseOptionalMemory(spec.MemoryMin)
+	if err != nil {
+		errs = append(errs, field.Invalid(specPath.Child("memoryMin"), spec.MemoryMin, err.Error()))
+	}
+	memoryLow, err := parseOptionalMemory(spec.MemoryLow)
+	if err != nil {
+		errs = append(errs, field.Invalid(specPath.Child("memoryLow"), spec.MemoryLow, err.Error()))
+	}
+	memoryHigh, err := parseOptionalMemory(spec.MemoryHigh)
+	if err != nil {
+		errs = append(errs, field.Invalid(specPath.Child("memoryHigh"), spec.MemoryHigh, err.Error()))
+	}
+	if len(errs) == 0 {
+		// Without memoryMin, only memoryLow is checked against memory
+		if err := ValidateMemoryProtection(0, memoryLow, memoryMax); err != nil {
+			errs = append(errs, field.Invalid(specPath.Child("memoryLow"), spec.MemoryLow, err.Error()))
+		} else if err := ValidateMemoryProtection(memoryMin, memoryLow, memoryMax); err != nil {
+			errs = append(errs, field.Invalid(specPath.Child("memoryMin"), spec.MemoryMin, err.Error()))
+		}
+		if err := ValidateMemoryHigh(memoryHigh, memoryMax); err != nil {
+			errs = append(errs, field.Invalid(specPath.Child("memoryHigh"), spec.MemoryHigh, err.Error()))
+		}
+	}
+
+	// Whether the node supports a hugepage size is checked by each agent
+	for size, limit := range spec.HugepagesLimits {
+		path := specPath.Child("hugepagesLimits").Key(size)
+		if _, err := ParseHugepageSize(size); err != nil {
+			errs = append(errs, field.Invalid(path, size, err.Error()))
+		}
+		if _, err := ParseMemory(limit); err != nil {
+			errs = append(errs, field.Invalid(path, limit, err.Error()))
+		}
+	}
+
+	// Whether an attribute may be written is up to each agent's allowlist
+	for attribute := range spec.RawAttributes {
+		if !cgroupAttributePattern.MatchString(attribute) {
+			errs = append(errs, field.Invalid(specPath.Child("rawAttributes").Key(attribute), attribute,
+				"must be a cgroup file name such as memory.zswap.max"))
+		}
+	}
+
+	return errs.ToAggregate()
+}
+
+func validateConfigMapKeyRef(path *field.Path, ref *corev1.ConfigMapKeySelector) field.ErrorList {
+	if ref == nil {
+		return nil
+	}
+
+	var errs field.ErrorList
+	if ref.Name == "" {
+		errs = append(errs, field.Required(path.Child("name"), "ConfigMap name is required"))
+	} else {
+		for _, msg := range validation.IsDNS1123Subdomain(ref.Name) {
+			errs = append(errs, field.Invalid(path.Child("name"), ref.Name, msg))
+		}
+	}
+	if ref.Key == "" {
+		errs = append(errs, field.Required(path.Child("key"), "ConfigMap key is required"))
+	} else {
+		for _, msg := range validation.IsConfigMapKey(ref.Key) {
+			errs = append(errs, field.Invalid(path.Child("key"), ref.Key, msg))
+		}
+	}
+	return errs
 }
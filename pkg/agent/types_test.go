@@ -0,0 +1,40 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/api/v1alpha1"
+)
+
+func TestValidateNamespaceQuotaSpecMemoryProtection(t *testing.T) {
+	tests := []struct {
+		name      string
+		memory    string
+		memoryMin string
+		memoryLow string
+		wantField string
+	}{
+		{name: "valid", memory: "2Gi", memoryMin: "512Mi", memoryLow: "1Gi"},
+		{name: "memoryLow above memory", memory: "1Gi", memoryLow: "2Gi", wantField: "spec.memoryLow"},
+		{name: "memoryLow above memory with memoryMin", memory: "1Gi", memoryMin: "512Mi", memoryLow: "2Gi", wantField: "spec.memoryLow"},
+		{name: "memoryMin above memoryLow", memory: "2Gi", memoryMin: "1Gi", memoryLow: "512Mi", wantField: "spec.memoryMin"},
+		{name: "memoryMin above memory", memory: "1Gi", memoryMin: "2Gi", wantField: "spec.memoryMin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &v1alpha1.NamespaceQuotaSpec{Namespace: "team-a", Memory: tt.memory, MemoryMin: tt.memoryMin, MemoryLow: tt.memoryLow}
+			err := ValidateNamespaceQuotaSpec(spec)
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatalf("ValidateNamespaceQuotaSpec() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantField+":") {
+				t.Errorf("ValidateNamespaceQuotaSpec() error = %v, want one on %s", err, tt.wantField)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types reported in NamespaceQuotaStatus.Conditions
+const (
+	// ConditionCgroupReady is true when the namespace slice exists with the requested limits
+	ConditionCgroupReady = "CgroupReady"
+	// ConditionSpecValid is true when the spec parses and passes validation
+	ConditionSpecValid = "SpecValid"
+	// ConditionSystemdReachable is true when the agent could apply limits through systemd
+	ConditionSystemdReachable = "SystemdReachable"
+)
+
+// Condition reasons reported by the agent
+const (
+	ReasonCgroupConfigured = "CgroupConfigured"
+	ReasonCgroupNotFound   = "CgroupNotFound"
+	ReasonCgroupError      = "CgroupError"
+	ReasonSystemdError     = "SystemdError"
+	// ReasonSystemdUnreachable: systemd did not answer the agent's health
+	// probe, so no limits were applied
+	ReasonSystemdUnreachable = "SystemdUnreachable"
+	ReasonParseError         = "ParseError"
+	ReasonSpecValid          = "SpecValid"
+	ReasonQuotaDisabled      = "QuotaDisabled"
+	ReasonNodeNotSelected    = "NodeNotSelected"
+	ReasonNamespaceNotFound  = "NamespaceNotFound"
+)
+
+// SetCondition adds or updates the condition of the same type. The
+// LastTransitionTime only changes when the condition status changes.
+func (s *NamespaceQuotaStatus) SetCondition(condition metav1.Condition) {
+	meta.SetStatusCondition(&s.Conditions, condition)
+}
+
+// GetCondition returns the condition of the given type, or nil if absent
+func (s *NamespaceQuotaStatus) GetCondition(conditionType string) *metav1.Condition {
+	return meta.FindStatusCondition(s.Conditions, conditionType)
+}
+
+// RemoveCondition removes the condition of the given type if present
+func (s *NamespaceQuotaStatus) RemoveCondition(conditionType string) {
+	meta.RemoveStatusCondition(&s.Conditions, conditionType)
+}
@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -31,6 +32,38 @@ func (in *NamespaceQuotaSpec) DeepCopyInto(out *NamespaceQuotaSpec) {
 		out.Enabled = new(bool)
 		*out.Enabled = *in.Enabled
 	}
+	if in.OOMGroup != nil {
+		out.OOMGroup = new(bool)
+		*out.OOMGroup = *in.OOMGroup
+	}
+	if in.CPUIdle != nil {
+		out.CPUIdle = new(bool)
+		*out.CPUIdle = *in.CPUIdle
+	}
+	if in.CPUFromConfigMapKeyRef != nil {
+		out.CPUFromConfigMapKeyRef = in.CPUFromConfigMapKeyRef.DeepCopy()
+	}
+	if in.MemoryFromConfigMapKeyRef != nil {
+		out.MemoryFromConfigMapKeyRef = in.MemoryFromConfigMapKeyRef.DeepCopy()
+	}
+	if in.NodeSelector != nil {
+		out.NodeSelector = make(map[string]string, len(in.NodeSelector))
+		for key, val := range in.NodeSelector {
+			out.NodeSelector[key] = val
+		}
+	}
+	if in.HugepagesLimits != nil {
+		out.HugepagesLimits = make(map[string]string, len(in.HugepagesLimits))
+		for key, val := range in.HugepagesLimits {
+			out.HugepagesLimits[key] = val
+		}
+	}
+	if in.RawAttributes != nil {
+		out.RawAttributes = make(map[string]string, len(in.RawAttributes))
+		for key, val := range in.RawAttributes {
+			out.RawAttributes[key] = val
+		}
+	}
 }
 
 func (in *NamespaceQuotaSpec) DeepCopy() *NamespaceQuotaSpec {
@@ -47,6 +80,12 @@ func (in *NamespaceQuotaStatus) DeepCopyInto(out *NamespaceQuotaStatus) {
 	if in.LastUpdated != nil {
 		out.LastUpdated = in.LastUpdated.DeepCopy()
 	}
+	if in.Conditions != nil {
+		out.Conditions = make([]metav1.Condition, len(in.Conditions))
+		for i := range in.Conditions {
+			in.Conditions[i].DeepCopyInto(&out.Conditions[i])
+		}
+	}
 }
 
 func (in *NamespaceQuotaStatus) DeepCopy() *NamespaceQuotaStatus {
@@ -82,3 +121,64 @@ func (in *NamespaceQuotaList) DeepCopy() *NamespaceQuotaList {
 func (in *NamespaceQuotaList) DeepCopyObject() runtime.Object {
 	return in.DeepCopy()
 }
+
+func (in *NamespaceIsolationPolicy) DeepCopyInto(out *NamespaceIsolationPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+func (in *NamespaceIsolationPolicy) DeepCopy() *NamespaceIsolationPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceIsolationPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *NamespaceIsolationPolicy) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+func (in *NamespaceIsolationPolicySpec) DeepCopyInto(out *NamespaceIsolationPolicySpec) {
+	*out = *in
+	if in.NamespaceSelector != nil {
+		out.NamespaceSelector = in.NamespaceSelector.DeepCopy()
+	}
+}
+
+func (in *NamespaceIsolationPolicySpec) DeepCopy() *NamespaceIsolationPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceIsolationPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *NamespaceIsolationPolicyList) DeepCopyInto(out *NamespaceIsolationPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]NamespaceIsolationPolicy, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+func (in *NamespaceIsolationPolicyList) DeepCopy() *NamespaceIsolationPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceIsolationPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *NamespaceIsolationPolicyList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
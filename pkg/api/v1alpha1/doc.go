@@ -0,0 +1,4 @@
+// Package v1alpha1 contains the v1alpha1 API of the brasa.cloud group
+// +k8s:deepcopy-gen=package
+// +groupName=brasa.cloud
+package v1alpha1
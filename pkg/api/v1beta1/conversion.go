@@ -0,0 +1,95 @@
+package v1beta1
+
+import (
+	"github.com/fulcro-cloud/namespace-isolation/pkg/api/v1alpha1"
+)
+
+// AnnotationPriorityClass carried spec.priorityClass on v1alpha1 objects
+// before v1alpha1 had the field. It is still read from objects written by
+// older clients, and dropped.
+const AnnotationPriorityClass = "brasa.cloud/priority-class"
+
+// ConvertFromV1alpha1 converts a v1alpha1 NamespaceQuota to v1beta1
+func ConvertFromV1alpha1(in *v1alpha1.NamespaceQuota) *NamespaceQuota {
+	out := &NamespaceQuota{}
+	out.TypeMeta.APIVersion = SchemeGroupVersion.String()
+	out.TypeMeta.Kind = "NamespaceQuota"
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+
+	spec := in.Spec.DeepCopy()
+	out.Spec = NamespaceQuotaSpec{
+		Namespace:                 spec.Namespace,
+		CPU:                       spec.CPU,
+		CPUFromConfigMapKeyRef:    spec.CPUFromConfigMapKeyRef,
+		CPUWeight:                 spec.CPUWeight,
+		CPUSet:                    spec.CPUSet,
+		Memory:                    spec.Memory,
+		MemoryFromConfigMapKeyRef: spec.MemoryFromConfigMapKeyRef,
+		MemoryMin:                 spec.MemoryMin,
+		MemoryLow:                 spec.MemoryLow,
+		MemoryHigh:                spec.MemoryHigh,
+		HugepagesLimits:           spec.HugepagesLimits,
+		NodeSelector:              spec.NodeSelector,
+		OOMGroup:                  spec.OOMGroup,
+		CPUIdle:                   spec.CPUIdle,
+		PriorityClass:             spec.PriorityClass,
+		RawAttributes:             spec.RawAttributes,
+		Enabled:                   spec.Enabled,
+	}
+	if priorityClass, ok := out.Annotations[AnnotationPriorityClass]; ok {
+		if out.Spec.PriorityClass == "" {
+			out.Spec.PriorityClass = priorityClass
+		}
+		delete(out.Annotations, AnnotationPriorityClass)
+		if len(out.Annotations) == 0 {
+			out.Annotations = nil
+		}
+	}
+
+	status := in.Status.DeepCopy()
+	out.Status = NamespaceQuotaStatus{
+		Ready:       status.Ready,
+		Message:     status.Message,
+		LastUpdated: status.LastUpdated,
+		Conditions:  status.Conditions,
+	}
+	return out
+}
+
+// ConvertToV1alpha1 converts a v1beta1 NamespaceQuota to v1alpha1
+func ConvertToV1alpha1(in *NamespaceQuota) *v1alpha1.NamespaceQuota {
+	out := &v1alpha1.NamespaceQuota{}
+	out.TypeMeta.APIVersion = v1alpha1.SchemeGroupVersion.String()
+	out.TypeMeta.Kind = "NamespaceQuota"
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+
+	spec := in.Spec.DeepCopy()
+	out.Spec = v1alpha1.NamespaceQuotaSpec{
+		Namespace:                 spec.Namespace,
+		CPU:                       spec.CPU,
+		CPUFromConfigMapKeyRef:    spec.CPUFromConfigMapKeyRef,
+		CPUWeight:                 spec.CPUWeight,
+		CPUSet:                    spec.CPUSet,
+		Memory:                    spec.Memory,
+		MemoryFromConfigMapKeyRef: spec.MemoryFromConfigMapKeyRef,
+		MemoryMin:                 spec.MemoryMin,
+		MemoryLow:                 spec.MemoryLow,
+		MemoryHigh:                spec.MemoryHigh,
+		HugepagesLimits:           spec.HugepagesLimits,
+		NodeSelector:              spec.NodeSelector,
+		OOMGroup:                  spec.OOMGroup,
+		CPUIdle:                   spec.CPUIdle,
+		PriorityClass:             spec.PriorityClass,
+		RawAttributes:             spec.RawAttributes,
+		Enabled:                   spec.Enabled,
+	}
+
+	status := in.Status.DeepCopy()
+	out.Status = v1alpha1.NamespaceQuotaStatus{
+		Ready:       status.Ready,
+		Message:     status.Message,
+		LastUpdated: status.LastUpdated,
+		Conditions:  status.Conditions,
+	}
+	return out
+}
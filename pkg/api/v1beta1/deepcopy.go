@@ -0,0 +1,123 @@
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func (in *NamespaceQuota) DeepCopyInto(out *NamespaceQuota) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+func (in *NamespaceQuota) DeepCopy() *NamespaceQuota {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceQuota)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *NamespaceQuota) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+func (in *NamespaceQuotaSpec) DeepCopyInto(out *NamespaceQuotaSpec) {
+	*out = *in
+	if in.Enabled != nil {
+		out.Enabled = new(bool)
+		*out.Enabled = *in.Enabled
+	}
+	if in.OOMGroup != nil {
+		out.OOMGroup = new(bool)
+		*out.OOMGroup = *in.OOMGroup
+	}
+	if in.CPUIdle != nil {
+		out.CPUIdle = new(bool)
+		*out.CPUIdle = *in.CPUIdle
+	}
+	if in.CPUFromConfigMapKeyRef != nil {
+		out.CPUFromConfigMapKeyRef = in.CPUFromConfigMapKeyRef.DeepCopy()
+	}
+	if in.MemoryFromConfigMapKeyRef != nil {
+		out.MemoryFromConfigMapKeyRef = in.MemoryFromConfigMapKeyRef.DeepCopy()
+	}
+	if in.NodeSelector != nil {
+		out.NodeSelector = make(map[string]string, len(in.NodeSelector))
+		for key, val := range in.NodeSelector {
+			out.NodeSelector[key] = val
+		}
+	}
+	if in.HugepagesLimits != nil {
+		out.HugepagesLimits = make(map[string]string, len(in.HugepagesLimits))
+		for key, val := range in.HugepagesLimits {
+			out.HugepagesLimits[key] = val
+		}
+	}
+	if in.RawAttributes != nil {
+		out.RawAttributes = make(map[string]string, len(in.RawAttributes))
+		for key, val := range in.RawAttributes {
+			out.RawAttributes[key] = val
+		}
+	}
+}
+
+func (in *NamespaceQuotaSpec) DeepCopy() *NamespaceQuotaSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceQuotaSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *NamespaceQuotaStatus) DeepCopyInto(out *NamespaceQuotaStatus) {
+	*out = *in
+	if in.LastUpdated != nil {
+		out.LastUpdated = in.LastUpdated.DeepCopy()
+	}
+	if in.Conditions != nil {
+		out.Conditions = make([]metav1.Condition, len(in.Conditions))
+		for i := range in.Conditions {
+			in.Conditions[i].DeepCopyInto(&out.Conditions[i])
+		}
+	}
+}
+
+func (in *NamespaceQuotaStatus) DeepCopy() *NamespaceQuotaStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceQuotaStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *NamespaceQuotaList) DeepCopyInto(out *NamespaceQuotaList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]NamespaceQuota, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+func (in *NamespaceQuotaList) DeepCopy() *NamespaceQuotaList {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceQuotaList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *NamespaceQuotaList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
@@ -0,0 +1,4 @@
+// Package v1beta1 contains the v1beta1 API of the brasa.cloud group
+// +k8s:deepcopy-gen=package
+// +groupName=brasa.cloud
+package v1beta1
@@ -0,0 +1,132 @@
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NamespaceQuota defines resource limits for a Kubernetes namespace
+// +kubebuilder:resource:scope=Cluster,shortName=nsq
+// +kubebuilder:printcolumn:name="Namespace",type=string,JSONPath=`.spec.namespace`
+// +kubebuilder:printcolumn:name="CPU",type=string,JSONPath=`.spec.cpu`
+// +kubebuilder:printcolumn:name="Memory",type=string,JSONPath=`.spec.memory`
+// +kubebuilder:printcolumn:name="Enabled",type=boolean,JSONPath=`.spec.enabled`
+// +kubebuilder:printcolumn:name="Ready",type=boolean,JSONPath=`.status.ready`
+// +kubebuilder:printcolumn:name="Last-Updated",type=date,JSONPath=`.status.lastUpdated`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type NamespaceQuota struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NamespaceQuotaSpec   `json:"spec"`
+	Status NamespaceQuotaStatus `json:"status,omitempty"`
+}
+
+// NamespaceQuotaSpec defines the desired state
+type NamespaceQuotaSpec struct {
+	// Namespace is the target Kubernetes namespace
+	Namespace string `json:"namespace"`
+
+	// CPU limit as a quantity (e.g., "4" for 4 cores, "500m" for half a core)
+	CPU string `json:"cpu,omitempty"`
+
+	// CPUFromConfigMapKeyRef reads the CPU limit from a key of a ConfigMap in
+	// the target namespace. Cannot be combined with CPU.
+	CPUFromConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"cpuFromConfigMapKeyRef,omitempty"`
+
+	// CPUWeight is the relative CPU share under contention (1-10000, systemd
+	// CPUWeight). It is independent of the hard CPU quota; zero leaves it unset.
+	CPUWeight int64 `json:"cpuWeight,omitempty"`
+
+	// CPUSet pins all pods of the namespace to these CPUs (Linux cpuset
+	// format, e.g. "0-3,8-11")
+	CPUSet string `json:"cpuSet,omitempty"`
+
+	// Memory limit as a quantity (e.g., "8Gi", "512Mi", "1.5Gi")
+	Memory string `json:"memory,omitempty"`
+
+	// MemoryFromConfigMapKeyRef reads the memory limit from a key of a
+	// ConfigMap in the target namespace. Cannot be combined with Memory.
+	MemoryFromConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"memoryFromConfigMapKeyRef,omitempty"`
+
+	// MemoryMin is memory guaranteed to the namespace and never reclaimed
+	// (cgroup memory.min). Must not exceed MemoryLow or Memory.
+	MemoryMin string `json:"memoryMin,omitempty"`
+
+	// MemoryLow is best-effort protected memory, reclaimed only under global
+	// pressure (cgroup memory.low). Must not exceed Memory.
+	MemoryLow string `json:"memoryLow,omitempty"`
+
+	// MemoryHigh is a throttle limit (cgroup memory.high): above it the
+	// namespace is slowed down and reclaimed aggressively, but never OOM
+	// killed. Memory is the hard limit that triggers the OOM killer and must
+	// be greater than MemoryHigh when both are set.
+	MemoryHigh string `json:"memoryHigh,omitempty"`
+
+	// HugepagesLimits limits the hugepages of each size (e.g. "2Mi", "1Gi")
+	// the namespace may use (cgroup hugetlb.<size>.max). Hugepages are not
+	// counted in Memory. Each size must be supported by the node.
+	HugepagesLimits map[string]string `json:"hugepagesLimits,omitempty"`
+
+	// NodeSelector restricts the quota to nodes whose labels match all of
+	// these key/value pairs. An empty selector applies on every node.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// OOMGroup makes an OOM kill inside the namespace kill all of its
+	// processes together (cgroup memory.oom.group) instead of one process.
+	OOMGroup *bool `json:"oomGroup,omitempty"`
+
+	// CPUIdle runs the namespace as background work (cgroup cpu.idle): it
+	// only gets CPU time nothing else wants. Cannot be combined with CPU or
+	// CPUWeight.
+	CPUIdle *bool `json:"cpuIdle,omitempty"`
+
+	// PriorityClass names a scheduling.k8s.io PriorityClass whose value sets
+	// the CPUWeight of the namespace, so higher-priority namespaces get more
+	// CPU under contention. Cannot be combined with CPUWeight or CPUIdle.
+	PriorityClass string `json:"priorityClass,omitempty"`
+
+	// RawAttributes are written as-is to the cgroup files of the namespace
+	// slice (e.g. "memory.zswap.max": "0"), for settings without a field.
+	// Each attribute must be allowed by the agent's
+	// --allowed-cgroup-attributes.
+	RawAttributes map[string]string `json:"rawAttributes,omitempty"`
+
+	// Enabled controls if quota is enforced
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// NamespaceQuotaStatus defines the observed state
+type NamespaceQuotaStatus struct {
+	// Ready indicates if the cgroup is configured
+	Ready bool `json:"ready,omitempty"`
+
+	// Message provides additional details
+	Message string `json:"message,omitempty"`
+
+	// LastUpdated timestamp
+	LastUpdated *metav1.Time `json:"lastUpdated,omitempty"`
+
+	// Conditions describe the observed state in detail (CgroupReady, SpecValid, SystemdReachable)
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// IsEnabled returns true if the quota is enabled (defaults to true)
+func (q *NamespaceQuota) IsEnabled() bool {
+	if q.Spec.Enabled == nil {
+		return true
+	}
+	return *q.Spec.Enabled
+}
+
+// NamespaceQuotaList is a list of NamespaceQuota
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type NamespaceQuotaList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []NamespaceQuota `json:"items"`
+}
@@ -2,18 +2,24 @@ package plugin
 
 import (
 	"context"
+	"fmt"
+	"reflect"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/api/v1alpha1"
 )
 
 var NamespaceQuotaGVR = schema.GroupVersionResource{
@@ -22,19 +28,62 @@ var NamespaceQuotaGVR = schema.GroupVersionResource{
 	Resource: "namespacequotas",
 }
 
-// QuotaCache maintains an in-memory map of namespaces with active quotas,
-// synchronized via a Kubernetes informer watching NamespaceQuota resources.
+var nodeGVR = schema.GroupVersionResource{Version: "v1", Resource: "nodes"}
+
+// quotaEventBuffer is the capacity of the Events channel
+const quotaEventBuffer = 100
+
+// NamespaceQuotaEventType is the kind of change reported by a NamespaceQuotaEvent
+type NamespaceQuotaEventType string
+
+const (
+	QuotaAdded   NamespaceQuotaEventType = "Added"
+	QuotaUpdated NamespaceQuotaEventType = "Updated"
+	QuotaDeleted NamespaceQuotaEventType = "Deleted"
+)
+
+// NamespaceQuotaEvent reports a change to the enabled quota of a namespace. A
+// quota that gets disabled is reported as deleted. Spec is the new spec, or
+// the last known one for QuotaDeleted.
+type NamespaceQuotaEvent struct {
+	Namespace string
+	Type      NamespaceQuotaEventType
+	Spec      v1alpha1.NamespaceQuotaSpec
+}
+
+// QuotaCache maintains an in-memory map of the specs of enabled quotas keyed
+// by target namespace, synchronized via a Kubernetes informer watching
+// NamespaceQuota resources. Quotas whose nodeSelector does not match the
+// labels of the node are left out, as if they were disabled.
 type QuotaCache struct {
-	mu     sync.RWMutex
-	quotas map[string]bool
+	mu    sync.RWMutex
+	specs map[string]v1alpha1.NamespaceQuotaSpec
+	// nodeLabels are the labels of the node, guarded by mu
+	nodeLabels labels.Set
 
 	client   dynamic.Interface
 	informer cache.SharedIndexInformer
-	stopCh   chan struct{}
-	log      *logrus.Entry
+	// nodeInformer watches the node alone, for its labels
+	nodeInformer cache.SharedIndexInformer
+	// nodeName is the node nodeSelectors are matched against; quotas with a
+	// nodeSelector are left out if it is empty
+	nodeName string
+	// labelSelector restricts the cached quotas; empty caches them all
+	labelSelector string
+	stopCh        chan struct{}
+	log           *logrus.Entry
+
+	// events receives every change to the cached specs, sent outside the lock
+	events chan NamespaceQuotaEvent
 }
 
-func NewQuotaCache(kubeconfig string, log *logrus.Entry) (*QuotaCache, error) {
+// NewQuotaCache builds a cache of the NamespaceQuotas matching labelSelector,
+// or of every NamespaceQuota if it is empty, that select the node nodeName
+func NewQuotaCache(kubeconfig string, resyncPeriod time.Duration, labelSelector, nodeName string, log *logrus.Entry) (*QuotaCache, error) {
+	if _, err := labels.Parse(labelSelector); err != nil {
+		return nil, fmt.Errorf("invalid label selector %q: %w", labelSelector, err)
+	}
+
 	var config *rest.Config
 	var err error
 
@@ -53,13 +102,19 @@ func NewQuotaCache(kubeconfig string, log *logrus.Entry) (*QuotaCache, error) {
 	}
 
 	qc := &QuotaCache{
-		quotas: make(map[string]bool),
-		client: dynamicClient,
-		stopCh: make(chan struct{}),
-		log:    log.WithField("component", "cache"),
+		specs:         make(map[string]v1alpha1.NamespaceQuotaSpec),
+		client:        dynamicClient,
+		labelSelector: labelSelector,
+		nodeName:      nodeName,
+		stopCh:        make(chan struct{}),
+		events:        make(chan NamespaceQuotaEvent, quotaEventBuffer),
+		log:           log.WithField("component", "cache"),
 	}
 
-	factory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 30*time.Second)
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, resyncPeriod, metav1.NamespaceAll,
+		func(options *metav1.ListOptions) {
+			options.LabelSelector = labelSelector
+		})
 	qc.informer = factory.ForResource(NamespaceQuotaGVR).Informer()
 
 	_, err = qc.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -71,49 +126,145 @@ func NewQuotaCache(kubeconfig string, log *logrus.Entry) (*QuotaCache, error) {
 		return nil, err
 	}
 
+	// The quota informer resyncs every resyncPeriod, which matches the
+	// quotas again against labels changed meanwhile
+	nodeFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, resyncPeriod, metav1.NamespaceAll,
+		func(options *metav1.ListOptions) {
+			options.FieldSelector = "metadata.name=" + nodeName
+		})
+	qc.nodeInformer = nodeFactory.ForResource(nodeGVR).Informer()
+
+	_, err = qc.nodeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    qc.onNode,
+		UpdateFunc: func(_, newObj interface{}) { qc.onNode(newObj) },
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return qc, nil
 }
 
+// Events returns the changes to the cached quotas. Quotas loaded by the
+// initial sync are not reported. The channel must be drained while the cache
+// runs, as a full channel blocks the informer.
+func (qc *QuotaCache) Events() <-chan NamespaceQuotaEvent {
+	return qc.events
+}
+
+func (qc *QuotaCache) emit(event NamespaceQuotaEvent) {
+	select {
+	case qc.events <- event:
+	case <-qc.stopCh:
+	}
+}
+
 func (qc *QuotaCache) Start(ctx context.Context) error {
 	qc.log.Info("Starting quota cache")
 
+	if qc.nodeName == "" {
+		qc.log.Warn("Node name is not set, ignoring quotas with a nodeSelector")
+	} else if node, err := qc.client.Resource(nodeGVR).Get(ctx, qc.nodeName, metav1.GetOptions{}); err != nil {
+		qc.log.WithError(err).WithField("node", qc.nodeName).Warn("Failed to get node, ignoring quotas with a nodeSelector until it is synced")
+	} else {
+		qc.onNode(node)
+	}
+
 	if err := qc.initialSync(); err != nil {
 		qc.log.WithError(err).Warn("Initial sync failed, continuing with empty cache")
 	}
 
 	go qc.informer.Run(qc.stopCh)
-
-	if !cache.WaitForCacheSync(ctx.Done(), qc.informer.HasSynced) {
-		qc.log.Warn("Cache sync timed out")
+	if qc.nodeName != "" {
+		go qc.nodeInformer.Run(qc.stopCh)
 	}
 
 	return nil
 }
 
+// WaitForSync blocks until the informer has completed its initial list. It
+// returns an error if ctx is done first, e.g. when its deadline passes.
+func (qc *QuotaCache) WaitForSync(ctx context.Context) error {
+	if !cache.WaitForCacheSync(ctx.Done(), qc.HasSynced) {
+		return fmt.Errorf("failed to sync quota cache: %w", ctx.Err())
+	}
+	qc.log.Info("Quota cache synced")
+	return nil
+}
+
 func (qc *QuotaCache) Stop() {
 	qc.log.Debug("Stopping quota cache")
 	close(qc.stopCh)
 }
 
+// HasSynced reports whether the informers have completed their initial list
+func (qc *QuotaCache) HasSynced() bool {
+	if qc.nodeName != "" && !qc.nodeInformer.HasSynced() {
+		return false
+	}
+	return qc.informer.HasSynced()
+}
+
 func (qc *QuotaCache) HasQuota(namespace string) bool {
 	qc.mu.RLock()
 	defer qc.mu.RUnlock()
-	return qc.quotas[namespace]
+	_, ok := qc.specs[namespace]
+	return ok
+}
+
+// GetSpec returns the spec of the enabled quota targeting the namespace
+func (qc *QuotaCache) GetSpec(namespace string) (v1alpha1.NamespaceQuotaSpec, bool) {
+	qc.mu.RLock()
+	defer qc.mu.RUnlock()
+	spec, ok := qc.specs[namespace]
+	return spec, ok
+}
+
+// GetCPUSet returns the cpuset configured for the namespace, or "" if none
+func (qc *QuotaCache) GetCPUSet(namespace string) string {
+	qc.mu.RLock()
+	defer qc.mu.RUnlock()
+	return qc.specs[namespace].CPUSet
 }
 
 func (qc *QuotaCache) GetNamespaces() []string {
 	qc.mu.RLock()
 	defer qc.mu.RUnlock()
 
-	namespaces := make([]string, 0, len(qc.quotas))
-	for ns := range qc.quotas {
+	namespaces := make([]string, 0, len(qc.specs))
+	for ns := range qc.specs {
 		namespaces = append(namespaces, ns)
 	}
 	return namespaces
 }
 
+// Snapshot returns the namespaces with a quota as of a single point in time
+func (qc *QuotaCache) Snapshot() map[string]bool {
+	qc.mu.RLock()
+	defer qc.mu.RUnlock()
+
+	snapshot := make(map[string]bool, len(qc.specs))
+	for ns := range qc.specs {
+		snapshot[ns] = true
+	}
+	return snapshot
+}
+
+// SnapshotSpecs returns a deep copy of the cached specs, keyed by namespace,
+// as of a single point in time
+func (qc *QuotaCache) SnapshotSpecs() map[string]v1alpha1.NamespaceQuotaSpec {
+	qc.mu.RLock()
+	defer qc.mu.RUnlock()
+
+	snapshot := make(map[string]v1alpha1.NamespaceQuotaSpec, len(qc.specs))
+	for ns, spec := range qc.specs {
+		snapshot[ns] = *spec.DeepCopy()
+	}
+	return snapshot
+}
+
 func (qc *QuotaCache) initialSync() error {
-	list, err := qc.client.Resource(NamespaceQuotaGVR).List(context.Background(), metav1.ListOptions{})
+	list, err := qc.client.Resource(NamespaceQuotaGVR).List(context.Background(), metav1.ListOptions{LabelSelector: qc.labelSelector})
 	if err != nil {
 		return err
 	}
@@ -123,12 +274,15 @@ func (qc *QuotaCache) initialSync() error {
 
 	for _, item := range list.Items {
 		ns := qc.extractNamespace(&item)
-		if ns != "" && qc.isEnabled(&item) {
-			qc.quotas[ns] = true
+		if ns == "" || !qc.isEnabled(&item) {
+			continue
+		}
+		if spec := qc.extractSpec(&item); qc.selectsNode(spec) {
+			qc.specs[ns] = spec
 		}
 	}
 
-	qc.log.WithField("count", len(qc.quotas)).Info("Initial sync complete")
+	qc.log.WithField("count", len(qc.specs)).Info("Initial sync complete")
 	return nil
 }
 
@@ -143,10 +297,25 @@ func (qc *QuotaCache) onAdd(obj interface{}) {
 		return
 	}
 
+	spec := qc.extractSpec(u)
+
 	qc.mu.Lock()
-	qc.quotas[ns] = true
+	if !qc.selectsNode(spec) {
+		qc.mu.Unlock()
+		return
+	}
+	old, existed := qc.specs[ns]
+	qc.specs[ns] = spec
 	qc.mu.Unlock()
 
+	// The informer adds again the quotas loaded by the initial sync
+	switch {
+	case !existed:
+		qc.emit(NamespaceQuotaEvent{Namespace: ns, Type: QuotaAdded, Spec: spec})
+	case !reflect.DeepEqual(old, spec):
+		qc.emit(NamespaceQuotaEvent{Namespace: ns, Type: QuotaUpdated, Spec: spec})
+	}
+
 	qc.log.WithField("namespace", ns).Info("Quota added")
 }
 
@@ -163,14 +332,30 @@ func (qc *QuotaCache) onUpdate(_, newObj interface{}) {
 
 	enabled := qc.isEnabled(u)
 
+	var spec v1alpha1.NamespaceQuotaSpec
+
 	qc.mu.Lock()
+	old, existed := qc.specs[ns]
+	if enabled {
+		spec = qc.extractSpec(u)
+		enabled = qc.selectsNode(spec)
+	}
 	if enabled {
-		qc.quotas[ns] = true
+		qc.specs[ns] = spec
 	} else {
-		delete(qc.quotas, ns)
+		delete(qc.specs, ns)
 	}
 	qc.mu.Unlock()
 
+	switch {
+	case enabled && !existed:
+		qc.emit(NamespaceQuotaEvent{Namespace: ns, Type: QuotaAdded, Spec: spec})
+	case enabled && !reflect.DeepEqual(old, spec):
+		qc.emit(NamespaceQuotaEvent{Namespace: ns, Type: QuotaUpdated, Spec: spec})
+	case !enabled && existed:
+		qc.emit(NamespaceQuotaEvent{Namespace: ns, Type: QuotaDeleted, Spec: old})
+	}
+
 	qc.log.WithFields(logrus.Fields{
 		"namespace": ns,
 		"enabled":   enabled,
@@ -196,12 +381,41 @@ func (qc *QuotaCache) onDelete(obj interface{}) {
 	}
 
 	qc.mu.Lock()
-	delete(qc.quotas, ns)
+	old, existed := qc.specs[ns]
+	delete(qc.specs, ns)
 	qc.mu.Unlock()
 
+	if existed {
+		qc.emit(NamespaceQuotaEvent{Namespace: ns, Type: QuotaDeleted, Spec: old})
+	}
+
 	qc.log.WithField("namespace", ns).Info("Quota removed")
 }
 
+// onNode records the labels of the node
+func (qc *QuotaCache) onNode(obj interface{}) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	qc.mu.Lock()
+	qc.nodeLabels = labels.Set(u.GetLabels())
+	qc.mu.Unlock()
+}
+
+// selectsNode reports whether the nodeSelector of spec matches the labels of
+// the node. qc.mu must be held.
+func (qc *QuotaCache) selectsNode(spec v1alpha1.NamespaceQuotaSpec) bool {
+	if len(spec.NodeSelector) == 0 {
+		return true
+	}
+	if qc.nodeName == "" || qc.nodeLabels == nil {
+		return false
+	}
+	return labels.SelectorFromSet(spec.NodeSelector).Matches(qc.nodeLabels)
+}
+
 func (qc *QuotaCache) extractNamespace(u *unstructured.Unstructured) string {
 	spec, found, err := unstructured.NestedMap(u.Object, "spec")
 	if err != nil || !found {
@@ -216,6 +430,23 @@ func (qc *QuotaCache) extractNamespace(u *unstructured.Unstructured) string {
 	return ns
 }
 
+// extractSpec converts the unstructured spec, keeping the target namespace
+// even if other fields fail to convert.
+func (qc *QuotaCache) extractSpec(u *unstructured.Unstructured) v1alpha1.NamespaceQuotaSpec {
+	spec := v1alpha1.NamespaceQuotaSpec{Namespace: qc.extractNamespace(u)}
+
+	raw, found, err := unstructured.NestedMap(u.Object, "spec")
+	if err != nil || !found {
+		return spec
+	}
+
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &spec); err != nil {
+		qc.log.WithError(err).WithField("name", u.GetName()).Warn("Failed to convert quota spec")
+		return v1alpha1.NamespaceQuotaSpec{Namespace: qc.extractNamespace(u)}
+	}
+	return spec
+}
+
 func (qc *QuotaCache) isEnabled(u *unstructured.Unstructured) bool {
 	spec, found, err := unstructured.NestedMap(u.Object, "spec")
 	if err != nil || !found {
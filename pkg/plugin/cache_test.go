@@ -0,0 +1,131 @@
+package plugin
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/api/v1alpha1"
+)
+
+// newTestQuotaCache returns a cache of the node nodeName fed by calling its
+// event handlers directly
+func newTestQuotaCache(nodeName string) *QuotaCache {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	return &QuotaCache{
+		specs:    map[string]v1alpha1.NamespaceQuotaSpec{},
+		nodeName: nodeName,
+		stopCh:   make(chan struct{}),
+		events:   make(chan NamespaceQuotaEvent, quotaEventBuffer),
+		log:      logrus.NewEntry(log),
+	}
+}
+
+func newTestNode(name string, nodeLabels map[string]string) *unstructured.Unstructured {
+	node := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Node",
+	}}
+	node.SetName(name)
+	node.SetLabels(nodeLabels)
+	return node
+}
+
+func newUnstructuredQuota(name, namespace string, nodeSelector map[string]interface{}) *unstructured.Unstructured {
+	spec := map[string]interface{}{"namespace": namespace, "cpu": "1"}
+	if nodeSelector != nil {
+		spec["nodeSelector"] = nodeSelector
+	}
+	quota := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "brasa.cloud/v1alpha1",
+		"kind":       "NamespaceQuota",
+		"spec":       spec,
+	}}
+	quota.SetName(name)
+	return quota
+}
+
+// drainEvents returns the events emitted so far
+func drainEvents(qc *QuotaCache) []NamespaceQuotaEvent {
+	var events []NamespaceQuotaEvent
+	for {
+		select {
+		case event := <-qc.events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestQuotaCacheNodeSelector(t *testing.T) {
+	qc := newTestQuotaCache("node-a")
+	qc.onNode(newTestNode("node-a", map[string]string{"pool": "gpu"}))
+
+	quotas := []*unstructured.Unstructured{
+		newUnstructuredQuota("quota-gpu", "team-gpu", map[string]interface{}{"pool": "gpu"}),
+		newUnstructuredQuota("quota-cpu", "team-cpu", map[string]interface{}{"pool": "cpu"}),
+		newUnstructuredQuota("quota-all", "team-all", nil),
+	}
+	for _, quota := range quotas {
+		qc.onAdd(quota)
+	}
+
+	for ns, want := range map[string]bool{"team-gpu": true, "team-cpu": false, "team-all": true} {
+		if _, ok := qc.GetSpec(ns); ok != want {
+			t.Errorf("GetSpec(%s) found = %v, want %v", ns, ok, want)
+		}
+	}
+	if events := drainEvents(qc); len(events) != 2 {
+		t.Errorf("events = %v, want two QuotaAdded", events)
+	}
+
+	m := NewCgroupRoutingMiddleware(qc, true, 100000, qc.log)
+	pod := &api.PodSandbox{Id: "pod-a", Name: "pod-a", Namespace: "team-cpu"}
+	adjust, _, err := m.CreateContainer(context.Background(), pod, newTestContainer("c1", 0, 0, 0), nil)
+	if err != nil || adjust != nil {
+		t.Errorf("CreateContainer() in a namespace whose quota selects other nodes = %v, %v, want no adjustment", adjust, err)
+	}
+
+	// The node is relabelled and the informer resyncs the quotas
+	qc.onNode(newTestNode("node-a", map[string]string{"pool": "cpu"}))
+	for _, quota := range quotas {
+		qc.onUpdate(quota, quota)
+	}
+
+	if _, ok := qc.GetSpec("team-gpu"); ok {
+		t.Error("quota selecting the old labels is still cached")
+	}
+	if _, ok := qc.GetSpec("team-cpu"); !ok {
+		t.Error("quota selecting the new labels is not cached")
+	}
+	want := map[string]NamespaceQuotaEventType{"team-gpu": QuotaDeleted, "team-cpu": QuotaAdded}
+	events := drainEvents(qc)
+	if len(events) != len(want) {
+		t.Fatalf("events after relabelling = %v, want %v", events, want)
+	}
+	for _, event := range events {
+		if want[event.Namespace] != event.Type {
+			t.Errorf("event %s %s, want %s", event.Namespace, event.Type, want[event.Namespace])
+		}
+	}
+}
+
+func TestQuotaCacheNodeSelectorWithoutNodeName(t *testing.T) {
+	qc := newTestQuotaCache("")
+	qc.onAdd(newUnstructuredQuota("quota-gpu", "team-gpu", map[string]interface{}{"pool": "gpu"}))
+	qc.onAdd(newUnstructuredQuota("quota-all", "team-all", nil))
+
+	if _, ok := qc.GetSpec("team-gpu"); ok {
+		t.Error("quota with a nodeSelector is cached without a node name")
+	}
+	if _, ok := qc.GetSpec("team-all"); !ok {
+		t.Error("quota without a nodeSelector is not cached")
+	}
+}
@@ -0,0 +1,197 @@
+package plugin
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/agent"
+)
+
+// PluginConfig mirrors the nri-plugin command-line flags so they can also be
+// read from a YAML file (--config-file).
+type PluginConfig struct {
+	Name            string `json:"name,omitempty"`
+	Idx             string `json:"idx,omitempty"`
+	Kubeconfig      string `json:"kubeconfig,omitempty"`
+	NodeName        string `json:"nodeName,omitempty"`
+	NRISocket       string `json:"nriSocket,omitempty"`
+	LogLevel        string `json:"logLevel,omitempty"`
+	LogFormat       string `json:"logFormat,omitempty"`
+	LogCaller       bool   `json:"logCaller,omitempty"`
+	LogOutput       string `json:"logOutput,omitempty"`
+	MetricsAddr     string `json:"metricsAddr,omitempty"`
+	SetOCIResources bool   `json:"setOCIResources,omitempty"`
+	CPUPeriod       int64  `json:"cpuPeriod,omitempty"`
+	PreWarmCgroups  bool   `json:"preWarmCgroups,omitempty"`
+	AgentURL        string `json:"agentURL,omitempty"`
+
+	AgentAuthUser         string `json:"agentAuthUser,omitempty"`
+	AgentAuthPasswordFile string `json:"agentAuthPasswordFile,omitempty"`
+	AgentCAFile           string `json:"agentCAFile,omitempty"`
+
+	CacheSyncTimeout  metav1.Duration `json:"cacheSyncTimeout,omitempty"`
+	CacheResyncPeriod metav1.Duration `json:"cacheResyncPeriod,omitempty"`
+	LabelSelector     string          `json:"labelSelector,omitempty"`
+
+	ReconnectInitialDelay metav1.Duration `json:"reconnectInitialDelay,omitempty"`
+	ReconnectMaxDelay     metav1.Duration `json:"reconnectMaxDelay,omitempty"`
+	ReconnectMaxAttempts  int             `json:"reconnectMaxAttempts"`
+}
+
+// DefaultPluginConfig returns the configuration used when neither a flag nor
+// the config file sets a value.
+func DefaultPluginConfig() PluginConfig {
+	return PluginConfig{
+		Name:            DefaultPluginName,
+		Idx:             DefaultPluginIdx,
+		NodeName:        os.Getenv("NODE_NAME"),
+		LogLevel:        "info",
+		LogFormat:       "json",
+		LogOutput:       agent.LogOutputStderr,
+		MetricsAddr:     DefaultMetricsAddr,
+		SetOCIResources: true,
+		CPUPeriod:       agent.DefaultCPUPeriod,
+
+		CacheSyncTimeout:  metav1.Duration{Duration: DefaultCacheSyncTimeout},
+		CacheResyncPeriod: metav1.Duration{Duration: DefaultCacheResyncPeriod},
+
+		ReconnectInitialDelay: metav1.Duration{Duration: DefaultReconnectInitialDelay},
+		ReconnectMaxDelay:     metav1.Duration{Duration: DefaultReconnectMaxDelay},
+		ReconnectMaxAttempts:  -1,
+	}
+}
+
+// BindFlags registers a flag for every field, using the current values as defaults
+func (c *PluginConfig) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Name, "name", c.Name, "NRI plugin name")
+	fs.StringVar(&c.Idx, "idx", c.Idx, "NRI plugin index (determines priority)")
+	fs.StringVar(&c.Kubeconfig, "kubeconfig", c.Kubeconfig, "Path to kubeconfig file (uses in-cluster config if empty)")
+	fs.StringVar(&c.NodeName, "node-name", c.NodeName, "Name of the node the plugin runs on, matched against the nodeSelector of NamespaceQuotas (default $NODE_NAME, else the hostname)")
+	fs.StringVar(&c.NRISocket, "nri-socket", c.NRISocket, "Path of the runtime's NRI socket (detected if empty)")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "Log level (debug, info, warn, error)")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "Log format (json, text)")
+	fs.BoolVar(&c.LogCaller, "log-caller", c.LogCaller, "Include the source file and line of each log entry")
+	fs.StringVar(&c.LogOutput, "log-output", c.LogOutput, "Stream logs are written to (stdout, stderr)")
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", c.MetricsAddr, "Listen address for metrics and health endpoints (empty disables)")
+	fs.BoolVar(&c.SetOCIResources, "set-oci-resources", c.SetOCIResources, "Also set the namespace CPU and memory limits on each container's OCI spec")
+	fs.Int64Var(&c.CPUPeriod, "cpu-period", c.CPUPeriod, "CPU quota period in microseconds of the container CPU limits, as the agent's --cpu-period (1000-1000000)")
+	fs.BoolVar(&c.PreWarmCgroups, "pre-warm-cgroups", c.PreWarmCgroups, "Ask the agent to create the namespace slice when a pod sandbox starts, before its first container")
+	fs.StringVar(&c.AgentURL, "agent-url", c.AgentURL, "URL of the agent metrics server on the same node, used by --pre-warm-cgroups")
+	fs.StringVar(&c.AgentAuthUser, "agent-auth-user", c.AgentAuthUser, "Basic auth user sent to the agent, for an agent started with --metrics-auth-user")
+	fs.StringVar(&c.AgentAuthPasswordFile, "agent-auth-password-file", c.AgentAuthPasswordFile, "File holding the basic auth password sent with --agent-auth-user")
+	fs.StringVar(&c.AgentCAFile, "agent-ca-file", c.AgentCAFile, "PEM CA certificates verifying an agent serving HTTPS (system roots if empty)")
+	fs.DurationVar(&c.CacheSyncTimeout.Duration, "cache-sync-timeout", c.CacheSyncTimeout.Duration, "Time to wait for the NamespaceQuota cache to sync before giving up")
+	fs.DurationVar(&c.CacheResyncPeriod.Duration, "cache-resync-period", c.CacheResyncPeriod.Duration, "Interval at which the NamespaceQuota cache replays every quota as an update (minimum 10s)")
+	fs.StringVar(&c.LabelSelector, "label-selector", c.LabelSelector, "Only cache the NamespaceQuotas matching this label selector (all if empty)")
+	fs.DurationVar(&c.ReconnectInitialDelay.Duration, "reconnect-initial-delay", c.ReconnectInitialDelay.Duration, "Delay before the first attempt to reconnect to the runtime, doubled after each attempt")
+	fs.DurationVar(&c.ReconnectMaxDelay.Duration, "reconnect-max-delay", c.ReconnectMaxDelay.Duration, "Maximum delay between attempts to reconnect to the runtime")
+	fs.IntVar(&c.ReconnectMaxAttempts, "reconnect-max-attempts", c.ReconnectMaxAttempts, "Consecutive failed attempts to connect to the runtime before the plugin exits (-1 retries forever)")
+}
+
+// Validate reports the first invalid setting
+func (c *PluginConfig) Validate() error {
+	if _, err := logrus.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("invalid logLevel: %w", err)
+	}
+	if c.LogFormat != "json" && c.LogFormat != "text" {
+		return fmt.Errorf("invalid logFormat %q: must be json or text", c.LogFormat)
+	}
+	if err := agent.ValidateLogOutput(c.LogOutput); err != nil {
+		return err
+	}
+	if c.CPUPeriod < agent.MinCPUPeriod || c.CPUPeriod > agent.MaxCPUPeriod {
+		return fmt.Errorf("invalid cpuPeriod: must be between %d and %d us, got %d", agent.MinCPUPeriod, agent.MaxCPUPeriod, c.CPUPeriod)
+	}
+	if c.CacheSyncTimeout.Duration <= 0 {
+		return fmt.Errorf("invalid cacheSyncTimeout: must be positive")
+	}
+	if c.CacheResyncPeriod.Duration < agent.MinResyncPeriod {
+		return fmt.Errorf("invalid cacheResyncPeriod: must be at least %s, got %s", agent.MinResyncPeriod, c.CacheResyncPeriod.Duration)
+	}
+	if c.ReconnectInitialDelay.Duration <= 0 {
+		return fmt.Errorf("invalid reconnectInitialDelay: must be positive")
+	}
+	if c.ReconnectMaxDelay.Duration < c.ReconnectInitialDelay.Duration {
+		return fmt.Errorf("invalid reconnectMaxDelay: must be at least reconnectInitialDelay (%s), got %s", c.ReconnectInitialDelay.Duration, c.ReconnectMaxDelay.Duration)
+	}
+	if c.ReconnectMaxAttempts < -1 {
+		return fmt.Errorf("invalid reconnectMaxAttempts %d: must be -1 (unlimited) or more", c.ReconnectMaxAttempts)
+	}
+	if _, err := labels.Parse(c.LabelSelector); err != nil {
+		return fmt.Errorf("invalid labelSelector %q: %w", c.LabelSelector, err)
+	}
+	if c.PreWarmCgroups {
+		u, err := url.Parse(c.AgentURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid agentURL %q: preWarmCgroups requires an http(s) URL", c.AgentURL)
+		}
+	}
+	if (c.AgentAuthUser == "") != (c.AgentAuthPasswordFile == "") {
+		return fmt.Errorf("invalid agentAuthUser: agentAuthUser and agentAuthPasswordFile must be set together")
+	}
+	if c.MetricsAddr != "" {
+		_, port, err := net.SplitHostPort(c.MetricsAddr)
+		if err != nil {
+			return fmt.Errorf("invalid metricsAddr: %w", err)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid metricsAddr: port %q out of range 1-65535", port)
+		}
+	}
+	return nil
+}
+
+// Config returns the settings consumed by New
+func (c *PluginConfig) Config() Config {
+	return Config{
+		Name:            c.Name,
+		Idx:             c.Idx,
+		Kubeconfig:      c.Kubeconfig,
+		NodeName:        c.NodeName,
+		NRISocket:       c.NRISocket,
+		SetOCIResources: c.SetOCIResources,
+		CPUPeriodUs:     c.CPUPeriod,
+		MetricsAddr:     c.MetricsAddr,
+		PreWarmCgroups:  c.PreWarmCgroups,
+		Agent: AgentClientConfig{
+			URL:          c.AgentURL,
+			User:         c.AgentAuthUser,
+			PasswordFile: c.AgentAuthPasswordFile,
+			CAFile:       c.AgentCAFile,
+		},
+
+		CacheSyncTimeout:   c.CacheSyncTimeout.Duration,
+		CacheResyncPeriod:  c.CacheResyncPeriod.Duration,
+		CacheLabelSelector: c.LabelSelector,
+
+		Reconnect: ReconnectConfig{
+			InitialDelay: c.ReconnectInitialDelay.Duration,
+			MaxDelay:     c.ReconnectMaxDelay.Duration,
+			MaxAttempts:  c.ReconnectMaxAttempts,
+		},
+	}
+}
+
+// LoadPluginConfig builds the plugin configuration from the defaults, the
+// YAML file at path and the explicit flags, in increasing order of precedence.
+func LoadPluginConfig(path string, explicit map[string]string) (PluginConfig, error) {
+	cfg := DefaultPluginConfig()
+	fs := flag.NewFlagSet("nri-plugin", flag.ContinueOnError)
+	cfg.BindFlags(fs)
+
+	if err := agent.LoadConfigFile(path, &cfg, fs, explicit); err != nil {
+		return PluginConfig{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return PluginConfig{}, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,79 @@
+package plugin
+
+import (
+	"net/http"
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefaultMetricsAddr is where the plugin serves metrics and health endpoints
+const DefaultMetricsAddr = ":9091"
+
+// registry is separate from the default registry so the plugin does not
+// export the agent metrics it links in.
+var registry = prometheus.NewRegistry()
+
+var synchronizedContainers = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "namespace_quota_synchronized_containers_total",
+		Help: "Running containers updated with their namespace quota during NRI synchronization",
+	},
+)
+
+var trackedContainers = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "namespace_quota_tracked_containers_current",
+		Help: "Containers currently tracked in namespaces with a quota",
+	},
+)
+
+var pluginReconnects = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "namespace_quota_plugin_reconnects_total",
+		Help: "Attempts to reconnect to the runtime after the NRI connection was lost or could not be established",
+	},
+)
+
+var pluginGOMAXPROCS = prometheus.NewGaugeFunc(
+	prometheus.GaugeOpts{
+		Name: "namespace_quota_plugin_gomaxprocs",
+		Help: "Current GOMAXPROCS of the plugin, tuned to the CPU quota of its cgroup",
+	},
+	func() float64 { return float64(runtime.GOMAXPROCS(0)) },
+)
+
+func init() {
+	registry.MustRegister(synchronizedContainers)
+	registry.MustRegister(trackedContainers)
+	registry.MustRegister(pluginReconnects)
+	registry.MustRegister(pluginGOMAXPROCS)
+}
+
+// startMetricsServer serves /metrics, /healthz and /readyz on addr. /readyz
+// succeeds once the quota cache has synced.
+func (p *Plugin) startMetricsServer(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if !p.cache.HasSynced() {
+			http.Error(w, "quota cache not synced", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	p.log.WithField("addr", addr).Info("Starting metrics server")
+
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			p.log.WithError(err).Error("Metrics server error")
+		}
+	}()
+}
@@ -0,0 +1,202 @@
+package plugin
+
+import (
+	"context"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/sirupsen/logrus"
+)
+
+// Handlers for the NRI hooks the plugin subscribes to, with the signatures of
+// the corresponding stub interfaces. A middleware receives the rest of the
+// chain as one of these.
+type (
+	SynchronizeFunc     func(ctx context.Context, pods []*api.PodSandbox, containers []*api.Container) ([]*api.ContainerUpdate, error)
+	PodFunc             func(ctx context.Context, pod *api.PodSandbox) error
+	CreateContainerFunc func(ctx context.Context, pod *api.PodSandbox, container *api.Container) (*api.ContainerAdjustment, []*api.ContainerUpdate, error)
+	StopContainerFunc   func(ctx context.Context, pod *api.PodSandbox, container *api.Container) ([]*api.ContainerUpdate, error)
+	ContainerFunc       func(ctx context.Context, pod *api.PodSandbox, container *api.Container) error
+)
+
+// HookMiddleware handles the NRI hooks of the plugin. Each method gets the
+// next middleware of the chain, which it may call, wrap or skip.
+type HookMiddleware interface {
+	Synchronize(ctx context.Context, pods []*api.PodSandbox, containers []*api.Container, next SynchronizeFunc) ([]*api.ContainerUpdate, error)
+	RunPodSandbox(ctx context.Context, pod *api.PodSandbox, next PodFunc) error
+	RemovePodSandbox(ctx context.Context, pod *api.PodSandbox, next PodFunc) error
+	CreateContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container, next CreateContainerFunc) (*api.ContainerAdjustment, []*api.ContainerUpdate, error)
+	StopContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container, next StopContainerFunc) ([]*api.ContainerUpdate, error)
+	RemoveContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container, next ContainerFunc) error
+}
+
+// Chain runs its middlewares in order, the first one outermost. The hooks
+// after the last middleware do nothing.
+type Chain struct {
+	middlewares []HookMiddleware
+}
+
+func NewChain(middlewares ...HookMiddleware) *Chain {
+	return &Chain{middlewares: middlewares}
+}
+
+func (c *Chain) Synchronize(ctx context.Context, pods []*api.PodSandbox, containers []*api.Container) ([]*api.ContainerUpdate, error) {
+	return c.synchronize(0)(ctx, pods, containers)
+}
+
+func (c *Chain) synchronize(i int) SynchronizeFunc {
+	if i == len(c.middlewares) {
+		return func(context.Context, []*api.PodSandbox, []*api.Container) ([]*api.ContainerUpdate, error) {
+			return nil, nil
+		}
+	}
+	return func(ctx context.Context, pods []*api.PodSandbox, containers []*api.Container) ([]*api.ContainerUpdate, error) {
+		return c.middlewares[i].Synchronize(ctx, pods, containers, c.synchronize(i+1))
+	}
+}
+
+func (c *Chain) RunPodSandbox(ctx context.Context, pod *api.PodSandbox) error {
+	return c.runPodSandbox(0)(ctx, pod)
+}
+
+func (c *Chain) runPodSandbox(i int) PodFunc {
+	if i == len(c.middlewares) {
+		return func(context.Context, *api.PodSandbox) error { return nil }
+	}
+	return func(ctx context.Context, pod *api.PodSandbox) error {
+		return c.middlewares[i].RunPodSandbox(ctx, pod, c.runPodSandbox(i+1))
+	}
+}
+
+func (c *Chain) RemovePodSandbox(ctx context.Context, pod *api.PodSandbox) error {
+	return c.removePodSandbox(0)(ctx, pod)
+}
+
+func (c *Chain) removePodSandbox(i int) PodFunc {
+	if i == len(c.middlewares) {
+		return func(context.Context, *api.PodSandbox) error { return nil }
+	}
+	return func(ctx context.Context, pod *api.PodSandbox) error {
+		return c.middlewares[i].RemovePodSandbox(ctx, pod, c.removePodSandbox(i+1))
+	}
+}
+
+func (c *Chain) CreateContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container) (*api.ContainerAdjustment, []*api.ContainerUpdate, error) {
+	return c.createContainer(0)(ctx, pod, container)
+}
+
+func (c *Chain) createContainer(i int) CreateContainerFunc {
+	if i == len(c.middlewares) {
+		return func(context.Context, *api.PodSandbox, *api.Container) (*api.ContainerAdjustment, []*api.ContainerUpdate, error) {
+			return nil, nil, nil
+		}
+	}
+	return func(ctx context.Context, pod *api.PodSandbox, container *api.Container) (*api.ContainerAdjustment, []*api.ContainerUpdate, error) {
+		return c.middlewares[i].CreateContainer(ctx, pod, container, c.createContainer(i+1))
+	}
+}
+
+func (c *Chain) StopContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container) ([]*api.ContainerUpdate, error) {
+	return c.stopContainer(0)(ctx, pod, container)
+}
+
+func (c *Chain) stopContainer(i int) StopContainerFunc {
+	if i == len(c.middlewares) {
+		return func(context.Context, *api.PodSandbox, *api.Container) ([]*api.ContainerUpdate, error) {
+			return nil, nil
+		}
+	}
+	return func(ctx context.Context, pod *api.PodSandbox, container *api.Container) ([]*api.ContainerUpdate, error) {
+		return c.middlewares[i].StopContainer(ctx, pod, container, c.stopContainer(i+1))
+	}
+}
+
+func (c *Chain) RemoveContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container) error {
+	return c.removeContainer(0)(ctx, pod, container)
+}
+
+func (c *Chain) removeContainer(i int) ContainerFunc {
+	if i == len(c.middlewares) {
+		return func(context.Context, *api.PodSandbox, *api.Container) error { return nil }
+	}
+	return func(ctx context.Context, pod *api.PodSandbox, container *api.Container) error {
+		return c.middlewares[i].RemoveContainer(ctx, pod, container, c.removeContainer(i+1))
+	}
+}
+
+// LoggingMiddleware logs every hook invocation with the time the rest of the
+// chain took to handle it.
+type LoggingMiddleware struct {
+	log *logrus.Entry
+}
+
+func NewLoggingMiddleware(log *logrus.Entry) *LoggingMiddleware {
+	return &LoggingMiddleware{log: log}
+}
+
+func (m *LoggingMiddleware) logHook(hook string, start time.Time, fields logrus.Fields, err error) {
+	log := m.log.WithFields(fields).WithFields(logrus.Fields{
+		"hook":     hook,
+		"duration": time.Since(start),
+	})
+	if err != nil {
+		log.WithError(err).Warn("NRI hook failed")
+		return
+	}
+	log.Debug("NRI hook handled")
+}
+
+func podFields(pod *api.PodSandbox) logrus.Fields {
+	return logrus.Fields{
+		"pod":       pod.GetName(),
+		"namespace": pod.GetNamespace(),
+	}
+}
+
+func containerFields(pod *api.PodSandbox, container *api.Container) logrus.Fields {
+	fields := podFields(pod)
+	fields["container"] = container.GetName()
+	return fields
+}
+
+func (m *LoggingMiddleware) Synchronize(ctx context.Context, pods []*api.PodSandbox, containers []*api.Container, next SynchronizeFunc) ([]*api.ContainerUpdate, error) {
+	start := time.Now()
+	updates, err := next(ctx, pods, containers)
+	m.logHook("Synchronize", start, logrus.Fields{"pods": len(pods), "containers": len(containers)}, err)
+	return updates, err
+}
+
+func (m *LoggingMiddleware) RunPodSandbox(ctx context.Context, pod *api.PodSandbox, next PodFunc) error {
+	start := time.Now()
+	err := next(ctx, pod)
+	m.logHook("RunPodSandbox", start, podFields(pod), err)
+	return err
+}
+
+func (m *LoggingMiddleware) RemovePodSandbox(ctx context.Context, pod *api.PodSandbox, next PodFunc) error {
+	start := time.Now()
+	err := next(ctx, pod)
+	m.logHook("RemovePodSandbox", start, podFields(pod), err)
+	return err
+}
+
+func (m *LoggingMiddleware) CreateContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container, next CreateContainerFunc) (*api.ContainerAdjustment, []*api.ContainerUpdate, error) {
+	start := time.Now()
+	adjust, updates, err := next(ctx, pod, container)
+	m.logHook("CreateContainer", start, containerFields(pod, container), err)
+	return adjust, updates, err
+}
+
+func (m *LoggingMiddleware) StopContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container, next StopContainerFunc) ([]*api.ContainerUpdate, error) {
+	start := time.Now()
+	updates, err := next(ctx, pod, container)
+	m.logHook("StopContainer", start, containerFields(pod, container), err)
+	return updates, err
+}
+
+func (m *LoggingMiddleware) RemoveContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container, next ContainerFunc) error {
+	start := time.Now()
+	err := next(ctx, pod, container)
+	m.logHook("RemoveContainer", start, containerFields(pod, container), err)
+	return err
+}
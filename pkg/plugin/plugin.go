@@ -2,16 +2,28 @@ package plugin
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
 
 	"github.com/containerd/nri/pkg/api"
 	"github.com/containerd/nri/pkg/stub"
 	"github.com/sirupsen/logrus"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/agent"
 )
 
 const (
 	DefaultPluginName = "namespace-isolator"
 	DefaultPluginIdx  = "10"
+
+	DefaultCacheSyncTimeout  = 30 * time.Second
+	DefaultCacheResyncPeriod = 30 * time.Second
+
+	DefaultReconnectInitialDelay = time.Second
+	DefaultReconnectMaxDelay     = time.Minute
 )
 
 type Plugin struct {
@@ -20,12 +32,73 @@ type Plugin struct {
 	log   *logrus.Entry
 	name  string
 	idx   string
+
+	metricsAddr      string
+	cacheSyncTimeout time.Duration
+
+	// stubOpts create a new stub when the connection to the runtime is lost
+	stubOpts  []stub.Option
+	reconnect ReconnectConfig
+	// connected is set once the runtime configures the current stub
+	connected atomic.Bool
+
+	// hooks handles the NRI hooks below Configure
+	hooks *Chain
+	// routing also receives the quota changes of the cache
+	routing *CgroupRoutingMiddleware
 }
 
 type Config struct {
 	Name       string
 	Idx        string
 	Kubeconfig string
+
+	// NodeName is the node matched against the nodeSelector of quotas;
+	// empty uses the hostname.
+	NodeName string
+
+	// NRISocket is the runtime's NRI socket; empty detects it with
+	// DetectNRISocketPath, falling back to the NRI library default.
+	NRISocket string
+
+	// SetOCIResources also writes the namespace CPU and memory limits into
+	// each container's OCI spec, so containers stay bounded even before the
+	// agent has configured the slice.
+	SetOCIResources bool
+	// CPUPeriodUs is the CPU quota period of those limits, which should match
+	// the agent's; zero uses agent.DefaultCPUPeriod.
+	CPUPeriodUs int64
+
+	// MetricsAddr is the listen address for /metrics and the health
+	// endpoints; empty disables the server.
+	MetricsAddr string
+
+	// CacheSyncTimeout bounds the wait for the initial quota list before
+	// serving NRI requests; zero uses DefaultCacheSyncTimeout.
+	CacheSyncTimeout time.Duration
+	// CacheResyncPeriod is the quota informer resync interval; zero uses
+	// DefaultCacheResyncPeriod.
+	CacheResyncPeriod time.Duration
+	// CacheLabelSelector restricts the cached NamespaceQuotas to those
+	// matching it; empty caches them all.
+	CacheLabelSelector string
+
+	// PreWarmCgroups asks the agent to create the namespace slice when a pod
+	// sandbox of a namespace with a quota starts.
+	PreWarmCgroups bool
+	Agent          AgentClientConfig
+
+	Reconnect ReconnectConfig
+}
+
+// ReconnectConfig controls how Run reconnects to the runtime when the NRI
+// connection is lost or cannot be established. The delay starts at
+// InitialDelay and doubles up to MaxDelay; Run gives up after MaxAttempts
+// consecutive attempts that do not connect (negative retries forever).
+type ReconnectConfig struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	MaxAttempts  int
 }
 
 func New(cfg Config, log *logrus.Logger) (*Plugin, error) {
@@ -35,46 +108,126 @@ func New(cfg Config, log *logrus.Logger) (*Plugin, error) {
 	if cfg.Idx == "" {
 		cfg.Idx = DefaultPluginIdx
 	}
+	if cfg.CPUPeriodUs <= 0 {
+		cfg.CPUPeriodUs = agent.DefaultCPUPeriod
+	}
+	if cfg.CacheSyncTimeout <= 0 {
+		cfg.CacheSyncTimeout = DefaultCacheSyncTimeout
+	}
+	if cfg.CacheResyncPeriod <= 0 {
+		cfg.CacheResyncPeriod = DefaultCacheResyncPeriod
+	}
+	if cfg.Reconnect.InitialDelay <= 0 {
+		cfg.Reconnect.InitialDelay = DefaultReconnectInitialDelay
+	}
+	if cfg.Reconnect.MaxDelay < cfg.Reconnect.InitialDelay {
+		cfg.Reconnect.MaxDelay = max(DefaultReconnectMaxDelay, cfg.Reconnect.InitialDelay)
+	}
+
+	if cfg.NodeName == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine node name: %w", err)
+		}
+		cfg.NodeName = hostname
+	}
 
 	pluginLog := log.WithField("plugin", cfg.Name)
 
-	cache, err := NewQuotaCache(cfg.Kubeconfig, pluginLog)
+	cache, err := NewQuotaCache(cfg.Kubeconfig, cfg.CacheResyncPeriod, cfg.CacheLabelSelector, cfg.NodeName, pluginLog)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create quota cache: %w", err)
 	}
 
+	loggingMW := NewLoggingMiddleware(pluginLog)
+	cgroupMW := NewCgroupRoutingMiddleware(cache, cfg.SetOCIResources, cfg.CPUPeriodUs, pluginLog)
+
+	middlewares := []HookMiddleware{loggingMW}
+	if cfg.PreWarmCgroups {
+		prewarm, err := NewPrewarmMiddleware(cache, cfg.Agent, pluginLog)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create pre-warm middleware: %w", err)
+		}
+		middlewares = append(middlewares, prewarm)
+	}
+	middlewares = append(middlewares, cgroupMW)
+
 	p := &Plugin{
 		cache: cache,
 		log:   pluginLog,
 		name:  cfg.Name,
 		idx:   cfg.Idx,
+
+		metricsAddr:      cfg.MetricsAddr,
+		cacheSyncTimeout: cfg.CacheSyncTimeout,
+		reconnect:        cfg.Reconnect,
+		hooks:            NewChain(middlewares...),
+		routing:          cgroupMW,
+	}
+
+	socketPath := cfg.NRISocket
+	if socketPath == "" {
+		socketPath, err = DetectNRISocketPath()
+		if err != nil {
+			pluginLog.WithError(err).Warn("Failed to detect NRI socket, using the NRI default")
+		} else {
+			pluginLog.WithField("socket", socketPath).Info("Detected NRI socket")
+		}
 	}
 
-	opts := []stub.Option{
+	p.stubOpts = []stub.Option{
 		stub.WithPluginName(cfg.Name),
 		stub.WithPluginIdx(cfg.Idx),
 	}
+	if socketPath != "" {
+		p.stubOpts = append(p.stubOpts, stub.WithSocketPath(socketPath))
+	}
 
-	s, err := stub.New(p, opts...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create NRI stub: %w", err)
+	if err := p.newStub(); err != nil {
+		return nil, err
 	}
-	p.stub = s
 
 	return p, nil
 }
 
+// newStub replaces the NRI stub; a stub whose connection was closed cannot
+// be reused
+func (p *Plugin) newStub() error {
+	s, err := stub.New(p, p.stubOpts...)
+	if err != nil {
+		return fmt.Errorf("failed to create NRI stub: %w", err)
+	}
+	p.stub = s
+	p.routing.setUpdater(s)
+	return nil
+}
+
 func (p *Plugin) Run(ctx context.Context) error {
 	p.log.WithFields(logrus.Fields{
 		"name": p.name,
 		"idx":  p.idx,
 	}).Info("Starting NRI plugin")
 
+	if p.metricsAddr != "" {
+		p.startMetricsServer(p.metricsAddr)
+	}
+
+	go p.watchQuotaEvents(ctx)
+
 	if err := p.cache.Start(ctx); err != nil {
 		return fmt.Errorf("failed to start quota cache: %w", err)
 	}
 
-	err := p.stub.Run(ctx)
+	// Serving CreateContainer from an empty cache would leave containers
+	// outside their namespace slice, so give up instead.
+	syncCtx, cancel := context.WithTimeout(ctx, p.cacheSyncTimeout)
+	defer cancel()
+	if err := p.cache.WaitForSync(syncCtx); err != nil {
+		p.cache.Stop()
+		return err
+	}
+
+	err := p.runStub(ctx)
 	if err != nil {
 		p.log.WithError(err).Error("NRI stub exited with error")
 	}
@@ -83,62 +236,108 @@ func (p *Plugin) Run(ctx context.Context) error {
 	return err
 }
 
+// runStub runs the NRI stub until ctx is cancelled, replacing it with a new
+// one whenever the connection to the runtime is lost. The quota cache keeps
+// running meanwhile: it watches the API server, not the runtime, and the
+// runtime synchronizes the running containers again on reconnect.
+func (p *Plugin) runStub(ctx context.Context) error {
+	delay := p.reconnect.InitialDelay
+	failures := 0
+
+	for {
+		p.connected.Store(false)
+		stop := context.AfterFunc(ctx, p.stub.Stop)
+		err := p.stub.Run(ctx)
+		stop()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == nil {
+			err = errors.New("connection to the runtime closed")
+		}
+
+		if p.connected.Load() {
+			failures = 0
+			delay = p.reconnect.InitialDelay
+		} else {
+			failures++
+			if p.reconnect.MaxAttempts >= 0 && failures > p.reconnect.MaxAttempts {
+				return fmt.Errorf("failed to connect to the runtime after %d attempts: %w", failures, err)
+			}
+		}
+
+		p.log.WithError(err).WithFields(logrus.Fields{
+			"attempt": failures + 1,
+			"delay":   delay,
+		}).Warn("No NRI connection to the runtime, reconnecting")
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, p.reconnect.MaxDelay)
+
+		pluginReconnects.Inc()
+		if err := p.newStub(); err != nil {
+			return err
+		}
+	}
+}
+
+// watchQuotaEvents updates running containers as their namespace quota changes
+func (p *Plugin) watchQuotaEvents(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-p.cache.Events():
+			p.routing.HandleQuotaEvent(event)
+		}
+	}
+}
+
 func (p *Plugin) Configure(_ context.Context, _, runtime, version string) (stub.EventMask, error) {
 	p.log.WithFields(logrus.Fields{
 		"runtime": runtime,
 		"version": version,
 	}).Info("Plugin configured")
+	p.connected.Store(true)
 
 	mask := api.EventMask(0)
 	mask.Set(api.Event_RUN_POD_SANDBOX)
 	mask.Set(api.Event_CREATE_CONTAINER)
+	mask.Set(api.Event_STOP_CONTAINER)
+	mask.Set(api.Event_REMOVE_CONTAINER)
+	mask.Set(api.Event_REMOVE_POD_SANDBOX)
 
 	return stub.EventMask(mask), nil
 }
 
-func (p *Plugin) Synchronize(_ context.Context, pods []*api.PodSandbox, containers []*api.Container) ([]*api.ContainerUpdate, error) {
-	p.log.WithFields(logrus.Fields{
-		"pods":       len(pods),
-		"containers": len(containers),
-	}).Info("Synchronized with runtime")
-
-	return nil, nil
+func (p *Plugin) Synchronize(ctx context.Context, pods []*api.PodSandbox, containers []*api.Container) ([]*api.ContainerUpdate, error) {
+	return p.hooks.Synchronize(ctx, pods, containers)
 }
 
 func (p *Plugin) Shutdown(_ context.Context) {
 	p.log.Info("Plugin shutdown requested")
 }
 
-func (p *Plugin) RunPodSandbox(_ context.Context, pod *api.PodSandbox) error {
-	p.log.WithFields(logrus.Fields{
-		"pod":       pod.GetName(),
-		"namespace": pod.GetNamespace(),
-	}).Debug("Pod sandbox created")
-
-	return nil
+func (p *Plugin) RunPodSandbox(ctx context.Context, pod *api.PodSandbox) error {
+	return p.hooks.RunPodSandbox(ctx, pod)
 }
 
-// CreateContainer adjusts the container's cgroup path to route it to the namespace cgroup slice.
-func (p *Plugin) CreateContainer(_ context.Context, pod *api.PodSandbox, container *api.Container) (*api.ContainerAdjustment, []*api.ContainerUpdate, error) {
-	ns := pod.GetNamespace()
-
-	if !p.cache.HasQuota(ns) {
-		return nil, nil, nil
-	}
-
-	// Systemd cgroup path format: "slice:prefix:name"
-	sliceName := fmt.Sprintf("brasa-%s.slice", ns)
-	cgroupPath := fmt.Sprintf("%s:cri-containerd:%s", sliceName, container.GetId())
+func (p *Plugin) CreateContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container) (*api.ContainerAdjustment, []*api.ContainerUpdate, error) {
+	return p.hooks.CreateContainer(ctx, pod, container)
+}
 
-	adjust := &api.ContainerAdjustment{}
-	adjust.SetLinuxCgroupsPath(cgroupPath)
+func (p *Plugin) StopContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container) ([]*api.ContainerUpdate, error) {
+	return p.hooks.StopContainer(ctx, pod, container)
+}
 
-	p.log.WithFields(logrus.Fields{
-		"pod":       pod.GetName(),
-		"namespace": ns,
-		"container": container.GetName(),
-		"cgroup":    cgroupPath,
-	}).Info("Routing container to namespace cgroup")
+func (p *Plugin) RemoveContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container) error {
+	return p.hooks.RemoveContainer(ctx, pod, container)
+}
 
-	return adjust, nil, nil
+func (p *Plugin) RemovePodSandbox(ctx context.Context, pod *api.PodSandbox) error {
+	return p.hooks.RemovePodSandbox(ctx, pod)
 }
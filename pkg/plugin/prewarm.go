@@ -0,0 +1,133 @@
+package plugin
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/sirupsen/logrus"
+)
+
+// prewarmTimeout bounds the agent request, which delays the pod sandbox
+const prewarmTimeout = 2 * time.Second
+
+// AgentClientConfig is how the plugin reaches the agent's metrics server
+type AgentClientConfig struct {
+	URL string
+
+	// User and PasswordFile, a file holding the password, are sent as basic
+	// auth credentials, for an agent started with --metrics-auth-user
+	User         string
+	PasswordFile string
+
+	// CAFile holds the PEM certificates that verify an agent serving HTTPS
+	// with --metrics-tls-cert; empty uses the system roots
+	CAFile string
+}
+
+// PrewarmMiddleware asks the agent on the node to create the namespace slice
+// when a pod sandbox starts, so the slice and its limits are in place before
+// the pod's first container is routed to it. Failures are logged and never
+// block the pod.
+type PrewarmMiddleware struct {
+	cache    *QuotaCache
+	agentURL string
+	user     string
+	password string
+	client   *http.Client
+	log      *logrus.Entry
+}
+
+func NewPrewarmMiddleware(cache *QuotaCache, agent AgentClientConfig, log *logrus.Entry) (*PrewarmMiddleware, error) {
+	m := &PrewarmMiddleware{
+		cache:    cache,
+		agentURL: strings.TrimSuffix(agent.URL, "/"),
+		user:     agent.User,
+		client:   &http.Client{Timeout: prewarmTimeout},
+		log:      log,
+	}
+
+	if agent.PasswordFile != "" {
+		password, err := os.ReadFile(agent.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read agent password: %w", err)
+		}
+		m.password = strings.TrimSpace(string(password))
+	}
+
+	if agent.CAFile != "" {
+		pem, err := os.ReadFile(agent.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read agent CA: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in agent CA %s", agent.CAFile)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+		m.client.Transport = transport
+	}
+
+	return m, nil
+}
+
+func (m *PrewarmMiddleware) RunPodSandbox(ctx context.Context, pod *api.PodSandbox, next PodFunc) error {
+	ns := pod.GetNamespace()
+	if m.cache.HasQuota(ns) {
+		if err := m.ensureNamespaceCgroup(ctx, ns); err != nil {
+			m.log.WithError(err).WithField("namespace", ns).Warn("Failed to pre-warm namespace cgroup")
+		}
+	}
+	return next(ctx, pod)
+}
+
+// ensureNamespaceCgroup has the agent create the slice of ns; the agent does
+// nothing if it already exists
+func (m *PrewarmMiddleware) ensureNamespaceCgroup(ctx context.Context, ns string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.agentURL+"/slices/"+url.PathEscape(ns), nil)
+	if err != nil {
+		return fmt.Errorf("failed to build agent request: %w", err)
+	}
+	if m.user != "" {
+		req.SetBasicAuth(m.user, m.password)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach agent: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("agent returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (m *PrewarmMiddleware) Synchronize(ctx context.Context, pods []*api.PodSandbox, containers []*api.Container, next SynchronizeFunc) ([]*api.ContainerUpdate, error) {
+	return next(ctx, pods, containers)
+}
+
+func (m *PrewarmMiddleware) RemovePodSandbox(ctx context.Context, pod *api.PodSandbox, next PodFunc) error {
+	return next(ctx, pod)
+}
+
+func (m *PrewarmMiddleware) CreateContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container, next CreateContainerFunc) (*api.ContainerAdjustment, []*api.ContainerUpdate, error) {
+	return next(ctx, pod, container)
+}
+
+func (m *PrewarmMiddleware) StopContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container, next StopContainerFunc) ([]*api.ContainerUpdate, error) {
+	return next(ctx, pod, container)
+}
+
+func (m *PrewarmMiddleware) RemoveContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container, next ContainerFunc) error {
+	return next(ctx, pod, container)
+}
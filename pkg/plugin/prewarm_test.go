@@ -0,0 +1,78 @@
+package plugin
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestPrewarmAgentAuth(t *testing.T) {
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "plugin" || password != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost || r.URL.Path != "/slices/team-a" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer agent.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: agent.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatalf("failed to write CA: %v", err)
+	}
+	passwordFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(passwordFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatalf("failed to write password: %v", err)
+	}
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	tests := []struct {
+		name    string
+		agent   AgentClientConfig
+		wantErr bool
+	}{
+		{
+			name:  "credentials and CA",
+			agent: AgentClientConfig{URL: agent.URL, User: "plugin", PasswordFile: passwordFile, CAFile: caFile},
+		},
+		{
+			name:    "no credentials",
+			agent:   AgentClientConfig{URL: agent.URL, CAFile: caFile},
+			wantErr: true,
+		},
+		{
+			name:    "no CA",
+			agent:   AgentClientConfig{URL: agent.URL, User: "plugin", PasswordFile: passwordFile},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewPrewarmMiddleware(nil, tt.agent, logrus.NewEntry(log))
+			if err != nil {
+				t.Fatalf("NewPrewarmMiddleware() error = %v", err)
+			}
+			err = m.ensureNamespaceCgroup(context.Background(), "team-a")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ensureNamespaceCgroup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/sirupsen/logrus"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/agent"
+	"github.com/fulcro-cloud/namespace-isolation/pkg/api/v1alpha1"
+)
+
+// containerUpdater pushes updates to running containers; implemented by the NRI stub
+type containerUpdater interface {
+	UpdateContainers([]*api.ContainerUpdate) ([]*api.ContainerUpdate, error)
+}
+
+// CgroupRoutingMiddleware routes containers of namespaces with a quota to the
+// namespace cgroup slice and keeps their container-level limits in sync. It
+// handles every hook itself, so it ends the chain and never calls next.
+type CgroupRoutingMiddleware struct {
+	cache           *QuotaCache
+	log             *logrus.Entry
+	setOCIResources bool
+	// cpuPeriodUs is the CPU quota period set with the namespace CPU limit
+	cpuPeriodUs int64
+
+	// containersByNamespace tracks the containers routed to each namespace
+	// slice, so quota changes can be pushed to them while they run.
+	containersMu          sync.Mutex
+	containersByNamespace map[string][]*api.Container
+
+	// updater is set once the NRI stub exists and replaced when the plugin
+	// reconnects; quota changes are only delivered after the plugin runs.
+	// Guarded by containersMu.
+	updater containerUpdater
+}
+
+func NewCgroupRoutingMiddleware(cache *QuotaCache, setOCIResources bool, cpuPeriodUs int64, log *logrus.Entry) *CgroupRoutingMiddleware {
+	return &CgroupRoutingMiddleware{
+		cache:                 cache,
+		log:                   log,
+		setOCIResources:       setOCIResources,
+		cpuPeriodUs:           cpuPeriodUs,
+		containersByNamespace: make(map[string][]*api.Container),
+	}
+}
+
+// HandleQuotaEvent pushes the new limits of an added or updated quota to the
+// running containers of its namespace. After a deletion they keep their
+// container-level limits until they restart outside the slice.
+func (m *CgroupRoutingMiddleware) HandleQuotaEvent(event NamespaceQuotaEvent) {
+	switch event.Type {
+	case QuotaAdded, QuotaUpdated:
+		m.notifyContainers(event.Namespace, event.Spec)
+	case QuotaDeleted:
+		m.log.WithField("namespace", event.Namespace).Debug("Quota deleted, running containers keep their limits")
+	}
+}
+
+func (m *CgroupRoutingMiddleware) Synchronize(_ context.Context, pods []*api.PodSandbox, containers []*api.Container, _ SynchronizeFunc) ([]*api.ContainerUpdate, error) {
+	podNamespaces := make(map[string]string, len(pods))
+	for _, pod := range pods {
+		podNamespaces[pod.GetId()] = pod.GetNamespace()
+	}
+
+	// NRI cannot move a running container to another cgroup, so containers
+	// started before the plugin stay outside the namespace slice until they
+	// restart. Until then, apply the namespace limits to them directly. The
+	// runtime reports their current limits, which an earlier run of the
+	// plugin may already have lowered, so these are never raised above them.
+	var updates []*api.ContainerUpdate
+
+	// One snapshot for all containers, so a quota changing meanwhile is
+	// applied to all of them or none; the change event updates them later.
+	specs := m.cache.SnapshotSpecs()
+
+	m.containersMu.Lock()
+	clear(m.containersByNamespace)
+	for _, container := range containers {
+		ns := podNamespaces[container.GetPodSandboxId()]
+		spec, ok := specs[ns]
+		if !ok {
+			continue
+		}
+		m.containersByNamespace[ns] = append(m.containersByNamespace[ns], container)
+
+		if update := m.containerUpdate(container, spec); update != nil {
+			updates = append(updates, update)
+		}
+	}
+	m.containersMu.Unlock()
+
+	m.updateTrackedGauge()
+	synchronizedContainers.Add(float64(len(updates)))
+
+	m.log.WithFields(logrus.Fields{
+		"pods":       len(pods),
+		"containers": len(containers),
+		"updated":    len(updates),
+	}).Info("Synchronized with runtime")
+
+	return updates, nil
+}
+
+func (m *CgroupRoutingMiddleware) RunPodSandbox(_ context.Context, pod *api.PodSandbox, _ PodFunc) error {
+	m.log.WithFields(logrus.Fields{
+		"pod":       pod.GetName(),
+		"namespace": pod.GetNamespace(),
+	}).Debug("Pod sandbox created")
+
+	return nil
+}
+
+// CreateContainer adjusts the container's cgroup path to route it to the namespace cgroup slice.
+func (m *CgroupRoutingMiddleware) CreateContainer(_ context.Context, pod *api.PodSandbox, container *api.Container, _ CreateContainerFunc) (*api.ContainerAdjustment, []*api.ContainerUpdate, error) {
+	ns := pod.GetNamespace()
+
+	// One lookup for the whole container, so a quota updated meanwhile is
+	// not applied half old, half new
+	spec, ok := m.cache.GetSpec(ns)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	// Systemd cgroup path format: "slice:prefix:name"
+	sliceName := fmt.Sprintf("brasa-%s.slice", ns)
+	cgroupPath := fmt.Sprintf("%s:cri-containerd:%s", sliceName, container.GetId())
+
+	adjust := &api.ContainerAdjustment{}
+	adjust.SetLinuxCgroupsPath(cgroupPath)
+
+	// Pin the container to the namespace cpuset as well, so the runtime does
+	// not assign it CPUs outside the slice's AllowedCPUs.
+	cpuSet := spec.CPUSet
+	if cpuSet != "" {
+		adjust.SetLinuxCPUSetCPUs(cpuSet)
+	}
+
+	if m.setOCIResources {
+		m.setLinuxResources(adjust, container, spec)
+	}
+
+	m.trackContainer(ns, container)
+
+	m.log.WithFields(logrus.Fields{
+		"pod":       pod.GetName(),
+		"namespace": ns,
+		"container": container.GetName(),
+		"cgroup":    cgroupPath,
+		"cpuset":    cpuSet,
+	}).Info("Routing container to namespace cgroup")
+
+	return adjust, nil, nil
+}
+
+// StopContainer stops tracking the container; stopped containers cannot be updated.
+func (m *CgroupRoutingMiddleware) StopContainer(_ context.Context, pod *api.PodSandbox, container *api.Container, _ StopContainerFunc) ([]*api.ContainerUpdate, error) {
+	m.untrackContainers(pod.GetNamespace(), func(c *api.Container) bool {
+		return c.GetId() == container.GetId()
+	})
+	return nil, nil
+}
+
+func (m *CgroupRoutingMiddleware) RemoveContainer(_ context.Context, pod *api.PodSandbox, container *api.Container, _ ContainerFunc) error {
+	m.untrackContainers(pod.GetNamespace(), func(c *api.Container) bool {
+		return c.GetId() == container.GetId()
+	})
+	return nil
+}
+
+// RemovePodSandbox forgets every container of the pod, in case the runtime
+// did not report their removal individually.
+func (m *CgroupRoutingMiddleware) RemovePodSandbox(_ context.Context, pod *api.PodSandbox, _ PodFunc) error {
+	m.untrackContainers(pod.GetNamespace(), func(c *api.Container) bool {
+		return c.GetPodSandboxId() == pod.GetId()
+	})
+	return nil
+}
+
+// setUpdater replaces the stub running containers are updated through
+func (m *CgroupRoutingMiddleware) setUpdater(updater containerUpdater) {
+	m.containersMu.Lock()
+	m.updater = updater
+	m.containersMu.Unlock()
+}
+
+func (m *CgroupRoutingMiddleware) trackContainer(namespace string, container *api.Container) {
+	m.containersMu.Lock()
+	m.containersByNamespace[namespace] = append(m.containersByNamespace[namespace], container)
+	m.containersMu.Unlock()
+
+	m.updateTrackedGauge()
+}
+
+func (m *CgroupRoutingMiddleware) untrackContainers(namespace string, match func(*api.Container) bool) {
+	m.containersMu.Lock()
+	containers := slices.DeleteFunc(m.containersByNamespace[namespace], match)
+	if len(containers) == 0 {
+		delete(m.containersByNamespace, namespace)
+	} else {
+		m.containersByNamespace[namespace] = containers
+	}
+	m.containersMu.Unlock()
+
+	m.updateTrackedGauge()
+}
+
+func (m *CgroupRoutingMiddleware) updateTrackedGauge() {
+	m.containersMu.Lock()
+	defer m.containersMu.Unlock()
+
+	total := 0
+	for _, containers := range m.containersByNamespace {
+		total += len(containers)
+	}
+	trackedContainers.Set(float64(total))
+}
+
+// notifyContainers pushes the resources of a changed quota to the running
+// containers of the namespace. Containers that fail to update keep their old
+// container-level limits; the slice limits still apply to them.
+func (m *CgroupRoutingMiddleware) notifyContainers(namespace string, spec v1alpha1.NamespaceQuotaSpec) {
+	m.containersMu.Lock()
+	updater := m.updater
+	containers := slices.Clone(m.containersByNamespace[namespace])
+	m.containersMu.Unlock()
+
+	if updater == nil || len(containers) == 0 {
+		return
+	}
+
+	updates := make([]*api.ContainerUpdate, 0, len(containers))
+	for _, container := range containers {
+		if update := m.containerUpdate(container, spec); update != nil {
+			updates = append(updates, update)
+		}
+	}
+
+	if len(updates) == 0 {
+		return
+	}
+
+	failed, err := updater.UpdateContainers(updates)
+	if err != nil {
+		m.log.WithError(err).WithField("namespace", namespace).Warn("Failed to update running containers")
+		return
+	}
+
+	m.log.WithFields(logrus.Fields{
+		"namespace":  namespace,
+		"containers": len(updates),
+		"failed":     len(failed),
+	}).Info("Updated running containers with new quota")
+}
+
+// containerUpdate builds an update applying the namespace cpuset and limits to
+// a running container, or returns nil if there is nothing to apply.
+func (m *CgroupRoutingMiddleware) containerUpdate(container *api.Container, spec v1alpha1.NamespaceQuotaSpec) *api.ContainerUpdate {
+	if spec.CPUSet == "" && !m.setOCIResources {
+		return nil
+	}
+
+	update := &api.ContainerUpdate{}
+	update.SetContainerId(container.GetId())
+	if spec.CPUSet != "" {
+		update.SetLinuxCPUSetCPUs(spec.CPUSet)
+	}
+	if m.setOCIResources {
+		m.setLinuxResources(update, container, spec)
+	}
+	update.SetIgnoreFailure()
+	return update
+}
+
+// linuxResourceSetter is implemented by both api.ContainerAdjustment and
+// api.ContainerUpdate.
+type linuxResourceSetter interface {
+	SetLinuxCPUQuota(value int64)
+	SetLinuxCPUPeriod(value int64)
+	SetLinuxMemoryLimit(value int64)
+}
+
+// setLinuxResources lowers the CPU and memory limits of a container to the
+// namespace limits, through an adjustment or an update. Limits are compared
+// with those the container was created with: the lower one is set, and a
+// limit the container does not have is left unset, as the slice already
+// bounds it. Invalid values are logged and skipped; the agent reports them
+// on the quota.
+func (m *CgroupRoutingMiddleware) setLinuxResources(adjust linuxResourceSetter, container *api.Container, spec v1alpha1.NamespaceQuotaSpec) {
+	resources := container.GetLinux().GetResources()
+
+	if containerQuota := resources.GetCpu().GetQuota().GetValue(); spec.CPU != "" && containerQuota > 0 {
+		quota, err := agent.ParseCPU(spec.CPU, m.cpuPeriodUs)
+		if err != nil {
+			m.log.WithError(err).WithField("namespace", spec.Namespace).Warn("Skipping invalid CPU limit")
+		} else {
+			// The runtime applies the kernel default to a quota without a period
+			containerPeriod := int64(resources.GetCpu().GetPeriod().GetValue())
+			if containerPeriod <= 0 {
+				containerPeriod = agent.DefaultCPUPeriod
+			}
+			period := m.cpuPeriodUs
+			if containerQuota*period <= quota*containerPeriod {
+				quota, period = containerQuota, containerPeriod
+			}
+			adjust.SetLinuxCPUQuota(quota)
+			adjust.SetLinuxCPUPeriod(period)
+		}
+	}
+
+	if containerLimit := resources.GetMemory().GetLimit().GetValue(); spec.Memory != "" && containerLimit > 0 {
+		memoryBytes, err := agent.ParseMemory(spec.Memory)
+		if err != nil {
+			m.log.WithError(err).WithField("namespace", spec.Namespace).Warn("Skipping invalid memory limit")
+		} else {
+			adjust.SetLinuxMemoryLimit(min(memoryBytes, containerLimit))
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package plugin
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/sirupsen/logrus"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/api/v1alpha1"
+)
+
+// newTestRoutingMiddleware returns a middleware setting OCI resources with a
+// 50ms CPU period, over a cache holding specs
+func newTestRoutingMiddleware(specs ...v1alpha1.NamespaceQuotaSpec) *CgroupRoutingMiddleware {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	cache := &QuotaCache{specs: map[string]v1alpha1.NamespaceQuotaSpec{}}
+	for _, spec := range specs {
+		cache.specs[spec.Namespace] = spec
+	}
+	return NewCgroupRoutingMiddleware(cache, true, 50000, logrus.NewEntry(log))
+}
+
+// newTestContainer returns a container of the pod pod-a created with a CPU
+// quota and period and a memory limit; zero leaves a limit unset
+func newTestContainer(id string, cpuQuota int64, cpuPeriod uint64, memoryLimit int64) *api.Container {
+	resources := &api.LinuxResources{Cpu: &api.LinuxCPU{}, Memory: &api.LinuxMemory{}}
+	if cpuQuota != 0 {
+		resources.Cpu.Quota = api.Int64(cpuQuota)
+	}
+	if cpuPeriod != 0 {
+		resources.Cpu.Period = api.UInt64(cpuPeriod)
+	}
+	if memoryLimit != 0 {
+		resources.Memory.Limit = api.Int64(memoryLimit)
+	}
+	return &api.Container{
+		Id:           id,
+		PodSandboxId: "pod-a",
+		Name:         "app",
+		Linux:        &api.LinuxContainer{Resources: resources},
+	}
+}
+
+// testLimits are the limits set by an adjustment or update, zero if unset
+type testLimits struct {
+	cpuQuota    int64
+	cpuPeriod   uint64
+	memoryLimit int64
+}
+
+func limitsOf(resources *api.LinuxResources) testLimits {
+	return testLimits{
+		cpuQuota:    resources.GetCpu().GetQuota().GetValue(),
+		cpuPeriod:   resources.GetCpu().GetPeriod().GetValue(),
+		memoryLimit: resources.GetMemory().GetLimit().GetValue(),
+	}
+}
+
+func TestCreateContainerLimits(t *testing.T) {
+	spec := v1alpha1.NamespaceQuotaSpec{Namespace: "team-a", CPU: "1", Memory: "1Gi"}
+
+	tests := []struct {
+		name      string
+		container *api.Container
+		want      testLimits
+	}{
+		{
+			name:      "no container limits",
+			container: newTestContainer("c1", 0, 0, 0),
+			want:      testLimits{},
+		},
+		{
+			name:      "container limits above the namespace",
+			container: newTestContainer("c1", 200000, 100000, 4<<30),
+			want:      testLimits{cpuQuota: 50000, cpuPeriod: 50000, memoryLimit: 1 << 30},
+		},
+		{
+			name:      "container limits below the namespace",
+			container: newTestContainer("c1", 25000, 100000, 512<<20),
+			want:      testLimits{cpuQuota: 25000, cpuPeriod: 100000, memoryLimit: 512 << 20},
+		},
+		{
+			name:      "container quota without a period",
+			container: newTestContainer("c1", 150000, 0, 0),
+			want:      testLimits{cpuQuota: 50000, cpuPeriod: 50000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestRoutingMiddleware(spec)
+			pod := &api.PodSandbox{Id: "pod-a", Name: "pod-a", Namespace: "team-a"}
+
+			adjust, _, err := m.CreateContainer(context.Background(), pod, tt.container, nil)
+			if err != nil {
+				t.Fatalf("CreateContainer() error = %v", err)
+			}
+			if got := limitsOf(adjust.GetLinux().GetResources()); got != tt.want {
+				t.Errorf("CreateContainer() set limits %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeUpdater records the container updates pushed to the runtime
+type fakeUpdater struct {
+	updates []*api.ContainerUpdate
+}
+
+func (u *fakeUpdater) UpdateContainers(updates []*api.ContainerUpdate) ([]*api.ContainerUpdate, error) {
+	u.updates = append(u.updates, updates...)
+	return nil, nil
+}
+
+func TestQuotaUpdateLimits(t *testing.T) {
+	m := newTestRoutingMiddleware(v1alpha1.NamespaceQuotaSpec{Namespace: "team-a", CPU: "1", Memory: "1Gi"})
+	updater := &fakeUpdater{}
+	m.setUpdater(updater)
+
+	pod := &api.PodSandbox{Id: "pod-a", Name: "pod-a", Namespace: "team-a"}
+	for _, container := range []*api.Container{
+		newTestContainer("small", 25000, 100000, 512<<20),
+		newTestContainer("large", 400000, 100000, 4<<30),
+		newTestContainer("unlimited", 0, 0, 0),
+	} {
+		if _, _, err := m.CreateContainer(context.Background(), pod, container, nil); err != nil {
+			t.Fatalf("CreateContainer() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		spec v1alpha1.NamespaceQuotaSpec
+		want map[string]testLimits
+	}{
+		{
+			name: "raised",
+			spec: v1alpha1.NamespaceQuotaSpec{Namespace: "team-a", CPU: "2", Memory: "2Gi"},
+			want: map[string]testLimits{
+				"small":     {cpuQuota: 25000, cpuPeriod: 100000, memoryLimit: 512 << 20},
+				"large":     {cpuQuota: 100000, cpuPeriod: 50000, memoryLimit: 2 << 30},
+				"unlimited": {},
+			},
+		},
+		{
+			name: "lowered below every container",
+			spec: v1alpha1.NamespaceQuotaSpec{Namespace: "team-a", CPU: "100m", Memory: "256Mi"},
+			want: map[string]testLimits{
+				"small":     {cpuQuota: 5000, cpuPeriod: 50000, memoryLimit: 256 << 20},
+				"large":     {cpuQuota: 5000, cpuPeriod: 50000, memoryLimit: 256 << 20},
+				"unlimited": {},
+			},
+		},
+		{
+			name: "raised again",
+			spec: v1alpha1.NamespaceQuotaSpec{Namespace: "team-a", CPU: "1", Memory: "1Gi"},
+			want: map[string]testLimits{
+				"small":     {cpuQuota: 25000, cpuPeriod: 100000, memoryLimit: 512 << 20},
+				"large":     {cpuQuota: 50000, cpuPeriod: 50000, memoryLimit: 1 << 30},
+				"unlimited": {},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updater.updates = nil
+			m.HandleQuotaEvent(NamespaceQuotaEvent{Namespace: "team-a", Type: QuotaUpdated, Spec: tt.spec})
+
+			got := map[string]testLimits{}
+			for _, update := range updater.updates {
+				got[update.GetContainerId()] = limitsOf(update.GetLinux().GetResources())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("updated containers %v, want %d", got, len(tt.want))
+			}
+			for id, want := range tt.want {
+				if got[id] != want {
+					t.Errorf("container %s updated to %+v, want %+v", id, got[id], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/containerd/nri/pkg/api"
+)
+
+// nriSocketPaths are the locations DetectNRISocketPath tries, in order.
+// containerd and CRI-O both serve NRI at api.DefaultSocketPath unless
+// configured otherwise; the second path covers hosts where /var/run is not a
+// link to /run. The runtimes' own CRI sockets do not speak the NRI protocol.
+var nriSocketPaths = []string{
+	api.DefaultSocketPath,
+	"/run/nri/nri.sock",
+}
+
+// DetectNRISocketPath returns the first NRI socket found on the host
+func DetectNRISocketPath() (string, error) {
+	for _, path := range nriSocketPaths {
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no NRI socket found at %s", strings.Join(nriSocketPaths, ", "))
+}
@@ -0,0 +1,131 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/api/v1alpha1"
+	"github.com/fulcro-cloud/namespace-isolation/pkg/api/v1beta1"
+)
+
+// ConvertPath serves the CRD conversion webhook between v1alpha1 and v1beta1
+const ConvertPath = "/convert"
+
+var conversionCodecs = func() serializer.CodecFactory {
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		panic(err)
+	}
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		panic(err)
+	}
+	return serializer.NewCodecFactory(scheme)
+}()
+
+func (s *Server) handleConvert(w http.ResponseWriter, r *http.Request) {
+	review, err := readConversionReview(r)
+	if err != nil {
+		s.log.WithError(err).Warn("Rejecting malformed conversion request")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	review.Response = s.convert(review.Request)
+	review.Request = nil
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		s.log.WithError(err).Error("Failed to write conversion response")
+	}
+}
+
+func (s *Server) convert(req *apiextensionsv1.ConversionRequest) *apiextensionsv1.ConversionResponse {
+	log := s.log.WithFields(logrus.Fields{
+		"uid":     req.UID,
+		"desired": req.DesiredAPIVersion,
+		"objects": len(req.Objects),
+	})
+
+	converted := make([]runtime.RawExtension, 0, len(req.Objects))
+	for _, raw := range req.Objects {
+		obj, err := convertObject(raw.Raw, req.DesiredAPIVersion)
+		if err != nil {
+			log.WithError(err).Warn("Failed to convert NamespaceQuota")
+			return &apiextensionsv1.ConversionResponse{
+				UID: req.UID,
+				Result: metav1.Status{
+					Status:  metav1.StatusFailure,
+					Message: err.Error(),
+				},
+			}
+		}
+		converted = append(converted, runtime.RawExtension{Object: obj})
+	}
+
+	log.Debug("Converted NamespaceQuotas")
+	return &apiextensionsv1.ConversionResponse{
+		UID:              req.UID,
+		ConvertedObjects: converted,
+		Result:           metav1.Status{Status: metav1.StatusSuccess},
+	}
+}
+
+func convertObject(raw []byte, desiredAPIVersion string) (runtime.Object, error) {
+	obj, _, err := conversionCodecs.UniversalDeserializer().Decode(raw, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode object: %w", err)
+	}
+
+	switch in := obj.(type) {
+	case *v1alpha1.NamespaceQuota:
+		switch desiredAPIVersion {
+		case v1alpha1.SchemeGroupVersion.String():
+			return in, nil
+		case v1beta1.SchemeGroupVersion.String():
+			return v1beta1.ConvertFromV1alpha1(in), nil
+		}
+	case *v1beta1.NamespaceQuota:
+		switch desiredAPIVersion {
+		case v1beta1.SchemeGroupVersion.String():
+			return in, nil
+		case v1alpha1.SchemeGroupVersion.String():
+			return v1beta1.ConvertToV1alpha1(in), nil
+		}
+	default:
+		return nil, fmt.Errorf("unexpected object type %T", obj)
+	}
+
+	return nil, fmt.Errorf("unsupported desired API version %q", desiredAPIVersion)
+}
+
+func readConversionReview(r *http.Request) (*apiextensionsv1.ConversionReview, error) {
+	if r.Method != http.MethodPost {
+		return nil, fmt.Errorf("unsupported method %s", r.Method)
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "application/json" {
+		return nil, fmt.Errorf("unsupported content type %q", contentType)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	review := &apiextensionsv1.ConversionReview{}
+	if err := json.Unmarshal(body, review); err != nil {
+		return nil, fmt.Errorf("failed to decode ConversionReview: %w", err)
+	}
+	if review.Request == nil {
+		return nil, fmt.Errorf("ConversionReview has no request")
+	}
+
+	return review, nil
+}
@@ -0,0 +1,102 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// mutate fills in defaults for fields omitted on create so that stored
+// objects always carry an explicit spec.enabled and spec.cpu.
+func (s *Server) mutate(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	log := s.log.WithFields(logrus.Fields{
+		"uid":       req.UID,
+		"name":      req.Name,
+		"operation": req.Operation,
+	})
+
+	if req.Operation != admissionv1.Create {
+		return &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+	}
+
+	patch, err := defaultingPatch(req.Object.Raw)
+	if err != nil {
+		log.WithError(err).Warn("Failed to compute defaults for NamespaceQuota")
+		return &admissionv1.AdmissionResponse{
+			UID:     req.UID,
+			Allowed: false,
+			Result: &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Reason:  metav1.StatusReasonBadRequest,
+				Code:    http.StatusBadRequest,
+				Message: err.Error(),
+			},
+		}
+	}
+
+	resp := &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+	if len(patch) == 0 {
+		return resp
+	}
+
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		log.WithError(err).Error("Failed to encode defaulting patch")
+		return &admissionv1.AdmissionResponse{
+			UID:     req.UID,
+			Allowed: false,
+			Result: &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Reason:  metav1.StatusReasonInternalError,
+				Code:    http.StatusInternalServerError,
+				Message: err.Error(),
+			},
+		}
+	}
+
+	patchType := admissionv1.PatchTypeJSONPatch
+	resp.Patch = patchBytes
+	resp.PatchType = &patchType
+
+	log.WithField("patch", string(patchBytes)).Debug("Defaulted NamespaceQuota")
+	return resp
+}
+
+// defaultingPatch returns the JSON patch operations needed to default the
+// spec fields absent from the raw object.
+func defaultingPatch(raw []byte) ([]patchOperation, error) {
+	var obj struct {
+		Spec map[string]json.RawMessage `json:"spec"`
+	}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, fmt.Errorf("failed to decode NamespaceQuota: %w", err)
+	}
+
+	if obj.Spec == nil {
+		return nil, fmt.Errorf("spec: Required value")
+	}
+
+	var patch []patchOperation
+
+	if _, ok := obj.Spec["enabled"]; !ok {
+		patch = append(patch, patchOperation{Op: "add", Path: "/spec/enabled", Value: true})
+	}
+
+	// An empty CPU value means no CPU limit; make that explicit rather than
+	// leaving the field absent.
+	if _, ok := obj.Spec["cpu"]; !ok {
+		patch = append(patch, patchOperation{Op: "add", Path: "/spec/cpu", Value: ""})
+	}
+
+	return patch, nil
+}
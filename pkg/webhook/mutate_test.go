@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestDefaultingPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    []patchOperation
+		wantErr bool
+	}{
+		{
+			name: "enabled absent",
+			raw:  `{"spec":{"namespace":"team-a","cpu":"2"}}`,
+			want: []patchOperation{{Op: "add", Path: "/spec/enabled", Value: true}},
+		},
+		{
+			name: "cpu absent",
+			raw:  `{"spec":{"namespace":"team-a","enabled":false}}`,
+			want: []patchOperation{{Op: "add", Path: "/spec/cpu", Value: ""}},
+		},
+		{
+			name: "both absent",
+			raw:  `{"spec":{"namespace":"team-a"}}`,
+			want: []patchOperation{
+				{Op: "add", Path: "/spec/enabled", Value: true},
+				{Op: "add", Path: "/spec/cpu", Value: ""},
+			},
+		},
+		{
+			name: "both present",
+			raw:  `{"spec":{"namespace":"team-a","enabled":true,"cpu":""}}`,
+		},
+		{
+			name:    "spec missing",
+			raw:     `{"metadata":{"name":"team-a"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid JSON",
+			raw:     `{"spec":`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := defaultingPatch([]byte(tt.raw))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("defaultingPatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("defaultingPatch() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMutate(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	s := NewServer("0", "", "", log)
+
+	tests := []struct {
+		name        string
+		operation   admissionv1.Operation
+		raw         string
+		wantAllowed bool
+		wantPatch   string
+	}{
+		{
+			name:        "create with defaults",
+			operation:   admissionv1.Create,
+			raw:         `{"spec":{"namespace":"team-a"}}`,
+			wantAllowed: true,
+			wantPatch:   `[{"op":"add","path":"/spec/enabled","value":true},{"op":"add","path":"/spec/cpu","value":""}]`,
+		},
+		{
+			name:        "create without defaults",
+			operation:   admissionv1.Create,
+			raw:         `{"spec":{"namespace":"team-a","enabled":true,"cpu":"1"}}`,
+			wantAllowed: true,
+		},
+		{
+			name:        "create without spec",
+			operation:   admissionv1.Create,
+			raw:         `{}`,
+			wantAllowed: false,
+		},
+		{
+			name:        "update",
+			operation:   admissionv1.Update,
+			raw:         `{}`,
+			wantAllowed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := s.mutate(&admissionv1.AdmissionRequest{
+				UID:       "uid",
+				Operation: tt.operation,
+				Object:    runtime.RawExtension{Raw: []byte(tt.raw)},
+			})
+			if resp.Allowed != tt.wantAllowed {
+				t.Fatalf("mutate() allowed = %v, want %v (%v)", resp.Allowed, tt.wantAllowed, resp.Result)
+			}
+			if string(resp.Patch) != tt.wantPatch {
+				t.Errorf("mutate() patch = %s, want %s", resp.Patch, tt.wantPatch)
+			}
+			if (resp.PatchType != nil) != (tt.wantPatch != "") {
+				t.Errorf("mutate() patch type = %v, want one only with a patch", resp.PatchType)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package webhook
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/fulcro-cloud/namespace-isolation/pkg/agent"
+)
+
+const (
+	ValidatePath = "/validate/namespacequota"
+	MutatePath   = "/mutate/namespacequota"
+
+	maxRequestBytes = 1 << 20
+)
+
+// ValidatingWebhookConfiguration is the manifest registering the validation
+// endpoint with the API server. cert-manager injects its caBundle.
+//
+//go:embed manifests/validatingwebhookconfiguration.yaml
+var ValidatingWebhookConfiguration []byte
+
+// MutatingWebhookConfiguration is the manifest registering the defaulting
+// endpoint with the API server. cert-manager injects its caBundle.
+//
+//go:embed manifests/mutatingwebhookconfiguration.yaml
+var MutatingWebhookConfiguration []byte
+
+// Server serves admission webhooks for NamespaceQuota resources over TLS.
+type Server struct {
+	mux      *http.ServeMux
+	port     string
+	certFile string
+	keyFile  string
+	log      *logrus.Logger
+}
+
+func NewServer(port, certFile, keyFile string, log *logrus.Logger) *Server {
+	s := &Server{
+		mux:      http.NewServeMux(),
+		port:     port,
+		certFile: certFile,
+		keyFile:  keyFile,
+		log:      log,
+	}
+	s.mux.HandleFunc(ValidatePath, s.handleAdmission(s.validate))
+	s.mux.HandleFunc(MutatePath, s.handleAdmission(s.mutate))
+	s.mux.HandleFunc(ConvertPath, s.handleConvert)
+	return s
+}
+
+// Handle serves another webhook endpoint, such as the pod admission check
+func (s *Server) Handle(path string, handler http.Handler) {
+	s.mux.Handle(path, handler)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) Start() error {
+	if s.certFile == "" || s.keyFile == "" {
+		return fmt.Errorf("webhook server requires both a TLS certificate and key")
+	}
+
+	s.log.WithField("port", s.port).Info("Starting webhook server")
+
+	go func() {
+		if err := http.ListenAndServeTLS(":"+s.port, s.certFile, s.keyFile, s); err != nil {
+			s.log.WithError(err).Error("Webhook server error")
+		}
+	}()
+
+	return nil
+}
+
+type admitFunc func(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse
+
+func (s *Server) handleAdmission(admit admitFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		review, err := ReadAdmissionReview(r)
+		if err != nil {
+			s.log.WithError(err).Warn("Rejecting malformed admission request")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		review.Response = admit(review.Request)
+		review.Request = nil
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(review); err != nil {
+			s.log.WithError(err).Error("Failed to write admission response")
+		}
+	}
+}
+
+func (s *Server) validate(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	log := s.log.WithFields(logrus.Fields{
+		"uid":       req.UID,
+		"name":      req.Name,
+		"operation": req.Operation,
+	})
+
+	if _, err := agent.DecodeNamespaceQuota(req.Object.Raw); err != nil {
+		log.WithError(err).Info("Denied NamespaceQuota")
+		return &admissionv1.AdmissionResponse{
+			UID:     req.UID,
+			Allowed: false,
+			Result: &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Reason:  metav1.StatusReasonInvalid,
+				Code:    http.StatusUnprocessableEntity,
+				Message: err.Error(),
+			},
+		}
+	}
+
+	log.Debug("Admitted NamespaceQuota")
+	return &admissionv1.AdmissionResponse{
+		UID:     req.UID,
+		Allowed: true,
+	}
+}
+
+// ReadAdmissionReview decodes the AdmissionReview posted by the API server
+func ReadAdmissionReview(r *http.Request) (*admissionv1.AdmissionReview, error) {
+	if r.Method != http.MethodPost {
+		return nil, fmt.Errorf("unsupported method %s", r.Method)
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "application/json" {
+		return nil, fmt.Errorf("unsupported content type %q", contentType)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	review := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(body, review); err != nil {
+		return nil, fmt.Errorf("failed to decode AdmissionReview: %w", err)
+	}
+	if review.Request == nil {
+		return nil, fmt.Errorf("AdmissionReview has no request")
+	}
+
+	return review, nil
+}